@@ -0,0 +1,412 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "math"
+
+    "internal/layout"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/cairo"
+)
+
+/*
+    Analysis gives the byte statistics of the selection, or of the whole page
+    if nothing is selected, in order to guess what kind of data it contains:
+    high entropy and low chi-square indicate compressed or encrypted data, a
+    large proportion of printable bytes indicates text, a large proportion of
+    zeros indicates tables or padding.
+
+    The entropy is also calculated over successive windows, which are shown as
+    a graph along the offsets. Clicking in the graph moves the caret to the
+    corresponding offset.
+
+    Data is analyzed in background, so that the dialog shows up immediately
+    even with large files: values and graphs are empty until it is done.
+*/
+
+const (
+    ANALYSIS_MIN_WINDOW = 256           // min bytes for a window entropy
+    ANALYSIS_MAX_WINDOWS = 512          // max points in entropy graph
+    ANALYSIS_PENDING = "…"              // value shown until calculated
+
+    HISTOGRAM_WIDTH = 512               // 2 pixels per byte value
+    HISTOGRAM_HEIGHT = 160
+    ENTROPY_GRAPH_WIDTH = ANALYSIS_MAX_WINDOWS
+    ENTROPY_GRAPH_HEIGHT = 100
+)
+
+type analysis struct {
+    start, length   int64
+    counts          [256]int64
+    window          int64           // window size for entropy graph
+    entropies       []float64       // per window, in bits per byte
+    windowCounts    [256]int64      // byte counts in current window
+    inWindow        int64           // bytes counted in current window
+}
+
+// return the Shannon entropy in bits per byte of the given byte counts.
+func getEntropy( counts *[256]int64, total int64 ) (e float64) {
+    for _, c := range counts {
+        if c > 0 {
+            p := float64(c) / float64(total)
+            e -= p * math.Log2( p )
+        }
+    }
+    return
+}
+
+// the following statistics are 0 if there is no data.
+func (a *analysis) getChiSquare( ) (chi float64) {
+    if a.length == 0 {
+        return
+    }
+    expected := float64(a.length) / 256
+    for _, c := range a.counts {
+        d := float64(c) - expected
+        chi += d * d / expected
+    }
+    return
+}
+
+func (a *analysis) getMean( ) float64 {
+    if a.length == 0 {
+        return 0
+    }
+    var sum float64
+    for v, c := range a.counts {
+        sum += float64(v) * float64(c)
+    }
+    return sum / float64(a.length)
+}
+
+// return the percentage of bytes in the range [first, last]
+func (a *analysis) getPercentage( first, last int ) float64 {
+    if a.length == 0 {
+        return 0
+    }
+    var n int64
+    for v := first; v <= last; v++ {
+        n += a.counts[v]
+    }
+    return float64(n) * 100 / float64(a.length)
+}
+
+// return a new analysis of the page data segment [start:start+length[, with
+// no data counted yet.
+func newAnalysis( start, length int64 ) *analysis {
+    a := &analysis{ start: start, length: length }
+    a.window = (length + ANALYSIS_MAX_WINDOWS - 1) / ANALYSIS_MAX_WINDOWS
+    if a.window < ANALYSIS_MIN_WINDOW {
+        a.window = ANALYSIS_MIN_WINDOW
+    }
+    return a
+}
+
+// count byte values and window entropies in data, which follows the data
+// already counted.
+func (a *analysis) count( data []byte ) {
+    for _, b := range data {
+        a.counts[b] ++
+        a.windowCounts[b] ++
+        if a.inWindow ++; a.inWindow == a.window {
+            a.entropies = append( a.entropies,
+                                  getEntropy( &a.windowCounts, a.inWindow ) )
+            a.windowCounts = [256]int64{}
+            a.inWindow = 0
+        }
+    }
+}
+
+// complete the analysis after all data has been counted.
+func (a *analysis) finish( ) {
+    if a.inWindow > 0 {
+        a.entropies = append( a.entropies,
+                              getEntropy( &a.windowCounts, a.inWindow ) )
+    }
+}
+
+func (a *analysis) drawHistogram( da *gtk.DrawingArea, cr *cairo.Context ) {
+    w := float64(da.GetAllocatedWidth())
+    h := float64(da.GetAllocatedHeight())
+    setHexBackgroundColor( cr )
+    cr.Rectangle( 0, 0, w, h )
+    cr.Fill( )
+
+    var max int64
+    for _, c := range a.counts {
+        if c > max {
+            max = c
+        }
+    }
+    if max == 0 {
+        return
+    }
+    setHexForegroundColor( cr )
+    barWidth := w / 256
+    for v, c := range a.counts {
+        barHeight := h * float64(c) / float64(max)
+        cr.Rectangle( float64(v) * barWidth, h - barHeight, barWidth, barHeight )
+    }
+    cr.Fill( )
+}
+
+func (a *analysis) drawEntropyGraph( da *gtk.DrawingArea, cr *cairo.Context ) {
+    w := float64(da.GetAllocatedWidth())
+    h := float64(da.GetAllocatedHeight())
+    setHexBackgroundColor( cr )
+    cr.Rectangle( 0, 0, w, h )
+    cr.Fill( )
+
+    n := len(a.entropies)
+    if n == 0 {
+        return
+    }
+    setHexForegroundColor( cr )
+    step := w / float64(n)
+    for i, e := range a.entropies {
+        y := h - h * e / 8
+        if i == 0 {
+            cr.MoveTo( 0, y )
+        }
+        cr.LineTo( float64(i) * step + step / 2, y )
+    }
+    cr.LineTo( w, h - h * a.entropies[n-1] / 8 )
+    cr.SetLineWidth( 1 )
+    cr.Stroke( )
+
+    // show where the caret is if it is within the analyzed data
+    pos := getCurrentPos() >> 1
+    if pos >= a.start && pos < a.start + a.length {
+        x := w * float64(pos - a.start) / float64(a.length)
+        setCaretColor( cr )
+        cr.MoveTo( x, 0 )
+        cr.LineTo( x, h )
+        cr.Stroke( )
+    }
+}
+
+// move the caret to the offset corresponding to the position x in the graph,
+// if that offset is still in the page.
+func (a *analysis) gotoGraphOffset( da *gtk.DrawingArea, event *gdk.Event ) bool {
+    buttonEvent := gdk.EventButtonNewFromEvent( event )
+    if buttonEvent.Button() != gdk.BUTTON_PRIMARY || a.length == 0 {
+        return false
+    }
+    w := float64(da.GetAllocatedWidth())
+    offset := int64( float64(a.length) * buttonEvent.X() / w )
+    if offset >= a.length {
+        offset = a.length - 1
+    } else if offset < 0 {
+        offset = 0
+    }
+    if a.start + offset >= getCurrentPageContext().store.Length() {
+        return false
+    }
+    log.Printf( "gotoGraphOffset: going to offset %d\n", a.start + offset )
+    gotoPos( (a.start + offset) << 1 )
+    da.QueueDraw( )
+    return true
+}
+
+const (
+    ANALYSIS_RANGE = "analysisRange"
+    ANALYSIS_ENTROPY_PRM = "analysisEntropyPrm"
+    ANALYSIS_ENTROPY = "analysisEntropy"
+    ANALYSIS_CHI_SQUARE_PRM = "analysisChiSquarePrm"
+    ANALYSIS_CHI_SQUARE = "analysisChiSquare"
+    ANALYSIS_MEAN_PRM = "analysisMeanPrm"
+    ANALYSIS_MEAN = "analysisMean"
+    ANALYSIS_PRINTABLE_PRM = "analysisPrintablePrm"
+    ANALYSIS_PRINTABLE = "analysisPrintable"
+    ANALYSIS_ZERO_PRM = "analysisZeroPrm"
+    ANALYSIS_ZERO = "analysisZero"
+    ANALYSIS_HIGH_PRM = "analysisHighPrm"
+    ANALYSIS_HIGH = "analysisHigh"
+)
+
+type analysisValue struct {
+    prmName, valName    string
+    prmId               int
+    value               func( a *analysis ) string
+}
+
+var analysisValues = []analysisValue {
+    { ANALYSIS_ENTROPY_PRM, ANALYSIS_ENTROPY, dialogAnalysisEntropy,
+      func( a *analysis ) string {
+          return fmt.Sprintf( "%.4f", getEntropy( &a.counts, a.length ) )
+      } },
+    { ANALYSIS_CHI_SQUARE_PRM, ANALYSIS_CHI_SQUARE, dialogAnalysisChiSquare,
+      func( a *analysis ) string {
+          return fmt.Sprintf( "%.2f", a.getChiSquare( ) )
+      } },
+    { ANALYSIS_MEAN_PRM, ANALYSIS_MEAN, dialogAnalysisMean,
+      func( a *analysis ) string {
+          return fmt.Sprintf( "%.4f", a.getMean( ) )
+      } },
+    { ANALYSIS_PRINTABLE_PRM, ANALYSIS_PRINTABLE, dialogAnalysisPrintable,
+      func( a *analysis ) string {
+          return fmt.Sprintf( "%.2f %%", a.getPercentage( 0x20, 0x7e ) )
+      } },
+    { ANALYSIS_ZERO_PRM, ANALYSIS_ZERO, dialogAnalysisZero,
+      func( a *analysis ) string {
+          return fmt.Sprintf( "%.2f %%", a.getPercentage( 0, 0 ) )
+      } },
+    { ANALYSIS_HIGH_PRM, ANALYSIS_HIGH, dialogAnalysisHigh,
+      func( a *analysis ) string {
+          return fmt.Sprintf( "%.2f %%", a.getPercentage( 0x80, 0xff ) )
+      } },
+}
+
+type analysisDialogContext struct {
+    lo          *layout.Layout
+    a           *analysis           // empty until data is analyzed
+    graphs      []*gtk.DrawingArea  // histogram and entropy graph
+    reader      *dataReader         // analysis in progress if not nil
+}
+
+func (ac *analysisDialogContext) getDialogDef( start, length int64,
+                                               selection bool ) interface{} {
+
+    promptFmt := layout.TextFmt{ layout.REGULAR, layout.LEFT, 0, false, nil }
+    valueFmt := layout.TextFmt{ layout.MONOSPACE, layout.RIGHT, 0, false, nil }
+
+    var rangeText string
+    if selection {
+        rangeText = fmt.Sprintf( localizeText(dialogAnalysisSelection),
+                                 length, start )
+    } else {
+        rangeText = fmt.Sprintf( localizeText(dialogAnalysisPage), length )
+    }
+    rangeDef := layout.ConstDef{ ANALYSIS_RANGE, 0, rangeText, "", &promptFmt }
+
+    rows := make( []layout.RowDef, len(analysisValues) )
+    for i, v := range analysisValues {
+        prm := layout.ConstDef{ v.prmName, 0, localizeText(v.prmId), "",
+                                &promptFmt }
+        val := layout.ConstDef{ v.valName, 0,
+                                ANALYSIS_PENDING, "", &valueFmt }
+        rows[i] = layout.RowDef{ false, []interface{}{ &prm, &val } }
+    }
+
+    gd := layout.GridDef{ "", 0, layout.HorizontalDef{ 20, []layout.ColDef{
+                                                            { false },
+                                                            { false },
+                                                                   },
+                                                     },
+                          layout.VerticalDef{ 5, rows },
+                        }
+    bd := layout.BoxDef{ "", 0, 10, 0, "", false, layout.VERTICAL,
+                         []interface{}{ &rangeDef, &gd } }
+    return &bd
+}
+
+// start analyzing the page data segment [start:start+length[ in background.
+// Values and graphs are updated once done.
+func (ac *analysisDialogContext) analyze( pc *pageContext, start, length int64 ) {
+    a := newAnalysis( start, length )
+    done := func( err error ) {
+        ac.reader = nil
+        if err != nil {
+            ac.lo.SetItemValue( ANALYSIS_RANGE,
+                                fmt.Sprintf( localizeText(readError),
+                                             getPageName( pc ), err ) )
+            return
+        }
+        a.finish( )
+        ac.a = a
+        for _, v := range analysisValues {
+            ac.lo.SetItemValue( v.valName, v.value( a ) )
+        }
+        for _, da := range ac.graphs {
+            da.QueueDraw( )
+        }
+    }
+    ac.reader = readInBackground( pc, start, start + length, a.count, done )
+}
+
+// cancel the analysis in progress, if any.
+func (ac *analysisDialogContext) cancel( ) {
+    if ac.reader != nil {
+        ac.reader.cancel( )
+        ac.reader = nil
+    }
+}
+
+// return a framed drawing area of the given size, drawn by draw.
+func newAnalysisGraph( title string, width, height int,
+                       draw func( *gtk.DrawingArea, *cairo.Context ) ) (*gtk.Frame,
+                                                                      *gtk.DrawingArea) {
+    frame, err := gtk.FrameNew( title )
+    if err != nil {
+        log.Fatal("newAnalysisGraph: could not create frame:", err)
+    }
+    frame.SetShadowType( gtk.SHADOW_IN )
+    da, err := gtk.DrawingAreaNew()
+    if err != nil {
+        log.Fatal("newAnalysisGraph: could not create drawing area:", err)
+    }
+    da.SetSizeRequest( width, height )
+    da.Connect( "draw", draw )
+    frame.Add( da )
+    return frame, da
+}
+
+// show the byte statistics of the selection, or of the whole page if there is
+// no selection.
+func analysisDialog( ) {
+    pc := getCurrentPageContext()
+    s, l := pc.getSelection()
+    selection := l > 0
+    if ! selection {
+        s, l = 0, pc.store.Length()
+    }
+    ac := &analysisDialogContext{ a: newAnalysis( s, 0 ) }
+
+    ad, err := gtk.DialogNewWithButtons( localizeText(dialogAnalysisTitle), window,
+                    gtk.DIALOG_MODAL | gtk.DIALOG_DESTROY_WITH_PARENT,
+                    []interface{} { localizeText(buttonClose), gtk.RESPONSE_CLOSE } )
+    if err != nil {
+        log.Fatal("analysisDialog: could not create gtk dialog:", err)
+    }
+    ad.SetDefaultResponse( gtk.RESPONSE_CLOSE )
+    carea, err := ad.GetContentArea()
+    if err != nil {
+        log.Fatal("analysisDialog: could not get content area:", err)
+    }
+    carea.SetSpacing( 10 )
+    ac.lo, err = layout.NewLayout( ac.getDialogDef( s, l, selection ) )
+    if err != nil {
+        log.Fatal("analysisDialog: could not make layout:", err)
+    }
+    carea.PackStart( ac.lo.GetRootWidget(), false, false, 0 )
+
+    histogram, hda := newAnalysisGraph( localizeText(dialogAnalysisHistogram),
+                                        HISTOGRAM_WIDTH, HISTOGRAM_HEIGHT,
+                                        func( da *gtk.DrawingArea, cr *cairo.Context ) {
+                                            ac.a.drawHistogram( da, cr )
+                                        } )
+    carea.PackStart( histogram, true, true, 0 )
+
+    entropy, da := newAnalysisGraph( localizeText(dialogAnalysisEntropyGraph),
+                                     ENTROPY_GRAPH_WIDTH, ENTROPY_GRAPH_HEIGHT,
+                                     func( da *gtk.DrawingArea, cr *cairo.Context ) {
+                                         ac.a.drawEntropyGraph( da, cr )
+                                     } )
+    da.SetEvents( int(gdk.EXPOSURE_MASK | gdk.BUTTON_PRESS_MASK) )
+    da.Connect( "button_press_event",
+                func( da *gtk.DrawingArea, event *gdk.Event ) bool {
+                    return ac.a.gotoGraphOffset( da, event )
+                } )
+    da.SetTooltipText( localizeText(tooltipEntropyGraph) )
+    carea.PackStart( entropy, true, true, 0 )
+    ac.graphs = []*gtk.DrawingArea{ hda, da }
+
+    carea.ShowAll()
+    ac.analyze( pc, s, l )
+    ad.Run()
+    ac.cancel( )
+    ad.Destroy()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/gotk3/gotk3/glib"
+)
+
+/*
+    Long calculations over page data, such as checksums or analysis of a large
+    file, run in a goroutine so that the UI does not freeze. As for searches,
+    data is always read on the main thread, since a Storage is not thread safe:
+    the worker asks for the next chunk by adding an idle function, which reads
+    BACKGROUND_READ_SIZE bytes and sends them to the worker through a channel.
+    Chunks are copies, which the worker can safely use.
+
+    Once all data has been consumed, or if data cannot be read, the end of the
+    calculation is posted back to the main thread with another idle function.
+    A cancelled calculation is never posted.
+*/
+
+const (
+    BACKGROUND_READ_SIZE = 256 * 1024
+)
+
+type dataChunk struct {
+    data        []byte
+    err         error               // error that prevented reading data
+}
+
+type dataReader struct {
+    pc          *pageContext        // page being read
+    chunks      chan dataChunk      // data sent to the worker
+    next        int64               // position of the next chunk to send
+    beyond      int64               // end of data range to read
+    cancelled   bool
+}
+
+// start reading the page pc from start to beyond in background: consume is
+// called by the worker with each chunk, in order, then done is called on the
+// main thread, with the error that prevented reading data if any.
+func readInBackground( pc *pageContext, start, beyond int64,
+                       consume func( data []byte ),
+                       done func( err error ) ) *dataReader {
+    r := &dataReader{ pc: pc, chunks: make( chan dataChunk, 1 ),
+                      next: start, beyond: beyond }
+    go r.run( consume, done, start )
+    return r
+}
+
+// cancel reading, so that done is never called.
+func (r *dataReader) cancel( ) {
+    if ! r.cancelled {
+        r.cancelled = true
+        close( r.chunks )
+    }
+}
+
+// called on the main thread to send the next chunk to the worker
+func (r *dataReader) feed( ) bool {
+    if ! r.cancelled {
+        beyond := r.next + BACKGROUND_READ_SIZE
+        if beyond > r.beyond {
+            beyond = r.beyond
+        }
+        data := make( []byte, beyond - r.next )
+        _, err := r.pc.store.ReadAt( data, r.next )
+        r.chunks <- dataChunk{ data, err }
+        r.next = beyond
+    }
+    return false
+}
+
+func (r *dataReader) run( consume func( data []byte ),
+                          done func( err error ), pos int64 ) {
+    var err error
+    for pos < r.beyond {
+        glib.IdleAdd( r.feed )
+        chunk, ok := <-r.chunks
+        if ! ok {
+            return
+        }
+        if err = chunk.err; err != nil {
+            break
+        }
+        consume( chunk.data )
+        pos += int64(len(chunk.data))
+    }
+    glib.IdleAdd( func( ) bool {
+        if ! r.cancelled {
+            done( err )
+        }
+        return false
+    } )
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "hash"
+    "errors"
+    "strconv"
+    "strings"
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "hash/adler32"
+    "encoding/binary"
+
+    "golang.org/x/crypto/sha3"
+    "golang.org/x/crypto/blake2b"
+    "golang.org/x/crypto/blake2s"
+
+    "internal/layout"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+/*
+    Checksums and hashes are calculated over the selection, or over the whole
+    page if nothing is selected. Checksums (CRC, Adler and Fletcher) are
+    numbers, shown in hexadecimal and written back in the chosen endianness,
+    whereas hashes are strings of bytes, shown and written back as they are.
+    They are calculated in background, so that the dialog stays responsive
+    with large files; changing the algorithm restarts the calculation.
+*/
+
+// CRC parameters, in the Rocksoft model. All supported presets have the same
+// reflection for input and output.
+type crcParams struct {
+    width       uint                    // in bits: 8, 16, 32 or 64
+    poly        uint64                  // normal (not reflected) polynomial
+    init        uint64                  // initial register value
+    reflected   bool                    // whether input and output are reflected
+    xorOut      uint64                  // final xor value
+}
+
+type crc struct {
+    params      *crcParams
+    table       [256]uint64
+    mask        uint64
+    register    uint64
+}
+
+func reflectBits( v uint64, width uint ) (r uint64) {
+    for i := uint(0); i < width; i++ {
+        r = r << 1 | (v & 1)
+        v >>= 1
+    }
+    return
+}
+
+func newCrc( params *crcParams ) hash.Hash {
+    c := new( crc )
+    c.params = params
+    c.mask = ^uint64(0) >> (64 - params.width)
+    if params.reflected {
+        poly := reflectBits( params.poly, params.width )
+        for i := range c.table {
+            r := uint64(i)
+            for j := 0; j < 8; j++ {
+                if r & 1 == 1 {
+                    r = r >> 1 ^ poly
+                } else {
+                    r >>= 1
+                }
+            }
+            c.table[i] = r
+        }
+    } else {
+        top := uint64(1) << (params.width - 1)
+        for i := range c.table {
+            r := uint64(i) << (params.width - 8)
+            for j := 0; j < 8; j++ {
+                if r & top != 0 {
+                    r = r << 1 ^ params.poly
+                } else {
+                    r <<= 1
+                }
+            }
+            c.table[i] = r & c.mask
+        }
+    }
+    c.Reset()
+    return c
+}
+
+func (c *crc) Reset( ) {
+    if c.params.reflected {
+        c.register = reflectBits( c.params.init, c.params.width )
+    } else {
+        c.register = c.params.init
+    }
+}
+
+func (c *crc) Write( p []byte ) (int, error) {
+    r := c.register
+    if c.params.reflected {
+        for _, b := range p {
+            r = r >> 8 ^ c.table[byte(r) ^ b]
+        }
+    } else {
+        shift := c.params.width - 8
+        for _, b := range p {
+            r = (r << 8 ^ c.table[byte(r >> shift) ^ b]) & c.mask
+        }
+    }
+    c.register = r
+    return len(p), nil
+}
+
+func (c *crc) Size( ) int {
+    return int(c.params.width >> 3)
+}
+
+func (c *crc) BlockSize( ) int {
+    return 1
+}
+
+func (c *crc) Sum( b []byte ) []byte {
+    v := c.register ^ c.params.xorOut
+    for i := c.Size() - 1; i >= 0; i-- {
+        b = append( b, byte(v >> (uint(i) << 3)) )
+    }
+    return b
+}
+
+// Fletcher-16 over bytes
+type fletcher16 struct {
+    a, b        uint32
+}
+
+func (f *fletcher16) Reset( ) {
+    f.a, f.b = 0, 0
+}
+
+func (f *fletcher16) Write( p []byte ) (int, error) {
+    for _, v := range p {
+        f.a = (f.a + uint32(v)) % 255
+        f.b = (f.b + f.a) % 255
+    }
+    return len(p), nil
+}
+
+func (f *fletcher16) Size( ) int {
+    return 2
+}
+
+func (f *fletcher16) BlockSize( ) int {
+    return 1
+}
+
+func (f *fletcher16) Sum( b []byte ) []byte {
+    return append( b, byte(f.b), byte(f.a) )
+}
+
+// Fletcher-32 over little endian 16-bit words, an odd last byte being padded
+// with a zero byte.
+type fletcher32 struct {
+    a, b        uint32
+    odd         bool
+    low         byte
+}
+
+func (f *fletcher32) Reset( ) {
+    *f = fletcher32{}
+}
+
+func (f *fletcher32) add( w uint32 ) (a, b uint32) {
+    a = (f.a + w) % 65535
+    b = (f.b + a) % 65535
+    return
+}
+
+func (f *fletcher32) Write( p []byte ) (int, error) {
+    for _, v := range p {
+        if f.odd {
+            f.a, f.b = f.add( uint32(v) << 8 | uint32(f.low) )
+        } else {
+            f.low = v
+        }
+        f.odd = ! f.odd
+    }
+    return len(p), nil
+}
+
+func (f *fletcher32) Size( ) int {
+    return 4
+}
+
+func (f *fletcher32) BlockSize( ) int {
+    return 2
+}
+
+func (f *fletcher32) Sum( b []byte ) []byte {
+    a, s := f.a, f.b
+    if f.odd {
+        a, s = f.add( uint32(f.low) )
+    }
+    return append( b, byte(s >> 8), byte(s), byte(a >> 8), byte(a) )
+}
+
+type checksumAlgorithm struct {
+    name        string
+    new         func( ) hash.Hash
+    number      bool                    // false for hashes
+}
+
+func crcAlgorithm( name string, params crcParams ) checksumAlgorithm {
+    return checksumAlgorithm{ name,
+                              func( ) hash.Hash { return newCrc( &params ) },
+                              true }
+}
+
+func mustHash( f func( key []byte ) (hash.Hash, error) ) func( ) hash.Hash {
+    return func( ) hash.Hash {
+        h, err := f( nil )
+        if err != nil {
+            log.Panicf( "mustHash: %v\n", err )
+        }
+        return h
+    }
+}
+
+var checksumAlgorithms = []checksumAlgorithm {
+    crcAlgorithm( "CRC-8", crcParams{ 8, 0x07, 0, false, 0 } ),
+    crcAlgorithm( "CRC-8/MAXIM", crcParams{ 8, 0x31, 0, true, 0 } ),
+    crcAlgorithm( "CRC-16/ARC", crcParams{ 16, 0x8005, 0, true, 0 } ),
+    crcAlgorithm( "CRC-16/MODBUS", crcParams{ 16, 0x8005, 0xffff, true, 0 } ),
+    crcAlgorithm( "CRC-16/CCITT-FALSE",
+                  crcParams{ 16, 0x1021, 0xffff, false, 0 } ),
+    crcAlgorithm( "CRC-16/XMODEM", crcParams{ 16, 0x1021, 0, false, 0 } ),
+    crcAlgorithm( "CRC-16/KERMIT", crcParams{ 16, 0x1021, 0, true, 0 } ),
+    crcAlgorithm( "CRC-32", crcParams{ 32, 0x04c11db7, 0xffffffff, true,
+                                       0xffffffff } ),
+    crcAlgorithm( "CRC-32C", crcParams{ 32, 0x1edc6f41, 0xffffffff, true,
+                                        0xffffffff } ),
+    crcAlgorithm( "CRC-32/BZIP2", crcParams{ 32, 0x04c11db7, 0xffffffff,
+                                             false, 0xffffffff } ),
+    crcAlgorithm( "CRC-32/MPEG-2", crcParams{ 32, 0x04c11db7, 0xffffffff,
+                                              false, 0 } ),
+    crcAlgorithm( "CRC-64/ECMA-182", crcParams{ 64, 0x42f0e1eba9ea3693, 0,
+                                                false, 0 } ),
+    crcAlgorithm( "CRC-64/XZ", crcParams{ 64, 0x42f0e1eba9ea3693,
+                                          ^uint64(0), true, ^uint64(0) } ),
+    crcAlgorithm( "CRC-64/GO-ISO", crcParams{ 64, 0x1b, ^uint64(0), true,
+                                              ^uint64(0) } ),
+    { "Adler-32", func( ) hash.Hash { return adler32.New() }, true },
+    { "Fletcher-16", func( ) hash.Hash { return new( fletcher16 ) }, true },
+    { "Fletcher-32", func( ) hash.Hash { return new( fletcher32 ) }, true },
+    { "MD5", md5.New, false },
+    { "SHA-1", sha1.New, false },
+    { "SHA-224", sha256.New224, false },
+    { "SHA-256", sha256.New, false },
+    { "SHA-384", sha512.New384, false },
+    { "SHA-512", sha512.New, false },
+    { "SHA-512/256", sha512.New512_256, false },
+    { "SHA3-224", sha3.New224, false },
+    { "SHA3-256", sha3.New256, false },
+    { "SHA3-384", sha3.New384, false },
+    { "SHA3-512", sha3.New512, false },
+    { "BLAKE2s-256", mustHash( blake2s.New256 ), false },
+    { "BLAKE2b-256", mustHash( blake2b.New256 ), false },
+    { "BLAKE2b-512", mustHash( blake2b.New512 ), false },
+}
+
+// write the result of the algorithm a at offset in the current page, in the
+// given byte order if the result is a number.
+func writeChecksum( a *checksumAlgorithm, result []byte, offset string,
+                    order binary.ByteOrder ) error {
+    pc := getCurrentPageContext()
+    pos, err := strconv.ParseInt( strings.TrimSpace( offset ), 0, 64 )
+    n := int64(len(result))
+    if err != nil || pos < 0 || pos + n > pc.store.Length() {
+        return errors.New( localizeText(dialogChecksumInvalidOffset) )
+    }
+    data := make( []byte, n )
+    copy( data, result )
+    if a.number && order == binary.LittleEndian {
+        for i, j := 0, len(data) - 1; i < j; i, j = i+1, j-1 {
+            data[i], data[j] = data[j], data[i]
+        }
+    }
+    log.Printf( "writeChecksum: %s at %d\n", a.name, pos )
+    if err = pc.store.ReplaceBytesAt( pos, 0, n, data ); err != nil {
+        return err
+    }
+    pc.canvas.QueueDraw( )    // force redraw
+    return nil
+}
+
+// ---- checksum dialog
+
+// checksum dialog settings, kept from one calculation to the next
+var (
+    checksumIndex       int
+    checksumOffset      string
+)
+
+const (
+    CHECKSUM_INPUT_SIZE = 32
+
+    CHECKSUM_ALGO_PRM = "checksumAlgoPrm"
+    CHECKSUM_ALGO = "checksumAlgo"
+    CHECKSUM_RANGE = "checksumRange"
+    CHECKSUM_RESULT_PRM = "checksumResultPrm"
+    CHECKSUM_RESULT = "checksumResult"
+    CHECKSUM_OFFSET_PRM = "checksumOffsetPrm"
+    CHECKSUM_OFFSET = "checksumOffset"
+    CHECKSUM_ENDIAN_PRM = "checksumEndianPrm"
+    CHECKSUM_STATUS = "checksumStatus"
+)
+
+type checksumDialogContext struct {
+    lo          *layout.Layout
+    start       int64
+    length      int64
+    result      []byte              // nil until calculated
+    reader      *dataReader         // calculation in progress if not nil
+}
+
+// start calculating the checksum or hash of the dialog data segment with the
+// selected algorithm, cancelling the previous calculation if still in
+// progress. The result is shown once calculated.
+func (cd *checksumDialogContext) calculate( ) {
+    cd.cancel( )
+    cd.result = nil
+    cd.lo.SetItemValue( CHECKSUM_RESULT,
+                        localizeText(dialogChecksumCalculating) )
+    pc := getCurrentPageContext()
+    h := checksumAlgorithms[checksumIndex].new( )
+    consume := func( data []byte ) {
+        h.Write( data )
+    }
+    done := func( err error ) {
+        cd.reader = nil
+        if err != nil {
+            cd.lo.SetItemValue( CHECKSUM_RESULT,
+                                fmt.Sprintf( localizeText(readError),
+                                             getPageName( pc ), err ) )
+            return
+        }
+        cd.result = h.Sum( nil )
+        cd.lo.SetItemValue( CHECKSUM_RESULT, fmt.Sprintf( "%x", cd.result ) )
+    }
+    cd.reader = readInBackground( pc, cd.start, cd.start + cd.length,
+                                  consume, done )
+}
+
+// cancel the calculation in progress, if any.
+func (cd *checksumDialogContext) cancel( ) {
+    if cd.reader != nil {
+        cd.reader.cancel( )
+        cd.reader = nil
+    }
+}
+
+func (cd *checksumDialogContext) getDialogDef( writable bool ) interface{} {
+
+    promptFmt := layout.TextFmt{ layout.REGULAR, layout.LEFT, 0, false, nil }
+    statusFmt := layout.TextFmt{ layout.ITALIC, layout.LEFT, 0, false, nil }
+    tooltipSL := localizeText(tooltipSelList)
+
+    copyContent := func( name string, event *gdk.Event ) bool {
+        copy2Clipboard := func( ) {
+            val, err := cd.lo.GetItemValue( name )
+            if err == nil {
+                if t, ok := val.(string); ok {
+                    setClipboardAscii( t )
+                }
+            }
+        }
+        layout.AddPopupMenuItem( "copyValue", localizeText(actionCopyValue), copy2Clipboard )
+        layout.PopupContextMenu( []string{ "copyValue" }, event )
+        layout.DelPopupMenuItem( "copyValue" )
+        return true
+    }
+    resultFmt := layout.TextFmt{ layout.MONOSPACE, layout.LEFT, 0, true,
+                                 copyContent }
+
+    algoNames := make( []string, len(checksumAlgorithms) )
+    for i, a := range checksumAlgorithms {
+        algoNames[i] = a.name
+    }
+    algoChanged := func( name string, val interface{} ) bool {
+        for i, n := range algoNames {
+            if n == val.(string) {
+                checksumIndex = i
+            }
+        }
+        cd.calculate( )
+        return false
+    }
+    algoPrm := layout.ConstDef{ CHECKSUM_ALGO_PRM, 0,
+                                localizeText(dialogChecksumAlgorithm), "",
+                                &promptFmt }
+    algoCtl := layout.StrList{ algoNames, false, 0, nil, nil }
+    algoVal := layout.InputDef{ CHECKSUM_ALGO, 0, algoNames[checksumIndex],
+                                tooltipSL, algoChanged, &algoCtl }
+
+    var rangeText string
+    if _, l := getCurrentPageContext().getSelection(); l > 0 {
+        rangeText = fmt.Sprintf( localizeText(dialogChecksumSelection),
+                                 cd.length, cd.start )
+    } else {
+        rangeText = fmt.Sprintf( localizeText(dialogChecksumPage), cd.length )
+    }
+    rangeDef := layout.ConstDef{ CHECKSUM_RANGE, 0, rangeText, "", &promptFmt }
+
+    resultPrm := layout.ConstDef{ CHECKSUM_RESULT_PRM, 0,
+                                  localizeText(dialogChecksumResult), "",
+                                  &promptFmt }
+    resultVal := layout.ConstDef{ CHECKSUM_RESULT, 0, "",
+                                  localizeText(tooltipCopyValue), &resultFmt }
+
+    rows := []layout.RowDef{
+                { false, []interface{}{ &algoPrm, &algoVal } },
+                { false, []interface{}{ &resultPrm, &resultVal } },
+                           }
+    if writable {
+        offsetPrm := layout.ConstDef{ CHECKSUM_OFFSET_PRM, 0,
+                                      localizeText(dialogChecksumOffsetPrompt),
+                                      "", &promptFmt }
+        offsetCtl := layout.StrList{ nil, true, CHECKSUM_INPUT_SIZE, nil, nil }
+        offsetInp := layout.InputDef{ CHECKSUM_OFFSET, 0, checksumOffset,
+                                      localizeText(tooltipFillNumber), nil,
+                                      &offsetCtl }
+        endianPrm, endianVal := getEndiannessDefs( CHECKSUM_ENDIAN_PRM,
+                                                   &promptFmt )
+        rows = append( rows,
+                layout.RowDef{ false, []interface{}{ &offsetPrm, &offsetInp } },
+                layout.RowDef{ false, []interface{}{ endianPrm, endianVal } } )
+    }
+
+    status := layout.ConstDef{ CHECKSUM_STATUS, 0, "", "", &statusFmt }
+
+    gd := layout.GridDef{ "", 0, layout.HorizontalDef{ 10, []layout.ColDef{
+                                                            { false },
+                                                            { true },
+                                                                   },
+                                                     },
+                          layout.VerticalDef{ 5, rows },
+                        }
+    bd := layout.BoxDef{ "", 0, 15, 0, "", false, layout.VERTICAL,
+                         []interface{}{ &rangeDef, &gd, &status } }
+    return &bd
+}
+
+// show the checksum or hash of the selection, or of the whole page if there is
+// no selection, and allow writing it back in the page if it is writable.
+func checksumDialog( ) {
+    pc := getCurrentPageContext()
+    cd := new( checksumDialogContext )
+    if s, l := pc.getSelection(); l > 0 {
+        cd.start, cd.length = s, l
+    } else {
+        cd.start, cd.length = 0, pc.store.Length()
+    }
+    writable := isCurrentPageWritable( )
+    buttons := [][]interface{}{}
+    if writable {
+        buttons = append( buttons,
+                          []interface{} { localizeText(buttonWrite), gtk.RESPONSE_APPLY } )
+    }
+    buttons = append( buttons,
+                      []interface{} { localizeText(buttonClose), gtk.RESPONSE_CLOSE } )
+
+    dg, err := gtk.DialogNewWithButtons( localizeText(dialogChecksumTitle), window,
+                    gtk.DIALOG_MODAL | gtk.DIALOG_DESTROY_WITH_PARENT, buttons... )
+    if err != nil {
+        log.Fatal("checksumDialog: could not create gtk dialog:", err)
+    }
+    dg.SetDefaultResponse( gtk.RESPONSE_CLOSE )
+    carea, err := dg.GetContentArea()
+    if err != nil {
+        log.Fatal("checksumDialog: could not get content area:", err)
+    }
+    cd.lo, err = layout.NewLayout( cd.getDialogDef( writable ) )
+    if err != nil {
+        log.Fatal("checksumDialog: could not make layout:", err)
+    }
+    carea.Container.Add( cd.lo.GetRootWidget() )
+    carea.ShowAll()
+    cd.calculate( )
+    for dg.Run() == gtk.RESPONSE_APPLY {
+        value, err := cd.lo.GetItemValue( CHECKSUM_OFFSET )
+        if err != nil {
+            log.Fatalf("checksumDialog: can't get offset input\n")
+        }
+        checksumOffset = value.(string)
+        if cd.result == nil {
+            if cd.reader == nil {   // data could not be read
+                break
+            }
+            cd.lo.SetItemValue( CHECKSUM_STATUS,
+                                localizeText(dialogChecksumCalculating) )
+            continue
+        }
+        err = writeChecksum( &checksumAlgorithms[checksumIndex], cd.result,
+                             checksumOffset, getOperationEndianness() )
+        if err == nil {
+            break
+        }
+        cd.lo.SetItemValue( CHECKSUM_STATUS, strings.TrimSpace( err.Error() ) )
+    }
+    cd.cancel( )
+    dg.Destroy()
+}
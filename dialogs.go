@@ -4,9 +4,11 @@ import (
     "log"
     "fmt"
     "bytes"
+    "strings"
     "math/big"
     "encoding/binary"
 
+    "internal/edit"
     "internal/layout"
 
 	"github.com/gotk3/gotk3/gtk"
@@ -18,7 +20,16 @@ func errorDisplay( format string, args ...interface{} ) {
 
     dialog := gtk.MessageDialogNew ( window, gtk.DIALOG_DESTROY_WITH_PARENT,
                                      gtk.MESSAGE_ERROR, gtk.BUTTONS_CLOSE,
-                                     format, args )
+                                     format, args... )
+    dialog.Run( )
+    dialog.Destroy( )
+}
+
+func warningDisplay( format string, args ...interface{} ) {
+
+    dialog := gtk.MessageDialogNew ( window, gtk.DIALOG_DESTROY_WITH_PARENT,
+                                     gtk.MESSAGE_WARNING, gtk.BUTTONS_CLOSE,
+                                     format, args... )
     dialog.Run( )
     dialog.Destroy( )
 }
@@ -182,6 +193,98 @@ func gotoDialog( ) {
     return
 }
 
+// ---- undo history dialog
+
+const HISTORY_INDENT = "  "                 // per alternative branch level
+
+// return the rows showing the undo/redo tree nodes, in depth first order, and
+// the node identifier of each row. The first child of a node continues at the
+// same level, alternative branches are indented by one level.
+func getHistoryRows( nodes []edit.UndoNode, current int,
+                     addFmt string ) (rows [][]string, ids []int) {
+    var appendNode func( id, level int )
+    appendNode = func( id, level int ) {
+        state := fmt.Sprintf( "%s%d", strings.Repeat( HISTORY_INDENT, level ), id )
+        offset := localizeText(dialogHistoryInitial)
+        if id != 0 {
+            offset = fmt.Sprintf( addFmt, nodes[id].Position )
+        }
+        if id == current {
+            state, offset = "<b>" + state + "</b>", "<b>" + offset + "</b>"
+        }
+        rows = append( rows, []string{ state, offset } )
+        ids = append( ids, id )
+        for i, child := range nodes[id].Children {
+            if i == 0 {
+                appendNode( child, level )
+            } else {
+                appendNode( child, level + 1 )
+            }
+        }
+    }
+    appendNode( 0, 0 )
+    return
+}
+
+func undoHistoryDialog( ) {
+    pc := getCurrentPageContext()
+    nodes, current := pc.store.GetUndoTree()
+    rows, ids := getHistoryRows( nodes, current, pc.addFmt )
+
+    hd, err := gtk.DialogNewWithButtons( localizeText(dialogHistoryTitle), window,
+                    gtk.DIALOG_MODAL | gtk.DIALOG_DESTROY_WITH_PARENT,
+                    []interface{} { localizeText(buttonClose), gtk.RESPONSE_CLOSE } )
+    if err != nil {
+        log.Fatal("undoHistoryDialog: could not create gtk dialog:", err)
+    }
+    hd.SetDefaultResponse( gtk.RESPONSE_CLOSE )
+    hd.SetDefaultSize( -1, 400 )
+    carea, err := hd.GetContentArea()
+    if err != nil {
+        log.Fatal("undoHistoryDialog: could not get content area:", err)
+    }
+
+    jump := func( name string, row int ) bool {
+        jumpToUndoState( ids[row] )
+        hd.Response( gtk.RESPONSE_CLOSE )
+        return true
+    }
+    promptFmt := layout.TextFmt{ layout.REGULAR, layout.LEFT, 0, false, nil }
+    prompt := layout.ConstDef{ "historyPrompt", 0,
+                               localizeText(dialogHistoryPrompt), "", &promptFmt }
+    listFmt := layout.TextFmt{ layout.MONOSPACE, layout.LEFT, 0, false, nil }
+    list := layout.ListDef{ "historyList", 0, []layout.ListColDef{
+                                { localizeText(dialogHistoryState), layout.LEFT },
+                                { localizeText(dialogHistoryOffset), layout.RIGHT }, },
+                            &listFmt, jump }
+    gd := layout.GridDef{ "", 0,
+                          layout.HorizontalDef{ 0, []layout.ColDef{ { true } } },
+                          layout.VerticalDef{ 10, []layout.RowDef{
+                                            { false, []interface{}{ &prompt } },
+                                            { true, []interface{}{ &list } },
+                                                                  },
+                                            },
+                        }
+    lo, err := layout.NewLayout( &gd )
+    if err != nil {
+        log.Fatal("undoHistoryDialog: could not make layout:", err)
+    }
+    value, err := lo.GetItemValue( "historyList" )
+    if err != nil {
+        log.Fatal("undoHistoryDialog: could not access list:", err)
+    }
+    dl := value.(*layout.DataList)
+    for _, row := range rows {
+        if err = dl.AppendRow( row... ); err != nil {
+            log.Fatal("undoHistoryDialog: could not append row:", err)
+        }
+    }
+    carea.PackStart( lo.GetRootWidget(), true, true, 0 )
+    carea.ShowAll()
+    hd.Run()
+    hd.Destroy()
+}
+
 // ---- preferences dialog
 
 func changed( name string, val interface{} ) bool {
@@ -401,9 +504,14 @@ const (
 
     SAVE_HEADER = "saveHeader"
     SAVE_PROMPT = "savePrompt"
+    IN_PLACE_PROMPT = "inPlacePrompt"
+    JOURNAL_PROMPT = "journalPrompt"
 
     SEARCH_HEADER = "searchHeader"
     SEARCH_WRAP_PROMPT = "searchWrapPrompt"
+    SEARCH_TEXT_PROMPT = "searchTextPrompt"
+    SEARCH_SELECTION_PROMPT = "searchSelectionPrompt"
+    SEARCH_OVERLAP_PROMPT = "searchOverlapPrompt"
 )
 
 func makePreferenceDialogEditorDef( ) interface{} {
@@ -457,6 +565,20 @@ func makePreferenceDialogEditorDef( ) interface{} {
                     CREATE_BACKUP_FILES, 0, getBoolPreference(CREATE_BACKUP_FILES),
                     tooltipCK, changed, nil }
 
+    inPlacePrompt := layout.ConstDef{
+                    IN_PLACE_PROMPT, PREF_BODY_PADDING,
+                    localizeText(dialogPreferencesSaveInPlace), "", &bodyFmt }
+    inPlaceVal := layout.InputDef{
+                    SAVE_IN_PLACE, 0, getBoolPreference(SAVE_IN_PLACE),
+                    tooltipCK, changed, nil }
+
+    journalPrompt := layout.ConstDef{
+                    JOURNAL_PROMPT, PREF_BODY_PADDING,
+                    localizeText(dialogPreferencesSaveJournal), "", &bodyFmt }
+    journalVal := layout.InputDef{
+                    UNDO_JOURNAL, 0, getBoolPreference(UNDO_JOURNAL),
+                    tooltipCK, changed, nil }
+
     searchHeader := layout.ConstDef{
                     SEARCH_HEADER, PREF_HEAD_PADDING,
                     localizeText(dialogPreferencesSearch), "", &headerFmt }
@@ -466,6 +588,24 @@ func makePreferenceDialogEditorDef( ) interface{} {
     searchVal := layout.InputDef{
                      WRAP_MATCHES, 0, getBoolPreference(WRAP_MATCHES),
                      tooltipCK, changed, nil }
+    searchTextPrompt := layout.ConstDef{
+                    SEARCH_TEXT_PROMPT, PREF_BODY_PADDING,
+                    localizeText(dialogPreferencesSearchText), "", &bodyFmt }
+    searchTextVal := layout.InputDef{
+                     REPLACE_AS_ASCII, 0, getBoolPreference(REPLACE_AS_ASCII),
+                     tooltipCK, changed, nil }
+    searchSelectionPrompt := layout.ConstDef{
+                    SEARCH_SELECTION_PROMPT, PREF_BODY_PADDING,
+                    localizeText(dialogPreferencesSearchSelection), "", &bodyFmt }
+    searchSelectionVal := layout.InputDef{
+                     SEARCH_IN_SELECTION, 0, getBoolPreference(SEARCH_IN_SELECTION),
+                     tooltipCK, changed, nil }
+    searchOverlapPrompt := layout.ConstDef{
+                    SEARCH_OVERLAP_PROMPT, PREF_BODY_PADDING,
+                    localizeText(dialogPreferencesSearchOverlap), "", &bodyFmt }
+    searchOverlapVal := layout.InputDef{
+                     OVERLAPPING_MATCHES, 0, getBoolPreference(OVERLAPPING_MATCHES),
+                     tooltipCK, changed, nil }
 
     gd := layout.GridDef{ EDITOR_GRID, 10, layout.HorizontalDef{ PREF_COL_SPACING,
                                                                   []layout.ColDef{
@@ -497,11 +637,31 @@ func makePreferenceDialogEditorDef( ) interface{} {
                                                 { false, []interface{}{
                                                           &savePrompt, &saveVal },
                                                 },
+                                                { false, []interface{}{
+                                                          &inPlacePrompt,
+                                                          &inPlaceVal },
+                                                },
+                                                { false, []interface{}{
+                                                          &journalPrompt,
+                                                          &journalVal },
+                                                },
                                                 { false, []interface{}{
                                                           &searchHeader, nil },
                                                 },
                                                 { false, []interface{}{
                                                           &searchPrompt, &searchVal },
+                                                },
+                                                { false, []interface{}{
+                                                          &searchTextPrompt,
+                                                          &searchTextVal },
+                                                },
+                                                { false, []interface{}{
+                                                          &searchSelectionPrompt,
+                                                          &searchSelectionVal },
+                                                },
+                                                { false, []interface{}{
+                                                          &searchOverlapPrompt,
+                                                          &searchOverlapVal },
                                                 }, }, }, }
 
     bd := layout.BoxDef{ "", 0, 15, 0, "", false, layout.VERTICAL, []interface{}{ &gd } }
@@ -522,10 +682,20 @@ func updatePreferenceDialogEditorLanguage( lo *layout.Layout ) {
     lo.SetItemValue( SAVE_HEADER, localizeText(dialogPreferencesSave) )
     lo.SetItemValue( SAVE_PROMPT, localizeText(dialogPreferencesSaveBackup) )
     lo.SetItemTooltip( CREATE_BACKUP_FILES, localizeText(tooltipSetMark) )
+    lo.SetItemValue( IN_PLACE_PROMPT, localizeText(dialogPreferencesSaveInPlace) )
+    lo.SetItemTooltip( SAVE_IN_PLACE, localizeText(tooltipSetMark) )
+    lo.SetItemValue( JOURNAL_PROMPT, localizeText(dialogPreferencesSaveJournal) )
+    lo.SetItemTooltip( UNDO_JOURNAL, localizeText(tooltipSetMark) )
 
     lo.SetItemValue( SEARCH_HEADER, localizeText(dialogPreferencesSearch) )
     lo.SetItemValue( SEARCH_WRAP_PROMPT, localizeText(dialogPreferencesSearchWrapAround) )
     lo.SetItemTooltip( WRAP_MATCHES, localizeText(tooltipSetMark) )
+    lo.SetItemValue( SEARCH_TEXT_PROMPT, localizeText(dialogPreferencesSearchText) )
+    lo.SetItemTooltip( REPLACE_AS_ASCII, localizeText(tooltipSetMark) )
+    lo.SetItemValue( SEARCH_SELECTION_PROMPT, localizeText(dialogPreferencesSearchSelection) )
+    lo.SetItemTooltip( SEARCH_IN_SELECTION, localizeText(tooltipSetMark) )
+    lo.SetItemValue( SEARCH_OVERLAP_PROMPT, localizeText(dialogPreferencesSearchOverlap) )
+    lo.SetItemTooltip( OVERLAPPING_MATCHES, localizeText(tooltipSetMark) )
 }
 
 var preferencesDialog *layout.Dialog
@@ -584,6 +754,9 @@ func updatePreferencesDialogFontSize( ) {
 
 // --- explore dialog
 
+// bitstream is limited to 128 bits starting at one of the first 128 bits
+const MAX_EXPLORE_LENGTH = 32
+
 type explore struct {
     dialog      *layout.Dialog
     lo          *layout.Layout
@@ -0,0 +1,337 @@
+package main
+
+import (
+    "io"
+    "log"
+    "fmt"
+    "errors"
+    "strconv"
+    "strings"
+    "math/rand"
+    "encoding/binary"
+    crand "crypto/rand"
+
+    "internal/layout"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+/*
+    Fill overwrites the current selection, or inserts a given number of bytes
+    at the caret if there is no selection, with generated bytes:
+      - a pattern of hex bytes, repeated as many times as needed
+      - a counter of 8, 16, 32 or 64 bits, in the endianness shared with the
+        explore dialog, starting at a given value and incremented by a given
+        step (negative to decrement)
+      - cryptographically secure random bytes
+      - pseudo-random bytes generated from a given seed
+      - bytes generated by a 32 bit linear feedback shift register (LFSR)
+        from a given seed
+    Each fill is a single operation, which is undone or redone at once.
+*/
+
+const (
+    FILL_PATTERN = iota
+    FILL_COUNTER
+    FILL_RANDOM
+    FILL_PSEUDO_RANDOM
+    FILL_LFSR
+)
+
+// counter generates words of size bytes in the given byte order, starting at
+// value and incremented by step after each word.
+type counter struct {
+    value, step         uint64
+    size                int
+    order               binary.ByteOrder
+    word                [8]byte
+    used                int             // bytes of word already read
+}
+
+func (c *counter) Read( p []byte ) (n int, err error) {
+    for n < len(p) {
+        if c.used == 0 {
+            putWord( c.word[:], c.value, c.size, c.order )
+        }
+        k := copy( p[n:], c.word[c.used:c.size] )
+        n += k
+        if c.used += k; c.used == c.size {
+            c.used = 0
+            c.value += c.step
+        }
+    }
+    return
+}
+
+// Galois LFSR taps for the maximal length polynomial x^32+x^22+x^2+x+1
+const LFSR_TAPS = 0x80200003
+
+// lfsr generates bytes made of 8 successive output bits of a 32 bit Galois
+// linear feedback shift register, most significant bit first.
+type lfsr struct {
+    state               uint32          // must never be 0
+}
+
+func (l *lfsr) Read( p []byte ) (n int, err error) {
+    for i := range p {
+        var b byte
+        for j := 0; j < 8; j++ {
+            bit := l.state & 1
+            l.state >>= 1
+            if bit == 1 {
+                l.state ^= LFSR_TAPS
+            }
+            b = b << 1 | byte(bit)
+        }
+        p[i] = b
+    }
+    return len(p), nil
+}
+
+// fill dialog settings, kept from one fill to the next
+var (
+    fillSource          int = FILL_PATTERN
+    fillWordSize        int = 8         // in bits
+    fillPattern         string
+    fillStart           string = "0"
+    fillStep            string = "1"
+    fillCount           string
+)
+
+const (
+    FILL_INPUT_SIZE = 256
+
+    FILL_SOURCE_PRM = "fillSourcePrm"
+    FILL_SOURCE = "fillSource"
+    FILL_PATTERN_PRM = "fillPatternPrm"
+    FILL_PATTERN_INP = "fillPattern"
+    FILL_START_PRM = "fillStartPrm"
+    FILL_START = "fillStart"
+    FILL_STEP_PRM = "fillStepPrm"
+    FILL_STEP = "fillStep"
+    FILL_SIZE_PRM = "fillSizePrm"
+    FILL_SIZE = "fillSize"
+    FILL_ENDIAN_PRM = "fillEndianPrm"
+    FILL_COUNT_PRM = "fillCountPrm"
+    FILL_COUNT = "fillCount"
+    FILL_STATUS = "fillStatus"
+)
+
+func getFillSourceNames( ) []string {
+    return []string{ localizeText(dialogFillPattern),
+                     localizeText(dialogFillCounter),
+                     localizeText(dialogFillRandom),
+                     localizeText(dialogFillPseudoRandom),
+                     localizeText(dialogFillLFSR) }
+}
+
+func getFillDialogDef( selLen int64 ) interface{} {
+
+    promptFmt := layout.TextFmt{ layout.REGULAR, layout.LEFT, 0, false, nil }
+    statusFmt := layout.TextFmt{ layout.ITALIC, layout.LEFT, 0, false, nil }
+    tooltipSL := localizeText(tooltipSelList)
+
+    sourceNames := getFillSourceNames( )
+    sourceChanged := func( name string, val interface{} ) bool {
+        for i, n := range getFillSourceNames( ) {
+            if n == val.(string) {
+                fillSource = i
+            }
+        }
+        return false
+    }
+    sourcePrm := layout.ConstDef{ FILL_SOURCE_PRM, 0,
+                                  localizeText(dialogFillSource), "",
+                                  &promptFmt }
+    sourceCtl := layout.StrList{ sourceNames, false, 0, nil, nil }
+    sourceVal := layout.InputDef{ FILL_SOURCE, 0, sourceNames[fillSource],
+                                  tooltipSL, sourceChanged, &sourceCtl }
+
+    patternPrm := layout.ConstDef{ FILL_PATTERN_PRM, 0,
+                                   localizeText(dialogFillPatternPrompt), "",
+                                   &promptFmt }
+    patternCtl := layout.StrList{ nil, true, FILL_INPUT_SIZE, nil, nil }
+    patternInp := layout.InputDef{ FILL_PATTERN_INP, 0, fillPattern,
+                                   localizeText(tooltipFillPattern), nil,
+                                   &patternCtl }
+
+    startPrm := layout.ConstDef{ FILL_START_PRM, 0,
+                                 localizeText(dialogFillStartPrompt), "",
+                                 &promptFmt }
+    startCtl := layout.StrList{ nil, true, FILL_INPUT_SIZE, nil, nil }
+    startInp := layout.InputDef{ FILL_START, 0, fillStart,
+                                 localizeText(tooltipFillNumber), nil,
+                                 &startCtl }
+
+    stepPrm := layout.ConstDef{ FILL_STEP_PRM, 0,
+                                localizeText(dialogFillStepPrompt), "",
+                                &promptFmt }
+    stepCtl := layout.StrList{ nil, true, FILL_INPUT_SIZE, nil, nil }
+    stepInp := layout.InputDef{ FILL_STEP, 0, fillStep,
+                                localizeText(tooltipFillNumber), nil,
+                                &stepCtl }
+
+    sizeChanged := func( name string, val interface{} ) bool {
+        fillWordSize = int(val.(float64))
+        return false
+    }
+    sizePrm := layout.ConstDef{ FILL_SIZE_PRM, 0,
+                                localizeText(dialogOperationWordSizePrompt), "",
+                                &promptFmt }
+    sizeCtl := layout.IntList{ []int{ 8, 16, 32, 64 }, false }
+    sizeVal := layout.InputDef{ FILL_SIZE, 0, fillWordSize, tooltipSL,
+                                sizeChanged, &sizeCtl }
+
+    endianPrm, endianVal := getEndiannessDefs( FILL_ENDIAN_PRM, &promptFmt )
+
+    var countPrm, countVal interface{}
+    if selLen > 0 {
+        countPrm = &layout.ConstDef{ FILL_COUNT_PRM, 0,
+                                     localizeText(dialogFillSelection), "",
+                                     &promptFmt }
+        countVal = &layout.ConstDef{ FILL_COUNT, 0,
+                                     fmt.Sprintf( "%d", selLen ), "",
+                                     &promptFmt }
+    } else {
+        countPrm = &layout.ConstDef{ FILL_COUNT_PRM, 0,
+                                     localizeText(dialogFillCountPrompt), "",
+                                     &promptFmt }
+        countCtl := layout.StrList{ nil, true, FILL_INPUT_SIZE, nil, nil }
+        countVal = &layout.InputDef{ FILL_COUNT, 0, fillCount,
+                                     localizeText(tooltipFillNumber), nil,
+                                     &countCtl }
+    }
+
+    status := layout.ConstDef{ FILL_STATUS, 0, "", "", &statusFmt }
+
+    gd := layout.GridDef{ "", 0, layout.HorizontalDef{ 10, []layout.ColDef{
+                                                            { false },
+                                                            { true },
+                                                                   },
+                                                     },
+                          layout.VerticalDef{ 5, []layout.RowDef{
+                                { false, []interface{}{ &sourcePrm, &sourceVal } },
+                                { false, []interface{}{ &patternPrm, &patternInp } },
+                                { false, []interface{}{ &startPrm, &startInp } },
+                                { false, []interface{}{ &stepPrm, &stepInp } },
+                                { false, []interface{}{ &sizePrm, &sizeVal } },
+                                { false, []interface{}{ endianPrm, endianVal } },
+                                { false, []interface{}{ countPrm, countVal } },
+                                                                },
+                                            },
+                        }
+    bd := layout.BoxDef{ "", 0, 15, 0, "", false, layout.VERTICAL,
+                         []interface{}{ &gd, &status } }
+    return &bd
+}
+
+// get the string value of the named dialog input.
+func getFillInput( lo *layout.Layout, name string ) string {
+    value, err := lo.GetItemValue( name )
+    if err != nil {
+        log.Fatalf("getFillInput: can't get input %s\n", name )
+    }
+    return value.(string)
+}
+
+// fill n bytes replacing dl bytes at position pos with data generated
+// according to the current fill settings.
+func fillAt( pos, dl, n int64 ) error {
+    pc := getCurrentPageContext()
+    log.Printf( "fillAt: source %d replacing [%d, %d[ with %d bytes\n",
+                fillSource, pos, pos+dl, n )
+    if fillSource == FILL_PATTERN {
+        pattern, err := getHexBytes( fillPattern )
+        if err != nil {
+            return err
+        }
+        if len(pattern) == 0 {
+            return errors.New( localizeText(dialogFillNoPattern) )
+        }
+        return pc.store.FillWithPatternAt( pos, 0, dl, n, pattern )
+    }
+
+    var r io.Reader
+    switch fillSource {
+    case FILL_COUNTER:
+        bits := fillWordSize
+        start, err := getNumber( fillStart, bits )
+        if err != nil {
+            return err
+        }
+        step, err := getNumber( fillStep, bits )
+        if err != nil {
+            return err
+        }
+        r = &counter{ value: start, step: step, size: bits >> 3,
+                      order: getOperationEndianness() }
+    case FILL_RANDOM:
+        r = crand.Reader
+    case FILL_PSEUDO_RANDOM:
+        seed, err := getNumber( fillStart, 64 )
+        if err != nil {
+            return err
+        }
+        r = rand.New( rand.NewSource( int64(seed) ) )
+    case FILL_LFSR:
+        seed, err := getNumber( fillStart, 32 )
+        if err != nil {
+            return err
+        }
+        if seed == 0 {
+            return errors.New( localizeText(dialogFillZeroSeed) )
+        }
+        r = &lfsr{ uint32(seed) }
+    default:
+        log.Panicf( "fillAt: unknown fill source %d\n", fillSource )
+    }
+    return pc.store.FillFromReaderAt( pos, 0, dl, n, r )
+}
+
+// ask for the fill settings and fill the current selection, or insert the
+// requested number of bytes at the caret. The dialog stays open until the
+// settings are valid.
+func fillDialog( ) {
+    pc := getCurrentPageContext()
+    s, l := pc.getSelection()
+
+    fd, err := gtk.DialogNewWithButtons( localizeText(dialogFillTitle), window,
+                    gtk.DIALOG_MODAL | gtk.DIALOG_DESTROY_WITH_PARENT,
+                    []interface{} { localizeText(buttonApply), gtk.RESPONSE_ACCEPT },
+                    []interface{} { localizeText(buttonCancel), gtk.RESPONSE_CANCEL } )
+    if err != nil {
+        log.Fatal("fillDialog: could not create gtk dialog:", err)
+    }
+    fd.SetDefaultResponse( gtk.RESPONSE_ACCEPT )
+    carea, err := fd.GetContentArea()
+    if err != nil {
+        log.Fatal("fillDialog: could not get content area:", err)
+    }
+    lo, err := layout.NewLayout( getFillDialogDef( l ) )
+    if err != nil {
+        log.Fatal("fillDialog: could not make layout:", err)
+    }
+    carea.Container.Add( lo.GetRootWidget() )
+    carea.ShowAll()
+    for fd.Run() == gtk.RESPONSE_ACCEPT {
+        fillPattern = getFillInput( lo, FILL_PATTERN_INP )
+        fillStart = getFillInput( lo, FILL_START )
+        fillStep = getFillInput( lo, FILL_STEP )
+        pos, dl, n := s, l, l
+        if s == -1 {
+            fillCount = getFillInput( lo, FILL_COUNT )
+            pos, dl = pc.caretPos >> 1, 0
+            n, err = strconv.ParseInt( strings.TrimSpace( fillCount ), 0, 64 )
+            if err != nil || n <= 0 {
+                lo.SetItemValue( FILL_STATUS, localizeText(dialogFillInvalidCount) )
+                continue
+            }
+        }
+        if err = fillAt( pos, dl, n ); err == nil {
+            pc.canvas.QueueDraw( )    // force redraw
+            break
+        }
+        lo.SetItemValue( FILL_STATUS, strings.TrimSpace( err.Error() ) )
+    }
+    fd.Destroy()
+}
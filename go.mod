@@ -3,6 +3,8 @@ module github.com/jrm-1535/hexed
 go 1.17
 
 require github.com/gotk3/gotk3 v0.6.1
+require golang.org/x/crypto v0.1.0
+require golang.org/x/sys v0.1.0 // indirect
 require internal/layout v0.0.0
 require internal/edit v0.0.0
 
@@ -23,6 +23,7 @@ func (pc *pageContext) setCaretPosition( offset int64,  unit int ) {
                                     int64(pc.nBytesLine << 1)
     dataNibbles := pc.store.Length() << 1
 
+    pc.store.CloseRun()     // moving caret ends typing run in undo/redo
     if pc.sel.start != -1 {
         if unit < END && offset == 1  {     // next char, line or page starts at
             pc.caretPos = pc.sel.beyond * 2 // the bottom end of the selection
@@ -786,6 +787,7 @@ func editAtCaret( da *gtk.DrawingArea, event *gdk.Event ) bool {
     case INSERT_KEY:
         if ! pc.tempReadOnly {
             pc.replaceMode = ! pc.replaceMode
+            pc.store.CloseRun()
             if pc.caretPos & 1 == 0 { // ensure proper state setting for insert
                 pc.setEvenCaretNoPending()
             } else {
@@ -0,0 +1,186 @@
+package edit
+
+import (
+    "fmt"
+    "os"
+)
+
+/*
+    Dirty ranges are the segments of data that may differ from the file on
+    disk. As long as the data length is not modified, they are made of the
+    segments where current pieces do not refer to the original data at the
+    same position, plus the segments already written in the file since it was
+    loaded (the original data is never modified, even after saving). This
+    allows saving by just writing those segments in the file, instead of
+    rewriting the whole file.
+*/
+
+// Range is a segment of data starting at Start and made of Length bytes.
+type Range struct {
+    Start, Length       int64
+}
+
+// append range r to the list of ranges, merging it with the last range in
+// the list if both are contiguous or overlapping.
+func appendRange( ranges []Range, r Range ) []Range {
+    if r.Length == 0 {
+        return ranges
+    }
+    if l := len(ranges); l > 0 {
+        last := &ranges[l-1]
+        if last.Start + last.Length >= r.Start {
+            if beyond := r.Start + r.Length;
+                                    beyond > last.Start + last.Length {
+                last.Length = beyond - last.Start
+            }
+            return ranges
+        }
+    }
+    return append( ranges, r )
+}
+
+// merge two lists of sorted ranges in a single sorted list.
+func mergeRanges( a, b []Range ) []Range {
+    ranges := make( []Range, 0, len(a) + len(b) )
+    for len(a) > 0 || len(b) > 0 {
+        if len(b) == 0 || (len(a) > 0 && a[0].Start <= b[0].Start) {
+            ranges = appendRange( ranges, a[0] )
+            a = a[1:]
+        } else {
+            ranges = appendRange( ranges, b[0] )
+            b = b[1:]
+        }
+    }
+    return ranges
+}
+
+// return the segments of current data that are not the original data at the
+// same position.
+func (s *Storage) modifiedRanges( ) (ranges []Range) {
+    var pos int64
+    for _, p := range s.pieces {
+        if p.source != original || p.start != pos {
+            ranges = appendRange( ranges, Range{ pos, p.length } )
+        }
+        pos += p.length
+    }
+    return
+}
+
+func (s *Storage) originalLength( ) int64 {
+    if s.org == nil {
+        return 0
+    }
+    return s.org.size()
+}
+
+// GetDirtyRanges returns the sorted list of data segments that may differ
+// from the file last loaded or saved, and whether those segments can be
+// written in place in the file (only if the data length was never modified).
+func (s *Storage) GetDirtyRanges( ) (ranges []Range, inPlace bool) {
+    ranges = mergeRanges( s.modifiedRanges(), s.written )
+    inPlace = s.fileInfo != nil && ! s.rewritten &&
+              s.length == s.originalLength()
+    return
+}
+
+// WriteChangesInPlace writes only the dirty ranges in the existing file given
+// by path, which must be the file last loaded or saved. This is possible only
+// if the data length was never modified, otherwise an error is returned and
+// the whole file must be rewritten instead. This is the only way to save data
+// in special files, such as block devices. The undo journal, if any, is
+// restarted for that file, keeping the undo/redo tree.
+func (s *Storage) WriteChangesInPlace( path string ) error {
+    ranges, inPlace := s.GetDirtyRanges()
+    if ! inPlace {
+        return fmt.Errorf( "Changes cannot be written in place\n" )
+    }
+    info, err := os.Stat( path )
+    if err != nil {
+        return err
+    }
+    if ! os.SameFile( info, s.fileInfo ) || ( info.Mode().IsRegular() &&
+       ( info.Size() != s.fileInfo.Size() ||
+         ! info.ModTime().Equal( s.fileInfo.ModTime() ) ) ) {
+        return fmt.Errorf( "File %s has changed since last loaded or saved\n",
+                           path )
+    }
+
+    f, err := os.OpenFile( path, os.O_WRONLY, 0 )
+    if err != nil {
+        return err
+    }
+    buffer := make( []byte, filePageSize )
+    for _, r := range ranges {
+        beyond := r.Start + r.Length
+        if err = s.org.preserve( r.Start, beyond ); err != nil {
+            break
+        }
+        for pos := r.Start; pos < beyond && err == nil; {
+            l := beyond - pos
+            if l > filePageSize {
+                l = filePageSize
+            }
+            var n int
+            if n, err = s.ReadAt( buffer[:l], pos ); err != nil {
+                break
+            }
+            _, err = f.WriteAt( buffer[:n], pos )
+            pos += int64(n)
+        }
+        if err != nil {
+            break
+        }
+    }
+    if err == nil {
+        err = f.Sync()
+    }
+    if err == nil {
+        info, err = f.Stat()
+    }
+    if cErr := f.Close(); err == nil {
+        err = cErr
+    }
+    // even in case of error, ranges may have been partially written
+    s.written = ranges
+    if err == nil {
+        s.fileInfo = info
+        s.saved = s.current
+        s.setBase( )
+        s.rebaseJournal( path )
+    } else {
+        s.closeJournal( true )  // file content is unknown
+    }
+    return err
+}
+
+// IsLoadedFile returns true if path is the file last loaded or saved, which
+// is the only file where changes may be written in place.
+func (s *Storage) IsLoadedFile( path string ) bool {
+    if s.fileInfo == nil {
+        return false
+    }
+    info, err := os.Stat( path )
+    return err == nil && os.SameFile( info, s.fileInfo )
+}
+
+// SetSaved must be called after the whole data was written in the file given
+// by path, so that dirty ranges are known relative to that file. The undo
+// journal, if any, is restarted for that file, keeping the undo/redo tree.
+func (s *Storage) SetSaved( path string ) {
+    s.saved = s.current
+    s.setBase( )
+    info, err := os.Stat( path )
+    if err != nil {
+        s.fileInfo = nil
+        s.closeJournal( true )
+        return
+    }
+    s.fileInfo = info
+    s.rebaseJournal( path )
+    if s.length == s.originalLength() {
+        s.written = mergeRanges( s.modifiedRanges(), s.written )
+    } else {
+        s.rewritten = true
+    }
+}
@@ -0,0 +1,131 @@
+package edit
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// return whether both lists of ranges are the same, nil being the same as an
+// empty list.
+func sameRanges( a, b []Range ) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func TestDirtyRanges( t *testing.T ) {
+    tests := []struct {
+        name            string
+        do              func( s *Storage, path string )
+        dirty           []Range
+        inPlace         bool
+    }{
+        { "unmodified", func( s *Storage, path string ) { }, nil, true },
+        { "insert", func( s *Storage, path string ) {
+            s.InsertBytesAt( 2, 0, []byte("ab") )
+        }, []Range{ { 2, 10 } }, false },
+        { "replace", func( s *Storage, path string ) {
+            s.ReplaceByteAt( 3, 0, 'x' )
+        }, []Range{ { 3, 1 } }, true },
+        { "delete", func( s *Storage, path string ) {
+            s.DeleteBytesAt( 4, 0, 2 )
+        }, []Range{ { 4, 4 } }, false },
+        { "same bytes", func( s *Storage, path string ) {
+            s.ReplaceBytesAt( 5, 0, 2, []byte("56") )
+        }, []Range{ { 5, 2 } }, true },
+        { "moved", func( s *Storage, path string ) {
+            s.Transaction( 0, func( ) error {
+                s.DeleteBytesAt( 0, 0, 2 )
+                return s.InsertBytesAt( 8, 0, []byte("01") )
+            } )
+        }, []Range{ { 0, 10 } }, true },
+        { "undone", func( s *Storage, path string ) {
+            s.ReplaceBytesAt( 0, 0, 5, []byte("abc") )
+            s.Undo( )
+        }, nil, true },
+        { "written", func( s *Storage, path string ) {
+            s.ReplaceByteAt( 3, 0, 'x' )
+            s.SetSaved( path )
+            s.ReplaceByteAt( 6, 0, 'y' )
+            s.Undo( )
+            s.Undo( )
+        }, []Range{ { 3, 1 } }, true },
+        { "rewritten", func( s *Storage, path string ) {  // whole file only
+            s.InsertBytesAt( 3, 0, []byte("x") )
+            s.SetSaved( path )
+            s.Undo( )
+        }, nil, false },
+    }
+    for _, test := range tests {
+        s, path := newTestStorage( t, "0123456789" )
+        test.do( s, path )
+        dirty, inPlace := s.GetDirtyRanges( )
+        if ! sameRanges( dirty, test.dirty ) || inPlace != test.inPlace {
+            t.Errorf( "%s: dirty ranges %v, %t want %v, %t\n", test.name,
+                      dirty, inPlace, test.dirty, test.inPlace )
+        }
+    }
+}
+
+func TestIsLoadedFile( t *testing.T ) {
+    s, path := newTestStorage( t, "0123456789" )
+    other := filepath.Join( filepath.Dir( path ), "other" )
+    link := filepath.Join( filepath.Dir( path ), "link" )
+    if err := os.Symlink( path, link ); err != nil {
+        t.Fatal( err )
+    }
+    tests := []struct {
+        path            string
+        loaded          bool
+    }{
+        { path, true },
+        { link, true },
+        { other, false },           // not existing yet
+    }
+    for _, test := range tests {
+        if loaded := s.IsLoadedFile( test.path ); loaded != test.loaded {
+            t.Errorf( "%s: loaded is %t\n", test.path, loaded )
+        }
+    }
+    if err := os.WriteFile( other, []byte("0123456789"), 0600 ); err != nil {
+        t.Fatal( err )
+    }
+    s.SetSaved( other )
+    if s.IsLoadedFile( path ) || ! s.IsLoadedFile( other ) {
+        t.Errorf( "loaded file not changed by SetSaved\n" )
+    }
+}
+
+func TestMergeRanges( t *testing.T ) {
+    tests := []struct {
+        name            string
+        a, b, merged    []Range
+    }{
+        { "empty", nil, nil, nil },
+        { "disjoint", []Range{ { 0, 2 }, { 10, 5 } },
+                      []Range{ { 4, 2 }, { 16, 4 } },
+                      []Range{ { 0, 2 }, { 4, 2 }, { 10, 5 }, { 16, 4 } } },
+        { "contiguous", []Range{ { 0, 2 }, { 6, 4 } },
+                        []Range{ { 2, 4 }, { 10, 10 } },
+                        []Range{ { 0, 20 } } },
+        { "overlapping", []Range{ { 2, 10 } },
+                         []Range{ { 0, 4 }, { 6, 2 }, { 18, 5 } },
+                         []Range{ { 0, 12 }, { 18, 5 } } },
+        { "included", []Range{ { 2, 2 }, { 5, 1 } }, []Range{ { 0, 30 } },
+                      []Range{ { 0, 30 } } },
+    }
+    for _, test := range tests {
+        merged := mergeRanges( test.a, test.b )
+        if ! sameRanges( merged, test.merged ) {
+            t.Errorf( "%s: merged %v, want %v\n", test.name,
+                      merged, test.merged )
+        }
+    }
+}
@@ -4,30 +4,75 @@ package edit
 
 import (
     "fmt"
+    "io"
     "log"
     "os"
+    "time"
 )
 
 const (
-    defFileSize = 1024
-    defUndoSize =  128
-    defSliceSize = 32       // must be 2 power
+    defUndoSize  =  128
+    defAddSize   = 1024
 )
 
+/*
+    Storage is organized as a piece table: data bytes are never moved when
+    editing. The original data (as read from the file) is never modified, and
+    all inserted or replacing bytes are appended to an add buffer, which is
+    never modified either. The current content is described by an ordered list
+    of pieces, each piece refering to a segment of the original data, to a
+    segment of the add buffer, or to a segment of zeros (which does not need
+    any storage).
+
+    Any modification (insert, delete or replace) is described as a swap in the
+    piece list: a few consecutive pieces are removed from the list and a few new
+    pieces are inserted in their place. Undoing a modification just reverts the
+    swap, and redoing it just performs the swap again, without copying any data.
+*/
+
+// piece sources
+const (
+    original = iota                     // segment of original data
+    added                               // segment of add buffer
+    zeros                               // segment of zeros (no data)
+)
+
+type piece struct {
+    source              int             // original, added or zeros
+    start,                              // segment start in source (if data)
+    length              int64           // segment length (never 0)
+}
+
+type pieceSwap struct {
+    index               int             // first piece index in list
+    before,                             // pieces removed from list
+    after               []piece         // pieces inserted in list
+}
+
 type singlePosOp struct {
     tag,                                // caller's command tag (returned at undo/redo)
     delLen,                             // length of replaced or deleted data
     insLen,                             // length of replacing or inserted data
-    backup, cut,                        // where data is saved for undo
     position            int64           // where in data operation takes place
+    swap                pieceSwap       // how pieces are modified
 }
 
 type multiPosOp struct {
+    tag                 int64           // caller's command tag (returned at undo/redo)
+    positions,                          // where in data operations take place
+    delLens,                            // length of replaced data at each position
+    insLens             []int64         // length of replacing data at each position
+    swap                pieceSwap       // how pieces are modified
+}
+
+type groupOp struct {
     tag,                                // caller's command tag (returned at undo/redo)
-    delLen,                             // length of replaced or deleted data
-    insLen,                             // length of replacing or inserted data
-    backup, cut         int64           // where data is saved for undo
-    positions           []int64         // where in data operations take place
+    position            int64           // where in data the first operation takes place
+    ops                 []interface{}   // grouped operations, in order
+}
+
+type runOp struct {
+    ops                 []interface{}   // coalesced single byte operations
 }
 
 // clipboard interface required for cutting to and pasting from.
@@ -39,62 +84,67 @@ type Clipboard interface{
 
 // Storage object required for any operation.
 type Storage struct {
-    curData             []byte          // always current data
-    newData             []byte          // inserted/replacing data (for redo)
-    cutData             []byte          // deleted/replaced data (for redo)
-
-    stack               []interface{}   // UNDO-REDO stack
+    org                 origin          // original data (never modified)
+    addData             []byte          // inserted/replacing data (append only)
+    pieces              []piece         // current data as a list of pieces
+    length              int64           // current data length
+
+    fileInfo            os.FileInfo     // file last loaded or saved
+    written             []Range         // where file may differ from original
+    rewritten           bool            // true if file was saved with new length
+    base                [zeros+1][]Range // segments by source at last load or save
+    modified            []Range         // modified ranges, if valid
+    modifiedValid       bool            // false when pieces have changed
+    journal             *journal        // persistent undo/redo journal if any
+    groups              []groupStart    // groups in progress, outermost first
+    run                 int             // tree node of run in progress, or 0
+    runTime             time.Time       // time of last operation in run
+
+    tree                []undoNode      // UNDO-REDO tree (initial state at 0)
     clip                Clipboard
 
-    top                 int             // stack pointer
-    notifyDataChange    func( )
+    current             int             // tree node of current state
+    saved               int             // tree node of state last loaded or saved
+    subscribers         []subscriber    // notified of each data change
+    lastSubscriber      int             // last subscriber identifier
     notifyLenChange     func( l int64 )
     notifyUndoRedo      func( u, r bool )
-
-    lost                bool            // true if full undo history is unknown
+    notifyReadError     func( err error )
+    readErrorNotified   bool            // only the first error is notified
 }
 
 // internal debug functions
 func (s *Storage) print(  ) {
-    fmt.Printf("Storage %v\n", s.curData )
+    fmt.Printf("Storage %v\n", s.GetData( 0, s.length ) )
 }
 
 func (s *Storage) printInternal( ) {
-    fmt.Printf( "newData storage %v\n", s.newData )
-    fmt.Printf( "cutData storage %v\n", s.cutData )
+    fmt.Printf( "addData storage %v\n", s.addData )
+    fmt.Printf( "pieces (length %d):\n", s.length )
+    for i, p := range s.pieces {
+        fmt.Printf( "  @%d source %d, start %d, length %d\n",
+                    i, p.source, p.start, p.length )
+    }
 }
 
-func (s *Storage) printStack( ) {
-    fmt.Printf( "Stack length %d, top=%d\n", len(s.stack), s.top )
-    for i, op := range s.stack {
-        if i == s.top {
-            fmt.Printf( "  ------------------------------------\n" )
-        }
-
-        switch op := op.(type) {
-        case singlePosOp:
-            fmt.Printf( "  @%d tag %d, delLen %d, insLen %d, back %d, cut %d, nPos %d pos[0] %d\n",
-                        i, op.tag, op.delLen, op.insLen, op.backup, op.cut,
-                        1, op.position )
-        case multiPosOp:
-            fmt.Printf( "  @%d tag %d, delLen %d, insLen %d, back %d, cut %d, nPos %d pos[0] %d\n",
-                        i, op.tag, op.delLen, op.insLen, op.backup, op.cut,
-                        len(op.positions), op.positions[0] )
-        }
+func (s *Storage) printTree( ) {
+    fmt.Printf( "Tree size %d, current=%d, saved=%d\n",
+                len(s.tree), s.current, s.saved )
+    for i, node := range s.tree {
+        fmt.Printf( "  @%d parent %d, children %v, redo %d, op %T\n",
+                    i, node.parent, node.children, node.redo, node.op )
     }
 }
 
 // return current storage length.
 func (s *Storage) Length() int64 {
-    return int64(len(s.curData))
+    return s.length
 }
 
-// return whether storage is presumed modified since creation/reload.
+// return whether storage is modified since creation/reload/save, that is
+// whether the current state is not the state last loaded or saved.
 func (s *Storage)IsDirty( ) bool {
-    if s.lost {
-        return true
-    }
-    return s.top > 0
+    return s.current != s.saved
 }
 
 // attach a notification triggered each time the storage length changes.
@@ -107,304 +157,566 @@ func (s *Storage) SetNotifyUndoRedoAble( f func( u, r bool ) ) {
     s.notifyUndoRedo = f
 }
 
-// attach a notification triggered each time data changes in storage.
-func (s *Storage) SetNotifyDataChange( f func() ) {
-    s.notifyDataChange = f
+// attach a notification triggered the first time GetData cannot read the file,
+// since GetData does not return the error. Later errors are not notified until
+// the file is reloaded.
+func (s *Storage) SetNotifyReadError( f func( err error ) ) {
+    s.notifyReadError = f
+}
+
+
+// return the index of the piece containing the byte at position pos, and the
+// offset of that byte within the piece. If pos is the current data length,
+// the returned index is the number of pieces and the returned offset is 0.
+func (s *Storage) locate( pos int64 ) (index int, offset int64) {
+    for i, p := range s.pieces {
+        if pos < p.length {
+            return i, pos
+        }
+        pos -= p.length
+    }
+    return len(s.pieces), pos
+}
+
+// append piece p to the list of pieces, merging it with the last piece in the
+// list if both refer to contiguous segments in the same source.
+func appendPiece( pieces []piece, p piece ) []piece {
+    if p.length == 0 {
+        return pieces
+    }
+    if n := len(pieces); n > 0 {
+        last := &pieces[n-1]
+        if last.source == p.source &&
+           (p.source == zeros || last.start + last.length == p.start) {
+            last.length += p.length
+            return pieces
+        }
+    }
+    return append( pieces, p )
+}
+
+// append the pieces describing the current data in [start:beyond[ to the
+// list of pieces, each piece trimmed to fit exactly in that segment.
+func (s *Storage) appendPieces( pieces []piece, start, beyond int64 ) []piece {
+    if start >= beyond {
+        return pieces
+    }
+    i, off := s.locate( start )
+    for l := beyond - start; l > 0; i++ {
+        p := s.pieces[i]
+        p.start += off
+        p.length -= off
+        off = 0
+        if p.length > l {
+            p.length = l
+        }
+        pieces = appendPiece( pieces, p )
+        l -= p.length
+    }
+    return pieces
+}
+
+func piecesLength( pieces []piece ) (l int64) {
+    for _, p := range pieces {
+        l += p.length
+    }
+    return
+}
+
+// return the data bytes a piece refers to. In case of original or added data
+// the returned slice is shallow: it must NOT be modified. An error is returned
+// if the original data cannot be read from the file.
+func (s *Storage) getPieceData( p piece ) ([]byte, error) {
+    switch p.source {
+    case original:
+        return s.org.getData( p.start, p.start+p.length )
+    case added:
+        return s.addData[p.start:p.start+p.length:p.start+p.length], nil
+    case zeros:
+        return make( []byte, p.length ), nil
+    }
+    log.Panicln( "getPieceData: unknown piece source" )
+    return nil, nil
+}
+
+// same as getPieceData, except that in case of error zeros are returned in
+// place of the data and the error is notified if it is the first one.
+func (s *Storage) getPieceDataOrZeros( p piece ) []byte {
+    data, err := s.getPieceData( p )
+    if err != nil {
+        if s.notifyReadError != nil && ! s.readErrorNotified {
+            s.readErrorNotified = true
+            s.notifyReadError( err )
+        }
+        data = make( []byte, p.length )
+    }
+    return data
+}
+
+// append data to the add buffer and return the pieces refering to it.
+func (s *Storage) addBytes( data []byte ) []piece {
+    start := int64(len(s.addData))
+    s.addData = append( s.addData, data... )
+    return appendPiece( nil, piece{ added, start, int64(len(data)) } )
+}
+
+// append the clipboard content to the add buffer and return the pieces
+// refering to it.
+func (s *Storage) addClipboard( ) []piece {
+    start := int64(len(s.addData))
+    il := s.clip.Size()
+    for i := int64(0); i < il; i++ {
+        s.addData = append( s.addData, s.clip.Get( ) )
+    }
+    return appendPiece( nil, piece{ added, start, il } )
 }
 
-// GetData returns the current storage content.
-// Beware, it is only a shallow copy: do NOT MODIFY the returned data
+// GetData returns the current storage content between start and beyond.
+// Beware, it may be only a shallow copy: do NOT MODIFY the returned data.
+// Bytes that cannot be read from the file are returned as zeros, and the error
+// is given to the function attached with SetNotifyReadError. Use ReadAt to get
+// the error instead.
 func (s *Storage) GetData( start, beyond int64 ) []byte {
-    if start < 0 || start > beyond || beyond > int64(len(s.curData)) {
+    if start < 0 || start > beyond || beyond > s.length {
         return nil
     }
-    return s.curData[start:beyond]
+    pieces := s.appendPieces( nil, start, beyond )
+    if len(pieces) == 1 {
+        return s.getPieceDataOrZeros( pieces[0] )
+    }
+    data := make( []byte, 0, beyond - start )
+    for _, p := range pieces {
+        data = append( data, s.getPieceDataOrZeros( p )... )
+    }
+    return data
+}
+
+// ReadAt implements the io.ReaderAt interface: it reads len(p) bytes into p
+// starting at offset off in the current storage content. It returns the number
+// of bytes read and io.EOF if fewer than len(p) bytes were available, or the
+// error that prevented reading the file. Unlike GetData, the returned data is
+// a copy that is not affected by later edits.
+func (s *Storage) ReadAt( p []byte, off int64 ) (n int, err error) {
+    if off < 0 {
+        return 0, fmt.Errorf( "ReadAt: negative offset\n" )
+    }
+    if off >= s.length {
+        return 0, io.EOF
+    }
+    beyond := off + int64(len(p))
+    if beyond > s.length {
+        beyond = s.length
+        err = io.EOF
+    }
+    for _, pi := range s.appendPieces( nil, off, beyond ) {
+        for pi.length > 0 {     // limit pieces to pages if read on demand
+            chunk := pi
+            if chunk.length > filePageSize {
+                chunk.length = filePageSize
+            }
+            data, rErr := s.getPieceData( chunk )
+            if rErr != nil {
+                return n, rErr
+            }
+            n += copy( p[n:], data )
+            pi.start += chunk.length
+            pi.length -= chunk.length
+        }
+    }
+    return
+}
+
+// WriteTo implements the io.WriterTo interface: it writes the whole current
+// storage content to w, without ever making a copy of the whole content. It
+// returns the number of bytes written and any error encountered.
+func (s *Storage) WriteTo( w io.Writer ) (n int64, err error) {
+    for _, pi := range s.pieces {
+        for pi.length > 0 {     // limit pieces to pages if read on demand
+            chunk := pi
+            if chunk.length > filePageSize {
+                chunk.length = filePageSize
+            }
+            var data []byte
+            if data, err = s.getPieceData( chunk ); err != nil {
+                return
+            }
+            var wl int
+            wl, err = w.Write( data )
+            n += int64(wl)
+            if err != nil {
+                return
+            }
+            pi.start += chunk.length
+            pi.length -= chunk.length
+        }
+    }
+    return
+}
+
+// NewSectionReader returns an io.SectionReader that reads the current storage
+// content from the position given by start, for the number of bytes given by
+// length. The section reader reads the storage content at the time each read
+// happens, and is therefore affected by edits made while reading.
+func (s *Storage) NewSectionReader( start, length int64 ) *io.SectionReader {
+    return io.NewSectionReader( s, start, length )
 }
 
 // NewStorage creates and initializes a storage. The argument path is a
 // path to a file containing data bytes to edit. The argument clip is the
 // clipboard interface to use when cutting, copying or pasting. In case path
 // is empty, an initially empty storage is returned. An error is returned if
-// the file corresponding to the path cannot be read, otherwise the whole
-// file is read in memory, and the new storage is returned.
+// the file corresponding to the path cannot be read, otherwise the new storage
+// is returned. If the file is small enough, it is read entirely in memory,
+// otherwise it is kept open and read on demand, in which case Close must be
+// called when the storage is not needed anymore.
 func NewStorage( path string, clip Clipboard ) ( *Storage, error ) {
 
-    var initialData []byte
-    var err error
-
-    if path == "" {
-        initialData = make( []byte, 0, defFileSize )
-    } else {
-        initialData, err = os.ReadFile( path )
+    var result Storage
+    if path != "" {
+        org, info, err := openOrigin( path )
         if err != nil {
             return nil, err
         }
+        result.setOrigin( org, info )
     }
-
-    var result Storage
-    result.stack = make( []interface{}, 0, defUndoSize )
-    result.curData = initialData
+    result.addData = make( []byte, 0, defAddSize )
+    result.resetTree( )
     result.clip = clip
     return &result, nil
 }
 
+func (s *Storage) setOrigin( org origin, info os.FileInfo ) {
+    s.org = org
+    s.length = org.size()
+    s.pieces = appendPiece( nil, piece{ original, 0, s.length } )
+    s.fileInfo = info
+    s.written = nil
+    s.rewritten = false
+    s.setBase( )
+}
+
+// Close releases the file that may be kept open for reading data on demand,
+// and stops recording the undo journal if any (the journal is kept so that the
+// undo/redo tree can be restored later). The storage must not be used after
+// Close has been called.
+func (s *Storage) Close( ) (err error) {
+    s.closeJournal( false )
+    if s.org != nil {
+        err = s.org.close()
+        s.org = nil
+    }
+    s.pieces = nil
+    s.length = 0
+    return
+}
+
 // Reload performs storage re-initialization. It is used for example when
 // reverting to the original data file. The original path must be provided.
 // An error is returned if the file corresponding to the path cannot be read.
+// The undo journal, if any, is restarted with an empty history.
 func (s *Storage)Reload( path string ) error {
-    // check if file can still be opened
-    _, err := os.Open( path )
+    org, info, err := openOrigin( path )
     if err != nil {
         return err
     }
-    // Assume everything will be OK
-    s.curData = nil
-    s.newData = nil
-    s.cutData = nil
-    s.stack = make( []interface{}, 0, defUndoSize )
-    s.top = 0
-    s.lost = false
-    if s.curData, err = os.ReadFile( path ); err == nil {
-        if s.notifyDataChange != nil {
-            s.notifyDataChange()
-        }
-        if s.notifyUndoRedo != nil {
-            s.notifyUndoRedo( s.top > 0, true )
-        }
-        if s.notifyLenChange != nil {
-            s.notifyLenChange( int64(len(s.curData)) )
-        }
+    if s.org != nil {
+        s.org.close()
+    }
+    curLen := s.length
+    s.org = nil
+    s.addData = make( []byte, 0, defAddSize )
+    s.pieces = nil
+    s.length = 0
+    s.resetTree( )
+    s.groups = nil
+    s.readErrorNotified = false
+    s.setOrigin( org, info )
+    if s.journal != nil {
+        s.restartJournal( path )
+    }
+    s.notifyDataChange( Change{ 0, curLen, s.length, RELOAD } )
+    if s.notifyUndoRedo != nil {
+        s.notifyUndoRedo( false, false )
+    }
+    if s.notifyLenChange != nil {
+        s.notifyLenChange( s.length )
     }
-    return err
+    return nil
 }
 
-// The undo redo stack is a slice of previous commands.
-// The oldest command that can be undone is at the bottom of the stack (0)
-// The latest command that can be undone is immediately below the top of the
-// stack (top-1)
+// The undo redo tree is a slice of nodes, each node giving the operation that
+// led to that state from its parent node. The initial state is the root of the
+// tree (0), which has no operation and no parent. The current state is given
+// by the current node.
 //
-// Undo just decrements top, takes the command at top, undo it (insert > delete,
-// delete > insert saved and replace > opposite replace), but leaves the undone
-// command in the slice (now at top+1). Undo works until top is 0.
+// Undo reverts the operation of the current node, by reverting its piece swap,
+// and makes the parent node current. It works until the current node is 0.
 //
-// Redo just looks at the command at top, if it exists in the slice. It then
-// re-executes the command and increments top, It works until top reaches the
-// length of the slice.
-
-// Undo the command just below the top of the undo/redo stack.
-// Undo reverses DELETE by executing INSERT with the saved data; it reverses
-// INSERT by executing DELETE at the position and with the length of the
-// inserted data. REPLACE, which is a combination of DELETE and INSERT is
-// reversed similarly. In all cases, undo does not push the command and does
-// not save the restored data again, since the command slice, backup and cut
-// storages are still valid: the top of the stack is just decremented.
+// Redo performs again the operation of one of the current node children, by
+// performing its piece swap again, and makes that child current. Since a new
+// operation done after undoing is added as a new child, a node may have
+// several children (branches): redo follows the branch that was last undone
+// or last created, unless another branch is explicitly selected. Nothing is
+// ever removed from the tree, so that all states remain reachable.
 
 // Undo undo the last operation done on the storage. The position and tag
 // provided when the operation was requested are returned to the caller.
-// An error is returned if no operation can be undone.
+// An error is returned if no operation can be undone. Consecutive operations
+// on one or two bytes at contiguous positions, as when typing, are coalesced
+// in a single run, undone at once, unless the run was closed by CloseRun or by
+// a pause. In that case the position and tag of the first operation in the run
+// are returned (and those of the last operation when redoing the run).
 func (s *Storage) Undo( ) (pos, tag int64, err error) {
-    if s.top <= 0 {
-        err = fmt.Errorf( "undo stack empty\n" )
+    if len( s.groups ) > 0 {
+        err = fmt.Errorf( "undo not possible within a group\n" )
         return
     }
-
-    s.top --                // pop undo stack (and push into redo stack)
+    if s.current == 0 {
+        err = fmt.Errorf( "nothing to undo\n" )
+        return
+    }
+    s.CloseRun( )
+    curLen, from := s.length, s.current
+    pos, tag, c := s.undoStep( )
+    s.recordMove( from )
 
     if s.notifyUndoRedo != nil {
-        s.notifyUndoRedo( s.top > 0, true )
+        s.notifyUndoRedo( s.AreUndoRedoPossible() )
     }
+    c.Kind = UNDO
+    s.notifySwap( curLen, c )
+    return
+}
 
-    op := s.stack[s.top]
+// revert the operation of the current node, without notification, and make
+// its parent the current node, remembering the branch to follow when redoing.
+// The data change is returned with the operation position and tag.
+func (s *Storage) undoStep( ) (pos, tag int64, c Change) {
+    node := s.tree[s.current]
+    parent := &s.tree[node.parent]
+    for i, child := range parent.children {
+        if child == s.current {
+            parent.redo = i
+            break
+        }
+    }
+    s.current = node.parent
+    pos, tag = s.undoOp( node.op )
+    return pos, tag, opChange( node.op ).reverse()
+}
+
+// perform again the operation of the current node child selected for redoing,
+// without notification, and make that child the current node. The data change
+// is returned with the operation position and tag.
+func (s *Storage) redoStep( ) (pos, tag int64, c Change) {
+    node := s.tree[s.current]
+    s.current = node.children[node.redo]
+    op := s.tree[s.current].op
+    pos, tag = s.redoOp( op )
+    return pos, tag, opChange( op )
+}
+
+// revert the piece swap(s) made by the operation op, without notification,
+// and return the operation position and tag.
+func (s *Storage) undoOp( op interface{} ) (pos, tag int64) {
     switch op := op.(type) {
     case singlePosOp:
-        tag = op.tag
-        pos = op.position
-        c := op.cut
-        s.replaceInCurDataNotify( pos, tag, op.insLen,
-                                  s.cutData[c:c+op.delLen] )
+        s.swapPieces( op.swap.index, op.swap.after, op.swap.before )
+        return op.position, op.tag
     case multiPosOp:
-        tag = op.tag
-        pos = op.positions[0]
-        c := op.cut
-        s.replaceInCurDataAtMultipleLocations( op.positions, tag, op.insLen,
-                                               s.cutData[c:c+op.delLen], false )
+        s.swapPieces( op.swap.index, op.swap.after, op.swap.before )
+        return op.positions[0], op.tag
+    case groupOp:
+        for i := len(op.ops) - 1; i >= 0; i-- {
+            s.undoOp( op.ops[i] )
+        }
+        return op.position, op.tag
+    case runOp:     // back to where the run started
+        for i := len(op.ops) - 1; i >= 1; i-- {
+            s.undoOp( op.ops[i] )
+        }
+        return s.undoOp( op.ops[0] )
     }
+    log.Panicf( "undoOp: unknown operation %T\n", op )
     return
 }
 
-// redo the command et the top of the undo/redo stack.
-// if top is the length of the slice, no command can be redone.
-// Otherwise, redo takes the command at top. increments top, and re-executes
-// the command as if it was requested again. Redo does not push the command
-// and does not save the restored data again, since the command slice, backup
-// and cut storages are still valid: the top of the stack is just incremented.
+// perform again the piece swap(s) made by the operation op, without
+// notification, and return the operation position and tag.
+func (s *Storage) redoOp( op interface{} ) (pos, tag int64) {
+    switch op := op.(type) {
+    case singlePosOp:
+        s.swapPieces( op.swap.index, op.swap.before, op.swap.after )
+        return op.position, op.tag
+    case multiPosOp:
+        s.swapPieces( op.swap.index, op.swap.before, op.swap.after )
+        return op.positions[0], op.tag
+    case groupOp:
+        for _, sub := range op.ops {
+            s.redoOp( sub )
+        }
+        return op.position, op.tag
+    case runOp:     // up to where the run ended
+        last := len(op.ops) - 1
+        for _, sub := range op.ops[:last] {
+            s.redoOp( sub )
+        }
+        return s.redoOp( op.ops[last] )
+    }
+    log.Panicf( "redoOp: unknown operation %T\n", op )
+    return
+}
 
-// Redo does again the last undone operation. The position and tag provided
-// when the operation was initially requested are returned to the caller.
-// An error is returned if no operation can be redone.
+// Redo does again the last undone operation, or the operation in the branch
+// selected by SelectBranch. The position and tag provided when the operation
+// was initially requested are returned to the caller. An error is returned if
+// no operation can be redone.
 func (s *Storage) Redo( ) (pos, tag int64, err error) {
-
-    if s.top >= len( s.stack ) {
-        err = fmt.Errorf( "redo stack empty\n" )
+    if len( s.groups ) > 0 {
+        err = fmt.Errorf( "redo not possible within a group\n" )
         return
     }
-    op := s.stack[s.top]
-    s.top ++                // pop redo stack (and push into undo stack)
-
-    if s.notifyUndoRedo != nil {
-        s.notifyUndoRedo( true, s.top < len( s.stack) )
+    if len( s.tree[s.current].children ) == 0 {
+        err = fmt.Errorf( "nothing to redo\n" )
+        return
     }
+    s.CloseRun( )
+    curLen, from := s.length, s.current
+    pos, tag, c := s.redoStep( )
+    s.recordMove( from )
 
-    switch op := op.(type) {
-    case singlePosOp:
-        tag = op.tag
-        pos = op.position
-        b := op.backup
-        s.replaceInCurDataNotify( op.position, op.tag, op.delLen,
-                                  s.newData[b:b+op.insLen] )
-    case multiPosOp:
-        tag = op.tag
-        pos = op.positions[0]
-        b := op.backup
-        s.replaceInCurDataAtMultipleLocations( op.positions, op.tag, op.delLen,
-                                               s.newData[b:b+op.insLen], true )
+    if s.notifyUndoRedo != nil {
+        s.notifyUndoRedo( s.AreUndoRedoPossible() )
     }
+    c.Kind = REDO
+    s.notifySwap( curLen, c )
     return
 }
 
 // Checks whether Undo and/or Redo are possible and return a tuple (undo, redo)
 // indicating the state of each.
 func (s *Storage) AreUndoRedoPossible( ) (u, r bool) {
-    if s.top < len( s.stack ) {
+    if len( s.tree[s.current].children ) > 0 {
         r = true
     }
-    if s.top > 0 {
+    if s.current > 0 {
         u = true
     }
     return
 }
 
-// push operation position(s), caller tag, deleted and inserted lengths onto the
-// undo/redo stack. Usually this means just appending an operation to the stack,
-// but if operations were previously undone, the top of the stack is not at the
-// end of the slice anymore. In that case, all operations that could be redone
-// until now are just removed from the slice and the backup (newData) and cut
-// (cutData) storage are cleaned: afterwards, previously saved data for redo are
-// forgotten and it is impossible to redo those operations.
-// Because it might change newData and/or cutData length, pushOp must be called
-// before updating newData or cutData (see insertInCurData and cutInCurData).
-func (s *Storage) pushSinglePosOp( p, t, dl, il int64 ) {
-    s.cleanStack()
-    s.stack = append( s.stack, singlePosOp{ t, dl, il,
-                                            int64(len(s.newData)),
-                                            int64(len(s.cutData)), p } )
-    s.top ++
-    if s.top < len( s.stack ) {
-        log.Panicln( "pushSinglePosOp not at top of stack" )
-    }
-    s.notifyUndoRedo( true, false )
-}
-
-func (s *Storage) pushMultiPosOp( p []int64, t, dl, il int64 ) {
-    s.cleanStack()
-    s.stack = append( s.stack, multiPosOp{ t, dl, il,
-                                            int64(len(s.newData)),
-                                            int64(len(s.cutData)), p } )
-    s.top ++
-    s.notifyUndoRedo( true, /*s.top < len( s.stack)*/ false )
-}
-
-func (s *Storage) cleanStack( ) {
-    if s.top < len( s.stack ) {
-        for i := len( s.stack)-1; i >= s.top; i-- {
-            op := s.stack[i]
-
-            var b, c int64
-            switch op := op.(type) {
-            case singlePosOp:
-                b, c = op.backup, op.cut
-            case multiPosOp:
-                b, c = op.backup, op.cut
-            }
-            // REPLACE, or INSERT (no cut data) or DELETE (no new data)
-            if int64(len(s.newData)) < b {
-                log.Panicln( "push: newData inconsistent" );
-            }
-            if int64(len(s.cutData)) < c {
-                log.Panicln( "push: cutData inconsistent" );
-            }
-            s.newData = s.newData[:b]
-            s.cutData = s.cutData[:c]
-            s.lost = true
-        }
-        s.stack = s.stack[:s.top]
+// add a node with the operation op as a new child of the current node, and
+// make it the current node. The new child is the branch followed by redo.
+func (s *Storage) addNode( op interface{} ) {
+    id := len( s.tree )
+    s.tree = append( s.tree, undoNode{ op, s.current, nil, 0 } )
+    parent := &s.tree[s.current]
+    parent.children = append( parent.children, id )
+    parent.redo = len( parent.children ) - 1
+    if s.journal != nil {
+        s.journal.mapNode( id, s.current )
     }
+    s.current = id
 }
 
-// insert data bytes at position pos in main storage.
-// if save is true, push the INSERT command onto the undo/redo stack and
-//                  save the inserted data bytes into the backup storage.
-func (s *Storage) insertInCurData( pos, tag int64, data []byte, save bool ) error {
-    cl := int64(len(s.curData))
-    if cl < pos || pos < 0 {
-        return fmt.Errorf("INSERT outside data boundaries\n")
+// push operation position(s), caller tag, deleted and inserted lengths and
+// piece swap onto the undo/redo tree, as a new child of the current node. If
+// operations were previously undone, the new operation starts a new branch:
+// the operations that could be redone until now are kept in their own branch.
+// The data change made by the operation is returned.
+func (s *Storage) pushSinglePosOp( p, t, dl, il int64, swap pieceSwap ) Change {
+    return s.pushOp( singlePosOp{ t, dl, il, p, swap } )
+}
+
+func (s *Storage) pushMultiPosOp( p []int64, t int64, dl, il []int64,
+                                  swap pieceSwap ) Change {
+    return s.pushOp( multiPosOp{ t, p, dl, il, swap } )
+}
+
+func (s *Storage) pushOp( op interface{} ) Change {
+    s.addNode( op )
+    s.recordOp( op )
+    s.extendRun( op )
+    if s.notifyUndoRedo != nil {
+        s.notifyUndoRedo( true, false )
     }
-    il := int64(len(data))
-    if save {
-        s.pushSinglePosOp( pos, tag, 0, il )           // no byte deleted, il inserted
-        s.newData = append( s.newData, data... )
-    }
-    if cl == pos {   // just append bytes
-        s.curData = append( s.curData, data... )
-    } else {
-        if pos + il > cl {
-            //          +++++++++xx  data
-            //          0         il
-            // =========:::::::::  s.curData
-            //         pos      cl
-
-            // =========:::::::::xx
-            //         pos     cl pos+il
-            s.curData = append( s.curData, data[cl - pos:]... )
-
-            // =========:::::::::xx:::::::::
-            //         pos     cl        cl+il
-            s.curData = append( s.curData, s.curData[pos:cl]... )
-
-            //          +++++++++xx  data
-            // =========+++++++++xx:::::::::
-            //         pos     cl pos+il
-            copy( s.curData[pos:], data[:cl-pos] )
-        } else {
-            //          ++++++  data
-            //          0    il
-            // =========::xxxxxx  s.curData
-            //         pos     cl
-
-            // =========::xxxxxxxxxxxx
-            s.curData = append( s.curData, s.curData[cl-il:]...)
-
-            //          ++++++  data
-            //          0    il
-            // =========::xxxxxxxxxxxx
-            //         pos     cl
-
-            // =========::xxxx::xxxxxx
-            copy( s.curData[pos+il:cl], s.curData[pos:] )     
-
-            // =========++++++::xxxxxx
-            copy( s.curData[pos:], data )
-        }
+    return opChange( op )
+}
+
+// make the piece swap that replaces dl[i] bytes at each position pos[i] with
+// the pieces ins[i]. Positions must be given in increasing order and replaced
+// segments must not overlap. The swap starts one piece before the first
+// position if that position is at a piece boundary, in order to merge
+// contiguous pieces (as when typing bytes one by one).
+func (s *Storage) makeSwap( pos, dl []int64, ins [][]piece ) pieceSwap {
+    first, fOff := s.locate( pos[0] )
+    if fOff == 0 && first > 0 {
+        first --
+        fOff = s.pieces[first].length
     }
-    if il != int64(len( s.curData )) - cl {
-        log.Panicln("INSERT: Wrong length after insertion")
+    end := pos[len(pos)-1] + dl[len(pos)-1]
+    beyond, bOff := s.locate( end )
+    if bOff > 0 {           // end is inside piece beyond, keep its remainder
+        end += s.pieces[beyond].length - bOff
+        beyond ++
     }
-    if s.notifyLenChange != nil {
-        s.notifyLenChange( s.Length())
+
+    after := s.appendPieces( nil, pos[0] - fOff, pos[0] )
+    for i, p := range pos {
+        for _, ip := range ins[i] {
+            after = appendPiece( after, ip )
+        }
+        next := end
+        if i < len(pos) - 1 {
+            next = pos[i+1]
+        }
+        after = s.appendPieces( after, p + dl[i], next )
+    }
+    before := make( []piece, beyond - first )
+    copy( before, s.pieces[first:beyond] )
+    return pieceSwap{ first, before, after }
+}
+
+// remove the pieces given by the argument remove, starting at index in the
+// piece list, and insert the pieces given by the argument insert instead.
+func (s *Storage) swapPieces( index int, remove, insert []piece ) {
+    tail := make( []piece, len(s.pieces) - index - len(remove) )
+    copy( tail, s.pieces[index+len(remove):] )
+    s.pieces = append( append( s.pieces[:index], insert... ), tail... )
+    s.length += piecesLength( insert ) - piecesLength( remove )
+    s.modifiedValid = false
+}
+
+func (s *Storage) swapPiecesNotify( index int, remove, insert []piece,
+                                     c Change ) {
+    curLen := s.length
+    s.swapPieces( index, remove, insert )
+    s.notifySwap( curLen, c )
+}
+
+// notify the data change c, and length change if the length before swapping
+// pieces, given by curLen, is different from the current length.
+func (s *Storage) notifySwap( curLen int64, c Change ) {
+    if curLen != s.length && s.notifyLenChange != nil {
+        s.notifyLenChange( s.length )
     }
-    if s.notifyDataChange != nil {
-        s.notifyDataChange()
+    s.notifyDataChange( c )
+}
+
+// replace dl bytes at position pos with the pieces ins, after pushing the
+// command onto the undo/redo tree.
+func (s *Storage) replacePiecesNotifySave( pos, tag, dl int64, ins []piece ) {
+    swap := s.makeSwap( []int64{ pos }, []int64{ dl }, [][]piece{ ins } )
+    c := s.pushSinglePosOp( pos, tag, dl, piecesLength( ins ), swap )
+    s.swapPiecesNotify( swap.index, swap.before, swap.after, c )
+}
+
+// insert data bytes at position pos in main storage.
+func (s *Storage) insertInCurData( pos, tag int64, data []byte ) error {
+    if s.length < pos || pos < 0 {
+        return fmt.Errorf("INSERT outside data boundaries\n")
     }
+    s.replacePiecesNotifySave( pos, tag, 0, s.addBytes( data ) )
     return nil
 }
 
@@ -413,65 +725,10 @@ func (s *Storage) insertInCurData( pos, tag int64, data []byte, save bool ) erro
 // and returned when undoing or redoing the operation. An error is returned if
 // the position is out of storage.
 func (s *Storage) InsertClipboardAt( pos, tag int64 ) error {
-    cl := int64(len(s.curData))
-    if cl < pos || pos < 0 {
+    if s.length < pos || pos < 0 {
         return fmt.Errorf("INSERT outside data boundaries\n")
     }
-    il := s.clip.Size()
-    s.pushSinglePosOp( pos, tag, 0, il )           // no byte deleted, il inserted
-    nPos := int64(len(s.newData))
-    for i:= int64(0); i < il; i++ {
-        s.newData = append( s.newData, s.clip.Get( ) )
-    }
-    // newData[nPos:nPos+il] now contains the data to insert
-    if cl == pos {   // just append bytes
-        s.curData = append( s.curData, s.newData[nPos:]... )
-    } else {
-        if pos + il > cl {
-            //          +++++++++xx  data
-            //        nPos     nPos+il
-            // =========:::::::::  s.curData
-            //         pos      cl
-
-            // =========:::::::::xx
-            //         pos     cl pos+il
-            s.curData = append( s.curData, s.newData[nPos+(cl-pos):]... )
-
-            // =========:::::::::xx:::::::::
-            //         pos     cl        cl+il
-            s.curData = append( s.curData, s.curData[pos:cl]... )
-
-            //          +++++++++xx  data
-            // =========+++++++++xx:::::::::
-            //         pos     cl pos+il
-            copy( s.curData[pos:], s.newData[nPos:nPos+(cl-pos)] )
-        } else {
-            //          ++++++  data
-            //          0    il
-            // =========::xxxxxx  s.curData
-            //         pos     cl
-
-            // =========::xxxxxxxxxxxx
-            s.curData = append( s.curData, s.curData[cl-il:]...)
-
-            //          ++++++  data
-            //          0    il
-            // =========::xxxxxxxxxxxx
-            //         pos     cl
-
-            // =========::xxxx::xxxxxx
-            copy( s.curData[pos+il:cl], s.curData[pos:] )     
-
-            // =========++++++::xxxxxx
-            copy( s.curData[pos:], s.newData[nPos:] )
-        }
-    }
-    if s.notifyLenChange != nil {
-        s.notifyLenChange( s.Length())
-    }
-    if s.notifyDataChange != nil {
-        s.notifyDataChange()
-    }
+    s.replacePiecesNotifySave( pos, tag, 0, s.addClipboard( ) )
     return nil
 }
 
@@ -480,7 +737,7 @@ func (s *Storage) InsertClipboardAt( pos, tag int64 ) error {
 // or redoing the operation. The argument b is the byte to insert. An error is
 // returned if the position is out of storage.
 func (s *Storage) InsertByteAt( pos, tag int64, b byte ) error {
-    return s.insertInCurData( pos, tag, []byte{ b }, true )
+    return s.insertInCurData( pos, tag, []byte{ b } )
 }
 
 // InsertBytesAt inserts multiple bytes in the storage at position given by the
@@ -488,34 +745,15 @@ func (s *Storage) InsertByteAt( pos, tag int64, b byte ) error {
 // or redoing the operation. The argument b is the byte slice to insert. An
 // error is returned if the position is out of storage.
 func (s *Storage) InsertBytesAt( pos, tag int64, b []byte ) error {
-    return s.insertInCurData( pos, tag, b, true )
+    return s.insertInCurData( pos, tag, b )
 }
 
 // delete or cut data starting at pos, for the given length.
-// if save is true, push the DELETE command onto the undo/redo stack and
-//                  save the deleted data into the cut storage.
-func (s *Storage) cutInCurData( pos, tag, length int64, save bool ) error {
-    curLen := int64(len(s.curData))
-    if pos < 0 || length < 0 || (pos + length) > curLen {
+func (s *Storage) cutInCurData( pos, tag, length int64 ) error {
+    if pos < 0 || length < 0 || (pos + length) > s.length {
         return fmt.Errorf("DELETE outside data boundaries\n")
     }
-
-    if save {
-        s.pushSinglePosOp( pos, tag, length, 0 )   // length bytes removed, 0 inserted
-        s.cutData = append( s.cutData, s.curData[pos:pos+length]... )
-    }
-    if pos == curLen-length {
-        s.curData = s.curData[:pos]
-    } else {
-        copy( s.curData[pos:], s.curData[pos+length:] )
-        s.curData = s.curData[:curLen-length]
-    }
-    if s.notifyLenChange != nil {
-        s.notifyLenChange( s.Length())
-    }
-    if s.notifyDataChange != nil {
-        s.notifyDataChange()
-    }
+    s.replacePiecesNotifySave( pos, tag, length, nil )
     return nil
 }
 
@@ -524,7 +762,7 @@ func (s *Storage) cutInCurData( pos, tag, length int64, save bool ) error {
 // or redoing the operation. An error is returned if the position is out of
 // storage.
 func (s *Storage) DeleteByteAt( pos, tag int64 ) error {
-    return s.cutInCurData( pos, tag, 1, true )
+    return s.cutInCurData( pos, tag, 1 )
 }
 
 // DeleteBytesAt deletes multiple bytes in the storage at position given by the
@@ -533,18 +771,16 @@ func (s *Storage) DeleteByteAt( pos, tag int64 ) error {
 // undoing or redoing the operation. An error is returned if the segment to
 // delete does not fit in storage.
 func (s *Storage) DeleteBytesAt( pos, tag, n int64 ) error {
-    return s.cutInCurData( pos, tag, n, true )
+    return s.cutInCurData( pos, tag, n )
 }
 
 // save n bytes starting at position pos into the paste buffer
 // this is used for cut and copy
 func (s *Storage) saveClipboardData( pos, n int64 ) error {
-    if pos < 0 || pos + n > int64(len(s.curData)) {
+    if pos < 0 || n < 0 || pos + n > s.length {
         return fmt.Errorf("CUT/COPY outside data boundaries\n")
     }
-//    s.pasteData = s.pasteData[0:0]
-//    s.pasteData = append( s.pasteData, s.curData[pos:pos+n]... )
-    s.clip.Set( s.curData[pos:pos+n] )
+    s.clip.Set( s.GetData( pos, pos+n ) )
     return nil
 }
 
@@ -557,7 +793,7 @@ func (s *Storage) CutBytesAt( pos, tag, n int64 ) error {
     if err := s.saveClipboardData( pos, n ); err != nil {
         return err
     }
-    return s.cutInCurData( pos, tag, n, true )
+    return s.cutInCurData( pos, tag, n )
 }
 
 // CopyBytesAt implements a copy operation, from storage to the clipboard. It
@@ -570,80 +806,12 @@ func (s *Storage) CopyBytesAt( pos, n int64 ) error {
     return s.saveClipboardData( pos, n )
 }
 
-// replace existing data[pos:pos+dl] in the main buffer with new data.
-func (s *Storage) replaceInCurData( pos, tag, dl int64, data []byte ) {
-    curLen := int64(len(s.curData))
-    il := int64(len(data))
-
-    if il <= dl {
-        // replace first il bytes in [pos:pos+il]
-        copy( s.curData[pos:], data )
-        // move remaining bytes beyond pos+dl to pos+il        
-        copy( s.curData[pos+il:], s.curData[pos+dl:] )
-        // shrink the slice to pos+(il-dl)
-        s.curData = s.curData[:curLen-dl+il]
-    } else if pos + il > curLen {
-        // ==----xxxx  curData
-        //   ^   ^   ^
-        //  pos +dl curLen
-        //   ++++++++>>>>>>>  data
-        //   ^             ^
-        //   0             il
-
-        // ==----xxxx>>>>>>>
-        s.curData = append( s.curData, data[curLen-pos:]... )
-
-        // ==----xxxx>>>>>>>xxxx
-        s.curData = append( s.curData, s.curData[pos+dl:curLen]... )
-
-        // ==++++++++>>>>>>>xxxx
-        copy( s.curData[pos:], data[:curLen-pos] )
-    } else {
-        // ==--------xxxx=====::::  s.curData
-        //   ^       ^            ^
-        //  pos     +dl        curLen
-        //   ++++++++++++           data
-        //   ^           ^
-        //   0          il
-        //                        v
-        // ==--------xxxx=====::::::::  s.curData
-        s.curData = append( s.curData, s.curData[curLen-(il-dl):]... )
-
-        // ==--------xxxx=====::::::::  s.curData
-        // ==--------xxxxxxxx=====::::  s.curData
-        copy( s.curData[pos+il:curLen], s.curData[pos+dl:] )
-
-        // ==--------xxxxxxxx=====::::  s.curData
-        //   ++++++++++++
-        // ==++++++++++++xxxx=====::::
-        copy( s.curData[pos:], data )
-    }
-}
-
-func (s *Storage) replaceInCurDataNotify( pos, tag, dl int64, data []byte ) {
-
-    curLen := int64(len(s.curData))
-    s.replaceInCurData( pos, tag, dl, data )
-    if curLen != int64(len(s.curData)) && s.notifyLenChange != nil {
-        s.notifyLenChange( s.Length())
-    }
-    if s.notifyDataChange != nil {
-        s.notifyDataChange()
-    }
-}
-
 func (s *Storage) replaceInCurDataNotifySave( pos, tag, dl int64,
                                               data []byte ) error {
-    curLen := int64(len(s.curData))
-    if pos < 0 || dl < 0 || (pos + dl) > curLen {
+    if pos < 0 || dl < 0 || (pos + dl) > s.length {
         return fmt.Errorf("REPLACE outside data boundaries\n")
     }
-    il := int64(len(data))
-    s.pushSinglePosOp( pos, tag, dl, il )  // dl removed, il inserted
-
-    s.cutData = append( s.cutData, s.curData[pos:pos+dl]... )
-    s.newData = append( s.newData, data... )
-    s.replaceInCurDataNotify( pos, tag, dl, data )
+    s.replacePiecesNotifySave( pos, tag, dl, s.addBytes( data ) )
     return nil
 }
 
@@ -655,19 +823,10 @@ func (s *Storage) replaceInCurDataNotifySave( pos, tag, dl int64,
 // returned when undoing or redoing the operation. An error is returned if the
 // segment to replace does not fit in storage.
 func (s *Storage) ReplaceWithClipboardAt( pos, tag, dl int64 ) error {
-    curLen := int64(len(s.curData))
-    if pos < 0 || dl < 0 || (pos + dl) > curLen {
+    if pos < 0 || dl < 0 || (pos + dl) > s.length {
         return fmt.Errorf("REPLACE outside data boundaries\n")
     }
-    il := s.clip.Size()
-    s.pushSinglePosOp( pos, tag, dl, il )      // dl removed, il inserted
-
-    s.cutData = append( s.cutData, s.curData[pos:pos+dl]... )
-    nPos := int64(len(s.newData))
-    for i := int64(0); i < il; i++ {
-        s.newData = append( s.newData, s.clip.Get( ) )
-    }
-    s.replaceInCurDataNotify( pos, tag, dl, s.newData[nPos:] )
+    s.replacePiecesNotifySave( pos, tag, dl, s.addClipboard( ) )
     return nil
 }
 
@@ -694,53 +853,93 @@ func (s *Storage) ReplaceBytesAt( pos, tag, dl int64, b []byte ) error {
     return s.replaceInCurDataNotifySave( pos, tag, dl, b )
 }
 
-func (s *Storage) replaceInCurDataAtMultipleLocations( pos []int64,
-                                                       tag, l int64,
-                                                       v []byte,
-                                                       correct bool ) {
-    nl := int64(len(v))
-    nPos := len(pos)
-    for i := 0; i < nPos; i++ {
-        var p int64
-        if correct {            // correct for length difference
-            p = pos[i] + int64(i) * (nl - l)
-        } else {
-            p = pos[i]
-        }
-        s.replaceInCurData( p, 0, l, v )
-    }
-    if s.notifyDataChange != nil {
-        s.notifyDataChange()
-    }
-}
-
 // ReplaceBytesAtMultipleLocations replaces multiple bytes at multiple locations
 // given by a slice of positions. It has the same effect as repeating deleting
 // a segment of bytes in storage then inserting a new segment of bytes at the
 // same location, for each position in the slice. The argument pos is the slice
-// of position where replacement should happen. The argument dl indicates the
-// length of bytes to delete ar eacj position, and the argument b is the new
-// slice of data byte that should replace the deleted ones. When undoing or
-// redoing the operation the first position (that is pos[0]) and tag are
-// returned. An error is returned if any segment to replace does not fit in
-// storage and no replacement occurs.
+// of position where replacement should happen, in increasing order. The
+// argument dl indicates the length of bytes to delete ar eacj position, and
+// the argument b is the new slice of data byte that should replace the deleted
+// ones. When undoing or redoing the operation the first position (that is
+// pos[0]) and tag are returned. An error is returned if any segment to replace
+// does not fit in storage or overlaps the previous one, and no replacement
+// occurs.
 func (s *Storage) ReplaceBytesAtMultipleLocations( pos []int64, tag, dl int64,
                                                    b []byte ) error {
-    curLen := int64(len(s.curData))
-    for _, p := range pos {
-        if p < 0 || dl < 0 || p + dl > curLen {
+    dls := make( []int64, len(pos) )
+    for i := range dls {
+        dls[i] = dl
+    }
+    if err := s.checkSegments( pos, dls ); err != nil {
+        return err
+    }
+    ins := make( [][]piece, len(pos) )
+    added := s.addBytes( b )
+    for i := range ins {
+        ins[i] = added
+    }
+    s.replaceSegmentsNotifySave( pos, tag, dls, ins )
+    return nil
+}
+
+// ReplaceSegmentsAtMultipleLocations replaces segments of various lengths at
+// multiple locations with various data. It has the same effect as repeating
+// deleting a segment of bytes in storage then inserting a new segment of bytes
+// at the same location, for each position in the slice. The argument pos is
+// the slice of positions where replacement should happen, in increasing order.
+// For each position pos[i], the argument dl[i] indicates the length of bytes
+// to delete and the argument b[i] is the new slice of data bytes that should
+// replace the deleted ones. Undoing the operation restores all segments at
+// once. When undoing or redoing the operation the first position (that is
+// pos[0]) and tag are returned. An error is returned if the slices do not
+// have the same length, or if any segment to replace does not fit in storage
+// or overlaps the previous one, and no replacement occurs.
+func (s *Storage) ReplaceSegmentsAtMultipleLocations( pos []int64, tag int64,
+                                                      dl []int64,
+                                                      b [][]byte ) error {
+    if len(dl) != len(pos) || len(b) != len(pos) {
+        return fmt.Errorf("REPLACE with inconsistent segments\n")
+    }
+    if err := s.checkSegments( pos, dl ); err != nil {
+        return err
+    }
+    ins := make( [][]piece, len(pos) )
+    for i, data := range b {
+        ins[i] = s.addBytes( data )
+    }
+    s.replaceSegmentsNotifySave( pos, tag, dl, ins )
+    return nil
+}
+
+// check that the segments of length dl[i] at positions pos[i] fit in storage,
+// are in increasing order and do not overlap.
+func (s *Storage) checkSegments( pos, dl []int64 ) error {
+    if len(pos) == 0 {
+        return fmt.Errorf("REPLACE without location\n")
+    }
+    prev := int64(0)
+    for i, p := range pos {
+        if p < prev || dl[i] < 0 || p + dl[i] > s.length {
             return fmt.Errorf("REPLACE outside data boundaries\n")
         }
+        prev = p + dl[i]
     }
-    nl := int64(len(b))
-    s.pushMultiPosOp( pos, tag, dl, nl )
-    p := pos[0]
-    s.cutData = append( s.cutData, s.curData[p:p+dl]... )
-    s.newData = append( s.newData, b... )
-    s.replaceInCurDataAtMultipleLocations( pos, tag, dl, b, true )
     return nil
 }
 
+// replace dl[i] bytes at each position pos[i] with the pieces ins[i], after
+// pushing the command onto the undo/redo tree.
+func (s *Storage) replaceSegmentsNotifySave( pos []int64, tag int64,
+                                             dl []int64, ins [][]piece ) {
+    il := make( []int64, len(ins) )
+    for i, pieces := range ins {
+        il[i] = piecesLength( pieces )
+    }
+    swap := s.makeSwap( pos, dl, ins )
+    c := s.pushMultiPosOp( pos, tag, dl, il, swap )
+    s.swapPiecesNotify( swap.index, swap.before, swap.after, c )
+}
+
 // special operations to avoid creating extra slices when deleting bytes
 
 // ReplaceByteAtAndEraseFollowingBytes replaces the first byte in storage at
@@ -753,23 +952,10 @@ func (s *Storage) ReplaceBytesAtMultipleLocations( pos []int64, tag, dl int64,
 // storage.
 func (s *Storage) ReplaceByteAtAndEraseFollowingBytes( pos, tag int64, b byte,
                                                        n int64 ) error {
-    curLen := int64(len(s.curData))
-    if pos < 0 || n < 0 || (pos + n + 1) > curLen {
+    if pos < 0 || n < 0 || (pos + n + 1) > s.length {
         return fmt.Errorf("REPLACE outside data boundaries\n")
     }
-    il := int64(n+1)
-
-    s.pushSinglePosOp( pos, tag, il, il )          // il removed, il inserted
-    s.cutData = append( s.cutData, s.curData[pos:pos+il]... )
-    nPos := int64(len(s.newData))
-    s.newData = append( s.newData, b )
-
-    for i := int64(0); i < n; i++ {
-        s.newData = append( s.newData, 0 )
-    }
-    copy( s.curData[pos:pos+il], s.newData[nPos:nPos+il] )
-    if s.notifyDataChange != nil {
-        s.notifyDataChange()
-    }
+    ins := appendPiece( s.addBytes( []byte{ b } ), piece{ zeros, 0, n } )
+    s.replacePiecesNotifySave( pos, tag, n+1, ins )
     return nil
 }
@@ -0,0 +1,277 @@
+package edit
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// an editing step, with the expected data once done.
+type editStep struct {
+    name                string
+    do                  func( s *Storage ) error
+    want                string
+}
+
+// return a new storage loaded from a temporary file made of data, and the
+// path to that file.
+func newTestStorage( t *testing.T, data string ) (*Storage, string) {
+    t.Helper()
+    path := filepath.Join( t.TempDir(), "data" )
+    if err := os.WriteFile( path, []byte(data), 0600 ); err != nil {
+        t.Fatal( err )
+    }
+    s, err := NewStorage( path, nil )
+    if err != nil {
+        t.Fatal( err )
+    }
+    t.Cleanup( func( ) { s.Close() } )
+    return s, path
+}
+
+// check that the current data is want.
+func checkData( t *testing.T, s *Storage, want, when string ) {
+    t.Helper()
+    if s.Length() != int64(len(want)) {
+        t.Fatalf( "%s: length %d, want %d\n", when, s.Length(), len(want) )
+    }
+    if got := s.GetData( 0, s.Length() ); string(got) != want {
+        t.Fatalf( "%s: data %q, want %q\n", when, got, want )
+    }
+}
+
+// check that no piece is empty and that no piece could be merged with the
+// previous one.
+func checkPieces( t *testing.T, s *Storage, when string ) {
+    t.Helper()
+    var l int64
+    for i, p := range s.pieces {
+        if p.length <= 0 {
+            t.Fatalf( "%s: empty piece %d in %v\n", when, i, s.pieces )
+        }
+        if i > 0 && len( appendPiece( []piece{ s.pieces[i-1] }, p ) ) == 1 {
+            t.Fatalf( "%s: unmerged piece %d in %v\n", when, i, s.pieces )
+        }
+        l += p.length
+    }
+    if l != s.Length() {
+        t.Fatalf( "%s: pieces length %d, want %d\n", when, l, s.Length() )
+    }
+}
+
+// do all steps in order, then undo them all and redo them all, checking data
+// and pieces at each step.
+func runSteps( t *testing.T, s *Storage, initial string, steps []editStep ) {
+    t.Helper()
+    states := []string{ initial }
+    for _, step := range steps {
+        if err := step.do( s ); err != nil {
+            t.Fatalf( "%s: %v", step.name, err )
+        }
+        s.CloseRun( )
+        checkData( t, s, step.want, step.name )
+        checkPieces( t, s, step.name )
+        states = append( states, step.want )
+    }
+    for i := len(steps) - 1; i >= 0; i-- {
+        if _, _, err := s.Undo( ); err != nil {
+            t.Fatalf( "undo %s: %v", steps[i].name, err )
+        }
+        checkData( t, s, states[i], "undo " + steps[i].name )
+        checkPieces( t, s, "undo " + steps[i].name )
+    }
+    if _, _, err := s.Undo( ); err == nil {
+        t.Fatalf( "undo beyond initial state succeeded\n" )
+    }
+    for i, step := range steps {
+        if _, _, err := s.Redo( ); err != nil {
+            t.Fatalf( "redo %s: %v", step.name, err )
+        }
+        checkData( t, s, states[i+1], "redo " + step.name )
+        checkPieces( t, s, "redo " + step.name )
+    }
+    if _, _, err := s.Redo( ); err == nil {
+        t.Fatalf( "redo beyond last state succeeded\n" )
+    }
+}
+
+type testClipboard struct {
+    data                []byte
+    index               int
+}
+
+func (c *testClipboard) Size( ) int64 {
+    return int64(len(c.data))
+}
+
+func (c *testClipboard) Set( data []byte ) {
+    c.data = append( []byte(nil), data... )
+    c.index = 0
+}
+
+func (c *testClipboard) Get( ) byte {
+    b := c.data[c.index]
+    c.index = (c.index + 1) % len(c.data)
+    return b
+}
+
+func TestEditOperations( t *testing.T ) {
+    s, _ := newTestStorage( t, "0123456789" )
+    s.clip = &testClipboard{}
+    runSteps( t, s, "0123456789", []editStep{
+        { "insert at start", func( s *Storage ) error {
+            return s.InsertBytesAt( 0, 0, []byte("ab") )
+        }, "ab0123456789" },
+        { "insert at end", func( s *Storage ) error {
+            return s.InsertBytesAt( 12, 0, []byte("yz") )
+        }, "ab0123456789yz" },
+        { "insert inside", func( s *Storage ) error {
+            return s.InsertByteAt( 5, 0, '-' )
+        }, "ab012-3456789yz" },
+        { "delete across pieces", func( s *Storage ) error {
+            return s.DeleteBytesAt( 1, 0, 3 )
+        }, "a2-3456789yz" },
+        { "delete last byte", func( s *Storage ) error {
+            return s.DeleteByteAt( 11, 0 )
+        }, "a2-3456789y" },
+        { "replace longer", func( s *Storage ) error {
+            return s.ReplaceBytesAt( 3, 0, 1, []byte("+++") )
+        }, "a2-+++456789y" },
+        { "replace shorter", func( s *Storage ) error {
+            return s.ReplaceBytesAt( 0, 0, 6, []byte("A") )
+        }, "A456789y" },
+        { "replace byte", func( s *Storage ) error {
+            return s.ReplaceByteAt( 7, 0, 'Y' )
+        }, "A456789Y" },
+        { "replace and erase", func( s *Storage ) error {
+            return s.ReplaceByteAtAndEraseFollowingBytes( 1, 0, 'z', 2 )
+        }, "Az\x00\x00789Y" },
+        { "cut", func( s *Storage ) error {
+            return s.CutBytesAt( 4, 0, 3 )
+        }, "Az\x00\x00Y" },
+        { "paste", func( s *Storage ) error {
+            return s.InsertClipboardAt( 0, 0 )
+        }, "789Az\x00\x00Y" },
+        { "paste over", func( s *Storage ) error {
+            return s.ReplaceWithClipboardAt( 4, 0, 3 )
+        }, "789A789Y" },
+        { "delete all", func( s *Storage ) error {
+            return s.DeleteBytesAt( 0, 0, 8 )
+        }, "" },
+        { "insert in empty", func( s *Storage ) error {
+            return s.InsertBytesAt( 0, 0, []byte("new") )
+        }, "new" },
+    } )
+}
+
+func TestMultipleLocations( t *testing.T ) {
+    s, _ := newTestStorage( t, "abcabcabc" )
+    runSteps( t, s, "abcabcabc", []editStep{
+        { "same length", func( s *Storage ) error {
+            return s.ReplaceBytesAtMultipleLocations( []int64{ 0, 3, 6 }, 0, 1,
+                                                      []byte("A") )
+        }, "AbcAbcAbc" },
+        { "longer", func( s *Storage ) error {
+            return s.ReplaceBytesAtMultipleLocations( []int64{ 1, 7 }, 0, 2,
+                                                      []byte("xyz") )
+        }, "AxyzAbcAxyz" },
+    } )
+}
+
+func TestEditErrors( t *testing.T ) {
+    tests := []struct {
+        name            string
+        do              func( s *Storage ) error
+    }{
+        { "insert before start", func( s *Storage ) error {
+            return s.InsertBytesAt( -1, 0, []byte("a") )
+        } },
+        { "insert beyond end", func( s *Storage ) error {
+            return s.InsertBytesAt( 5, 0, []byte("a") )
+        } },
+        { "delete beyond end", func( s *Storage ) error {
+            return s.DeleteBytesAt( 2, 0, 3 )
+        } },
+        { "replace beyond end", func( s *Storage ) error {
+            return s.ReplaceBytesAt( 4, 0, 1, []byte("a") )
+        } },
+        { "erase beyond end", func( s *Storage ) error {
+            return s.ReplaceByteAtAndEraseFollowingBytes( 2, 0, 'a', 2 )
+        } },
+        { "no location", func( s *Storage ) error {
+            return s.ReplaceBytesAtMultipleLocations( nil, 0, 1,
+                                                      []byte("a") )
+        } },
+        { "unordered locations", func( s *Storage ) error {
+            return s.ReplaceBytesAtMultipleLocations( []int64{ 2, 0 }, 0, 1,
+                                                      []byte("a") )
+        } },
+        { "overlapping locations", func( s *Storage ) error {
+            return s.ReplaceBytesAtMultipleLocations( []int64{ 0, 1 }, 0, 2,
+                                                      []byte("a") )
+        } },
+    }
+    for _, test := range tests {
+        s, _ := newTestStorage( t, "abcd" )
+        if err := test.do( s ); err == nil {
+            t.Errorf( "%s: no error\n", test.name )
+        }
+        checkData( t, s, "abcd", test.name )
+        if u, _ := s.AreUndoRedoPossible(); u {
+            t.Errorf( "%s: undo possible after error\n", test.name )
+        }
+    }
+}
+
+func TestReadAt( t *testing.T ) {
+    s, _ := newTestStorage( t, "0123456789" )
+    s.InsertBytesAt( 5, 0, []byte("abc") )
+    tests := []struct {
+        off             int64
+        size            int
+        want            string
+        eof             bool
+    }{
+        { 0, 4, "0123", false },
+        { 3, 5, "34abc", false },
+        { 10, 3, "789", false },
+        { 11, 4, "89", true },
+        { 13, 1, "", true },
+    }
+    for _, test := range tests {
+        p := make( []byte, test.size )
+        n, err := s.ReadAt( p, test.off )
+        if string(p[:n]) != test.want || (err != nil) != test.eof {
+            t.Errorf( "ReadAt %d, %d: got %q, %v want %q\n",
+                      test.off, test.size, p[:n], err, test.want )
+        }
+    }
+    var b bytes.Buffer
+    if _, err := s.WriteTo( &b ); err != nil ||
+                                        b.String() != "01234abc56789" {
+        t.Errorf( "WriteTo: got %q, %v\n", b.String(), err )
+    }
+}
+
+func TestReplaceSegments( t *testing.T ) {
+    s, _ := newTestStorage( t, "AxyzAbcAxyz" )
+    runSteps( t, s, "AxyzAbcAxyz", []editStep{
+        { "various segments", func( s *Storage ) error {
+            return s.ReplaceSegmentsAtMultipleLocations(
+                            []int64{ 0, 4, 10 }, 0, []int64{ 1, 3, 1 },
+                            [][]byte{ []byte("12"), nil, []byte("3") } )
+        }, "12xyzAxy3" },
+        { "contiguous segments", func( s *Storage ) error {
+            return s.ReplaceSegmentsAtMultipleLocations(
+                            []int64{ 0, 2 }, 0, []int64{ 2, 3 },
+                            [][]byte{ []byte("-"), []byte("+") } )
+        }, "-+Axy3" },
+    } )
+    err := s.ReplaceSegmentsAtMultipleLocations( []int64{ 0, 2 }, 0,
+                                    []int64{ 1 }, [][]byte{ nil, nil } )
+    if err == nil {
+        t.Errorf( "inconsistent segments: no error\n" )
+    }
+    checkData( t, s, "-+Axy3", "inconsistent segments" )
+}
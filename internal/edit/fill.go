@@ -0,0 +1,124 @@
+package edit
+
+import (
+    "fmt"
+    "io"
+)
+
+/*
+    Filling replaces a segment of data with generated bytes, or inserts them,
+    as a single operation. Bytes read from a generator are appended to the add
+    buffer by pages, so that the caller never has to make a slice of the whole
+    fill. A repeated pattern is appended to the add buffer only once, as a
+    block made of as many whole patterns as can fit in patternBlockSize, and
+    the fill is made of pieces all refering to that same block.
+*/
+
+const patternBlockSize = 1024 * 1024   // max repeated pattern in add buffer
+
+// append a block of repeated pattern to the add buffer and return the pieces
+// refering to it as many times as needed to make n bytes.
+func (s *Storage) addPattern( pattern []byte, n int64 ) (pieces []piece) {
+    pl := int64(len(pattern))
+    bl := (patternBlockSize / pl) * pl
+    if bl == 0 {
+        bl = pl
+    }
+    if bl > n {
+        bl = n
+    }
+    start := int64(len(s.addData))
+    for l := bl; l > 0; l -= pl {
+        if l < pl {
+            s.addData = append( s.addData, pattern[:l]... )
+        } else {
+            s.addData = append( s.addData, pattern... )
+        }
+    }
+    for ; n > 0; n -= bl {
+        if bl > n {
+            bl = n
+        }
+        pieces = appendPiece( pieces, piece{ added, start, bl } )
+    }
+    return
+}
+
+// append n bytes read from r to the add buffer and return the pieces refering
+// to them. In case of error the add buffer is left unchanged.
+func (s *Storage) addFromReader( r io.Reader, n int64 ) ([]piece, error) {
+    start := int64(len(s.addData))
+    for l := n; l > 0; {
+        chunk := l
+        if chunk > filePageSize {
+            chunk = filePageSize
+        }
+        end := len(s.addData)
+        s.addData = append( s.addData, make( []byte, chunk )... )
+        if _, err := io.ReadFull( r, s.addData[end:] ); err != nil {
+            s.addData = s.addData[:start]
+            return nil, err
+        }
+        l -= chunk
+    }
+    return appendPiece( nil, piece{ added, start, n } ), nil
+}
+
+func (s *Storage) checkFill( pos, dl, n int64 ) error {
+    if pos < 0 || dl < 0 || (pos + dl) > s.length {
+        return fmt.Errorf("FILL outside data boundaries\n")
+    }
+    if n <= 0 {
+        return fmt.Errorf("FILL without data\n")
+    }
+    return nil
+}
+
+// replace dl bytes at position pos with the pieces ins, as a single operation
+// that is never coalesced with typed bytes.
+func (s *Storage) fillPieces( pos, tag, dl int64, ins []piece ) {
+    s.CloseRun( )
+    s.replacePiecesNotifySave( pos, tag, dl, ins )
+    s.CloseRun( )
+}
+
+// FillWithPatternAt replaces a segment of data bytes in storage with the
+// pattern given by the argument pattern, repeated to make n bytes (the last
+// pattern may be truncated). The arguments pos and dl indicate the starting
+// point and the length of the data segment to replace, which is 0 to insert
+// n bytes at pos, or n to overwrite n bytes. The arguments pos and tag are
+// saved and returned when undoing or redoing the operation. However large n
+// is, the pattern is repeated only a limited number of times in memory. An
+// error is returned if the pattern is empty, if n is not positive or if the
+// segment to replace does not fit in storage.
+func (s *Storage) FillWithPatternAt( pos, tag, dl, n int64,
+                                     pattern []byte ) error {
+    if err := s.checkFill( pos, dl, n ); err != nil {
+        return err
+    }
+    if len(pattern) == 0 {
+        return fmt.Errorf("FILL without pattern\n")
+    }
+    s.fillPieces( pos, tag, dl, s.addPattern( pattern, n ) )
+    return nil
+}
+
+// FillFromReaderAt replaces a segment of data bytes in storage with n bytes
+// read from the generator r. The arguments pos and dl indicate the starting
+// point and the length of the data segment to replace, which is 0 to insert
+// n bytes at pos, or n to overwrite n bytes. The arguments pos and tag are
+// saved and returned when undoing or redoing the operation. Bytes are read
+// from r by limited chunks. An error is returned if n is not positive, if the
+// segment to replace does not fit in storage, or if r cannot provide n bytes,
+// in which case storage is not modified.
+func (s *Storage) FillFromReaderAt( pos, tag, dl, n int64, r io.Reader ) error {
+    if err := s.checkFill( pos, dl, n ); err != nil {
+        return err
+    }
+    ins, err := s.addFromReader( r, n )
+    if err != nil {
+        return err
+    }
+    s.fillPieces( pos, tag, dl, ins )
+    return nil
+}
@@ -0,0 +1,93 @@
+package edit
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestFillWithPattern( t *testing.T ) {
+    tests := []struct {
+        name            string
+        pos, dl, n      int64
+        pattern         string
+        want            string
+    }{
+        { "insert", 2, 0, 5, "ab", "01ababa23456789" },
+        { "overwrite", 2, 5, 5, "ab", "01ababa789" },
+        { "replace shorter", 0, 8, 3, "xyz", "xyz89" },
+        { "replace longer", 9, 1, 4, "-", "012345678----" },
+        { "append", 10, 0, 2, "abc", "0123456789ab" },
+        { "pattern longer than fill", 0, 1, 2, "abc", "ab123456789" },
+    }
+    for _, test := range tests {
+        s, _ := newTestStorage( t, "0123456789" )
+        runSteps( t, s, "0123456789", []editStep{
+            { test.name, func( s *Storage ) error {
+                return s.FillWithPatternAt( test.pos, 0, test.dl, test.n,
+                                            []byte(test.pattern) )
+            }, test.want },
+        } )
+    }
+}
+
+func TestFillErrors( t *testing.T ) {
+    tests := []struct {
+        name            string
+        pos, dl, n      int64
+        pattern         string
+    }{
+        { "no data", 0, 0, 0, "a" },
+        { "no pattern", 0, 0, 1, "" },
+        { "before start", -1, 1, 1, "a" },
+        { "beyond end", 8, 3, 3, "a" },
+    }
+    for _, test := range tests {
+        s, _ := newTestStorage( t, "0123456789" )
+        err := s.FillWithPatternAt( test.pos, 0, test.dl, test.n,
+                                    []byte(test.pattern) )
+        if err == nil {
+            t.Errorf( "%s: no error\n", test.name )
+        }
+        checkData( t, s, "0123456789", test.name )
+    }
+}
+
+func TestFillLargePattern( t *testing.T ) {
+    s, _ := newTestStorage( t, "0123456789" )
+    pattern := []byte("abc")
+    n := int64(3 * patternBlockSize + 5)
+    if err := s.FillWithPatternAt( 5, 0, 0, n, pattern ); err != nil {
+        t.Fatal( err )
+    }
+    if int64(len(s.addData)) > patternBlockSize {
+        t.Errorf( "add buffer grew to %d bytes\n", len(s.addData) )
+    }
+    want := append( []byte("01234"), bytes.Repeat( pattern, int(n / 3) )... )
+    want = append( append( want, pattern[:n % 3]... ), "56789"... )
+    if got := s.GetData( 0, s.Length() ); ! bytes.Equal( got, want ) {
+        t.Errorf( "fill does not repeat pattern\n" )
+    }
+}
+
+func TestFillFromReader( t *testing.T ) {
+    s, _ := newTestStorage( t, "0123456789" )
+    data := strings.Repeat( "0123456789abcdef", filePageSize / 8 )
+    err := s.FillFromReaderAt( 10, 0, 0, int64(len(data)),
+                               strings.NewReader( data ) )
+    if err != nil {
+        t.Fatal( err )
+    }
+    checkData( t, s, "0123456789" + data, "fill from reader" )
+
+    added := len(s.addData)
+    err = s.FillFromReaderAt( 0, 0, 0, 20, strings.NewReader( "short" ) )
+    if err == nil {
+        t.Errorf( "fill from short reader: no error\n" )
+    }
+    if len(s.addData) != added {
+        t.Errorf( "fill from short reader: add buffer grew to %d bytes\n",
+                  len(s.addData) )
+    }
+    checkData( t, s, "0123456789" + data, "fill from short reader" )
+}
@@ -0,0 +1,156 @@
+package edit
+
+import (
+    "fmt"
+)
+
+/*
+    A group is a sequence of operations that are undone or redone as a single
+    operation. Operations pushed onto the undo/redo tree between BeginGroup
+    and EndGroup are collapsed into a single group operation when the group
+    ends. Groups can be nested, in which case each inner group becomes a single
+    operation within the outer group. Undo and Redo are not possible while a
+    group is in progress. If a group is aborted, all operations done since the
+    beginning of the group are undone and removed from the undo/redo tree.
+*/
+
+type groupStart struct {
+    tag                 int64           // caller's command tag for the group
+    first               int             // first tree node added in the group
+    redo                int             // branch selected for redo at start
+}
+
+// return the position where the operation op takes place.
+func opPosition( op interface{} ) int64 {
+    switch op := op.(type) {
+    case singlePosOp:
+        return op.position
+    case multiPosOp:
+        return op.positions[0]
+    case groupOp:
+        return op.position
+    case runOp:
+        return opPosition( op.ops[0] )
+    }
+    return 0
+}
+
+// return the tag given with the operation op.
+func opTag( op interface{} ) int64 {
+    switch op := op.(type) {
+    case singlePosOp:
+        return op.tag
+    case multiPosOp:
+        return op.tag
+    case groupOp:
+        return op.tag
+    case runOp:
+        return opTag( op.ops[0] )
+    }
+    return 0
+}
+
+// remove the last nodes from the tree, starting from the node given by first.
+// Since operations cannot be undone during a group, the removed nodes form a
+// single branch, whose first node is the last child of its parent.
+func (s *Storage) dropNodes( first int ) {
+    parent := &s.tree[s.tree[first].parent]
+    parent.children = parent.children[:len(parent.children)-1]
+    if parent.redo = len(parent.children) - 1; parent.redo < 0 {
+        parent.redo = 0
+    }
+    if s.journal != nil {
+        s.journal.unmapNodes( first, len( s.tree ) )
+    }
+    s.tree = s.tree[:first]
+}
+
+// collapse the operations in the last n tree nodes, which must end with the
+// current node, into a single group node.
+func (s *Storage) collapseGroup( tag int64, n int ) {
+    first := len( s.tree ) - n
+    ops := make( []interface{}, n )
+    for i := range ops {
+        ops[i] = s.tree[first+i].op
+    }
+    s.current = s.tree[first].parent
+    s.dropNodes( first )
+    s.addNode( groupOp{ tag, opPosition( ops[0] ), ops } )
+}
+
+// BeginGroup starts a group of operations, which will be undone or redone as
+// a single operation once the group ends. The argument tag is saved and
+// returned with the position of the first operation in the group when undoing
+// or redoing the whole group. Each call to BeginGroup must be followed by a
+// call to EndGroup or to AbortGroup.
+func (s *Storage) BeginGroup( tag int64 ) {
+    s.CloseRun( )
+    s.groups = append( s.groups, groupStart{ tag, len( s.tree ),
+                                             s.tree[s.current].redo } )
+}
+
+// EndGroup ends the group started by the last call to BeginGroup. An error is
+// returned if no group was started.
+func (s *Storage) EndGroup( ) error {
+    l := len( s.groups )
+    if l == 0 {
+        return fmt.Errorf( "EndGroup without BeginGroup\n" )
+    }
+    g := s.groups[l-1]
+    s.groups = s.groups[:l-1]
+    if n := len( s.tree ) - g.first; n > 0 {
+        s.collapseGroup( g.tag, n )
+        s.recordGroup( g.tag, n )
+    }
+    return nil
+}
+
+// AbortGroup ends the group started by the last call to BeginGroup, undoing
+// all operations done since then. Those operations cannot be redone. An error
+// is returned if no group was started.
+func (s *Storage) AbortGroup( ) error {
+    l := len( s.groups )
+    if l == 0 {
+        return fmt.Errorf( "AbortGroup without BeginGroup\n" )
+    }
+    g := s.groups[l-1]
+    s.groups = s.groups[:l-1]
+    n := len( s.tree ) - g.first
+    if n == 0 {
+        return nil
+    }
+    curLen := s.length
+    var c Change
+    for steps := 0; s.current >= g.first; steps++ {
+        from := s.current
+        _, _, step := s.undoStep( )
+        c = accumulateChange( c, step, steps )
+        s.recordMove( from )
+    }
+    s.dropNodes( g.first )
+    s.recordDiscard( n )
+    if len( s.tree[s.current].children ) > 0 {  // restore branch selection
+        s.selectBranch( g.redo )
+        s.recordBranch( g.redo )
+    }
+    if s.notifyUndoRedo != nil {
+        s.notifyUndoRedo( s.AreUndoRedoPossible() )
+    }
+    c.Kind = UNDO
+    s.notifySwap( curLen, c )
+    return nil
+}
+
+// Transaction calls the function f within a group of operations, which will
+// be undone or redone as a single operation, with the position of the first
+// operation in the group and the argument tag. If f returns an error, the
+// group is aborted (all operations done by f are undone) and that error is
+// returned.
+func (s *Storage) Transaction( tag int64, f func( ) error ) error {
+    s.BeginGroup( tag )
+    if err := f( ); err != nil {
+        s.AbortGroup( )
+        return err
+    }
+    return s.EndGroup( )
+}
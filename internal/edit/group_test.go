@@ -0,0 +1,100 @@
+package edit
+
+import (
+    "fmt"
+    "testing"
+)
+
+func TestGroups( t *testing.T ) {
+    s, _ := newTestStorage( t, "0123456789" )
+    runSteps( t, s, "0123456789", []editStep{
+        { "group", func( s *Storage ) error {
+            s.BeginGroup( 1 )
+            s.InsertBytesAt( 0, 0, []byte("ab") )
+            s.DeleteBytesAt( 5, 0, 2 )
+            s.ReplaceByteAt( 9, 0, 'x' )
+            return s.EndGroup( )
+        }, "ab0125678x" },
+        { "nested groups", func( s *Storage ) error {
+            s.BeginGroup( 2 )
+            s.InsertByteAt( 0, 0, '<' )
+            s.BeginGroup( 3 )
+            s.InsertByteAt( 11, 0, '>' )
+            s.InsertByteAt( 12, 0, '>' )
+            if err := s.EndGroup( ); err != nil {
+                return err
+            }
+            s.DeleteByteAt( 1, 0 )
+            return s.EndGroup( )
+        }, "<b0125678x>>" },
+        { "empty group", func( s *Storage ) error {
+            s.BeginGroup( 4 )
+            s.InsertByteAt( 0, 0, '!' )
+            s.BeginGroup( 5 )
+            if err := s.EndGroup( ); err != nil {
+                return err
+            }
+            return s.EndGroup( )
+        }, "!<b0125678x>>" },
+        { "aborted inner group", func( s *Storage ) error {
+            s.BeginGroup( 6 )
+            s.DeleteByteAt( 0, 0 )
+            s.BeginGroup( 7 )
+            s.DeleteBytesAt( 0, 0, 3 )
+            if err := s.AbortGroup( ); err != nil {
+                return err
+            }
+            return s.EndGroup( )
+        }, "<b0125678x>>" },
+    } )
+    if err := s.EndGroup( ); err == nil {
+        t.Errorf( "EndGroup without BeginGroup succeeded\n" )
+    }
+    if err := s.AbortGroup( ); err == nil {
+        t.Errorf( "AbortGroup without BeginGroup succeeded\n" )
+    }
+}
+
+func TestGroupRestrictions( t *testing.T ) {
+    s, _ := newTestStorage( t, "abc" )
+    s.InsertByteAt( 0, 0, 'x' )
+    s.Undo( )
+    s.BeginGroup( 0 )
+    s.InsertByteAt( 0, 0, 'a' )
+    if _, _, err := s.Undo( ); err == nil {
+        t.Errorf( "Undo within a group succeeded\n" )
+    }
+    if _, _, err := s.Redo( ); err == nil {
+        t.Errorf( "Redo within a group succeeded\n" )
+    }
+    s.EndGroup( )
+}
+
+func TestAbortGroup( t *testing.T ) {
+    s, _ := newTestStorage( t, "abc" )
+    s.InsertBytesAt( 0, 0, []byte("x") )
+    s.BeginGroup( 0 )
+    s.InsertBytesAt( 0, 0, []byte("abc") )
+    s.DeleteBytesAt( 1, 0, 2 )
+    if err := s.AbortGroup( ); err != nil {
+        t.Fatal( err )
+    }
+    checkData( t, s, "xabc", "AbortGroup" )
+    if u, r := s.AreUndoRedoPossible(); ! u || r {
+        t.Errorf( "AbortGroup: undo %t, redo %t want true, false\n", u, r )
+    }
+
+    fail := fmt.Errorf( "failure" )
+    err := s.Transaction( 0, func( ) error {
+        s.InsertBytesAt( 0, 0, []byte("abc") )
+        return fail
+    } )
+    if err != fail {
+        t.Errorf( "Transaction: got error %v, want %v\n", err, fail )
+    }
+    checkData( t, s, "xabc", "Transaction" )
+    if _, _, err = s.Undo( ); err != nil {
+        t.Fatal( err )
+    }
+    checkData( t, s, "abc", "undo after AbortGroup" )
+}
@@ -0,0 +1,613 @@
+package edit
+
+import (
+    "bufio"
+    "crypto/sha1"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+)
+
+/*
+    The undo/redo journal is an optional file where every operation pushed onto
+    the undo/redo tree is recorded, with the bytes it appended to the add
+    buffer, as well as every move in the tree. Operations are recorded by their
+    positions, deleted lengths and inserted pieces, which refer only to the add
+    buffer or to zeros, so that the complete tree can be restored by replaying
+    the journal, provided that the file has not changed: the journal starts
+    with a header giving the file path, size and modification time, which must
+    match the file.
+
+    The journal is kept when the storage is closed. When the data is saved, the
+    journal is restarted for the saved file, with the saved state as its root:
+    the undo/redo tree is kept in memory, but only the saved state and the
+    operations that follow it are journaled from then on. Moves to states that
+    are not journaled (e.g. undoing beyond the saved state) are not recorded.
+    The journal is restarted with an empty history when the storage is reloaded.
+
+    The journal is made of a header followed by records:
+      header:   magic, path length, path, file size, file modification time
+      record:   kind ('S' single position op, 'M' multiple position op, 'U'
+                undo, 'B' branch, 'J' jump, 'G' group, 'D' discard or 'C'
+                coalesce) followed, for an operation, by its tag, its number
+                of positions (multiple position op only), each position with
+                its deleted length and inserted pieces, and the bytes appended
+                to the add buffer, for a branch, by the selected branch index,
+                for a jump, by the target node, for a group, by its tag and the
+                number of operations collapsed in the group, and for a discard,
+                by the number of nodes removed from the tree (when a group is
+                aborted). A coalesce record has no argument: it merges the
+                operation just recorded with the run of typed bytes in the
+                parent node.
+    Journal nodes are numbered in the order they are recorded, starting with 0
+    for the journal root, and are mapped to the tree nodes they correspond to.
+    All numbers are stored as varints. A truncated or invalid record (e.g. after
+    a crash) is ignored, as well as any following record.
+*/
+
+const (
+    journalMagic     = "HEXEDJ02"
+    journalSuffix    = ".journal"
+)
+
+const (
+    singlePosRecord  = 'S'
+    multiPosRecord   = 'M'
+    undoRecord       = 'U'
+    groupRecord      = 'G'
+    discardRecord    = 'D'
+    branchRecord     = 'B'
+    jumpRecord       = 'J'
+    coalesceRecord   = 'C'
+)
+
+// ErrJournalOutdated is returned by OpenJournal if the file has been modified
+// since the journal was recorded. In that case the recorded history is lost.
+var ErrJournalOutdated = fmt.Errorf( "file was modified since its undo journal was recorded\n" )
+
+type journal struct {
+    file                *os.File        // journal file, open for appending
+    dir                 string          // where journal files are kept
+    recorded            int             // add buffer length already recorded
+    addBase             int             // add buffer length at journal start
+    nodes               map[int]int     // journal node of each recorded node
+    next                int             // next journal node
+}
+
+// return a new journal recorded in file f, whose root is the current node.
+func (s *Storage) newJournal( f *os.File, dir string ) *journal {
+    return &journal{ f, dir, len(s.addData), len(s.addData),
+                     map[int]int{ s.current: 0 }, 1 }
+}
+
+// give a journal node to the tree node given by id, if the operation leading
+// to it is recorded, that is if its parent has a journal node.
+func (j *journal) mapNode( id, parent int ) {
+    if _, ok := j.nodes[parent]; ok {
+        j.nodes[id] = j.next
+        j.next ++
+    }
+}
+
+// forget the journal nodes of the tree nodes from first to the end of tree.
+func (j *journal) unmapNodes( first, beyond int ) {
+    for id := first; id < beyond; id++ {
+        if _, ok := j.nodes[id]; ok {
+            delete( j.nodes, id )
+            j.next --
+        }
+    }
+}
+
+// return whether the tree node given by id is recorded in the journal.
+func (s *Storage) isJournaled( id int ) bool {
+    if s.journal == nil {
+        return false
+    }
+    _, ok := s.journal.nodes[id]
+    return ok
+}
+
+// return the journal path for the file given by path.
+func journalPath( dir, path string ) string {
+    return filepath.Join( dir, fmt.Sprintf( "%x%s",
+                                            sha1.Sum( []byte(path) ),
+                                            journalSuffix ) )
+}
+
+type record []byte
+
+func (r record) putVarint( v int64 ) record {
+    var b [binary.MaxVarintLen64]byte
+    return append( r, b[:binary.PutVarint( b[:], v )]... )
+}
+
+// append inserted pieces, with the start of added pieces relative to base.
+func (r record) putPieces( pieces []piece, base int ) record {
+    r = r.putVarint( int64(len(pieces)) )
+    for _, p := range pieces {
+        if p.source == added {
+            p.start -= int64(base)
+        }
+        r = r.putVarint( int64(p.source) )
+        r = r.putVarint( p.start )
+        r = r.putVarint( p.length )
+    }
+    return r
+}
+
+func makeHeader( path string, info os.FileInfo ) record {
+    r := append( record(nil), journalMagic... )
+    r = r.putVarint( int64(len(path)) )
+    r = append( r, path... )
+    r = r.putVarint( info.Size() )
+    return r.putVarint( info.ModTime().UnixNano() )
+}
+
+// journalReader reads a journal, keeping track of the number of bytes read.
+// The first error is kept and returned by all subsequent reads, so that it can
+// be checked only once after reading a complete record.
+type journalReader struct {
+    reader              *bufio.Reader
+    size                int64           // journal size
+    count               int64           // number of bytes read
+    err                 error           // first error encountered
+}
+
+func (jr *journalReader) ReadByte( ) (b byte, err error) {
+    if jr.err != nil {
+        return 0, jr.err
+    }
+    if b, err = jr.reader.ReadByte(); err != nil {
+        jr.err = err
+    } else {
+        jr.count ++
+    }
+    return
+}
+
+func (jr *journalReader) getVarint( ) int64 {
+    v, err := binary.ReadVarint( jr )
+    if err != nil && jr.err == nil {
+        jr.err = err
+    }
+    return v
+}
+
+func (jr *journalReader) getBytes( n int64 ) []byte {
+    if jr.err != nil {
+        return nil
+    }
+    if n < 0 || n > jr.size - jr.count {
+        jr.err = fmt.Errorf( "invalid length %d\n", n )
+        return nil
+    }
+    b := make( []byte, n )
+    c, err := io.ReadFull( jr.reader, b )
+    jr.count += int64(c)
+    if err != nil {
+        jr.err = err
+    }
+    return b
+}
+
+// read inserted pieces, with the start of added pieces relative to base.
+func (jr *journalReader) getPieces( base int ) (pieces []piece) {
+    for n := jr.getVarint(); n > 0 && jr.err == nil; n-- {
+        source := int(jr.getVarint())
+        start := jr.getVarint()
+        if source == added {
+            start += int64(base)
+        }
+        pieces = append( pieces, piece{ source, start, jr.getVarint() } )
+    }
+    return
+}
+
+// return whether the header matches the file given by path and info.
+func (jr *journalReader) checkHeader( path string, info os.FileInfo ) bool {
+    if string(jr.getBytes( int64(len(journalMagic)) )) != journalMagic {
+        return false
+    }
+    if string(jr.getBytes( jr.getVarint() )) != path {
+        return false
+    }
+    return jr.getVarint() == info.Size() &&
+           jr.getVarint() == info.ModTime().UnixNano() && jr.err == nil
+}
+
+// check that the inserted pieces refer to existing data, with the add buffer
+// extended by n bytes, and return their lengths.
+func (s *Storage) checkInserted( ins [][]piece, n int64 ) ([]int64, error) {
+    lengths := make( []int64, len(ins) )
+    for i, pieces := range ins {
+        for _, p := range pieces {
+            var limit int64
+            switch p.source {
+            case added:
+                limit = int64(len(s.addData)) + n
+            case zeros:
+                limit = p.start + p.length
+            default:
+                return nil, fmt.Errorf( "invalid piece source\n" )
+            }
+            if p.start < 0 || p.length <= 0 || p.start + p.length > limit {
+                return nil, fmt.Errorf( "invalid piece\n" )
+            }
+            lengths[i] += p.length
+        }
+    }
+    return lengths, nil
+}
+
+// read the next record from the journal and replay it.
+func (s *Storage) replayRecord( jr *journalReader ) error {
+    kind, err := jr.ReadByte()
+    if err != nil {
+        return err
+    }
+    switch kind {
+    case singlePosRecord, multiPosRecord:
+        return s.replayOp( jr, kind )
+    case undoRecord:
+        if s.current == 0 {
+            return fmt.Errorf( "invalid undo\n" )
+        }
+        s.undoStep( )
+        return nil
+    case branchRecord:
+        index := jr.getVarint()
+        if jr.err != nil {
+            return jr.err
+        }
+        return s.selectBranch( int(index) )
+    case jumpRecord:
+        id := jr.getVarint()
+        if jr.err != nil {
+            return jr.err
+        }
+        _, _, err = s.jumpTo( int(id) )
+        return err
+    case groupRecord:
+        t, n := jr.getVarint(), jr.getVarint()
+        if jr.err != nil {
+            return jr.err
+        }
+        if n <= 0 || n >= int64(len( s.tree )) || s.current != len( s.tree ) - 1 {
+            return fmt.Errorf( "invalid group\n" )
+        }
+        s.collapseGroup( t, int(n) )
+        return nil
+    case discardRecord:
+        n := jr.getVarint()
+        if jr.err != nil {
+            return jr.err
+        }
+        if n <= 0 || n >= int64(len( s.tree )) ||
+           int64(s.current) >= int64(len( s.tree )) - n {
+            return fmt.Errorf( "invalid discard\n" )
+        }
+        s.dropNodes( len( s.tree ) - int(n) )
+        return nil
+    case coalesceRecord:
+        if s.current != len( s.tree ) - 1 || s.tree[s.current].parent == 0 ||
+           ! canRun( s.tree[s.current].op ) {
+            return fmt.Errorf( "invalid coalesce\n" )
+        }
+        switch s.tree[s.tree[s.current].parent].op.(type) {
+        case singlePosOp, runOp:
+        default:
+            return fmt.Errorf( "invalid coalesce\n" )
+        }
+        s.coalesce( )
+        return nil
+    default:
+        return fmt.Errorf( "invalid record\n" )
+    }
+}
+
+// read the rest of an operation record of the given kind from the journal and
+// replay the operation.
+func (s *Storage) replayOp( jr *journalReader, kind byte ) error {
+    t, n := jr.getVarint(), int64(1)
+    if kind == multiPosRecord {
+        n = jr.getVarint()
+    }
+    var pos, dl []int64
+    var ins [][]piece
+    for ; n > 0 && jr.err == nil; n-- {
+        pos = append( pos, jr.getVarint() )
+        dl = append( dl, jr.getVarint() )
+        ins = append( ins, jr.getPieces( s.journal.addBase ) )
+    }
+    data := jr.getBytes( jr.getVarint() )
+    if jr.err != nil {
+        return jr.err
+    }
+    if len(pos) == 0 {
+        return fmt.Errorf( "operation without position\n" )
+    }
+    if err := s.checkSegments( pos, dl ); err != nil {
+        return err
+    }
+    il, err := s.checkInserted( ins, int64(len(data)) )
+    if err != nil {
+        return err
+    }
+    s.addData = append( s.addData, data... )
+    swap := s.makeSwap( pos, dl, ins )
+    if kind == singlePosRecord {
+        s.addNode( singlePosOp{ t, dl[0], il[0], pos[0], swap } )
+    } else {
+        s.addNode( multiPosOp{ t, pos, dl, il, swap } )
+    }
+    s.swapPieces( swap.index, swap.before, swap.after )
+    return nil
+}
+
+// replay all complete records from the journal and return the journal offset
+// after the last record replayed.
+func (s *Storage) replayJournal( jr *journalReader ) int64 {
+    for {
+        offset := jr.count
+        if err := s.replayRecord( jr ); err != nil {
+            if err != io.EOF || jr.count != offset {
+                log.Printf( "Ignoring end of undo journal: %v\n", err )
+            }
+            return offset
+        }
+    }
+}
+
+// OpenJournal starts recording all operations in a journal file kept in the
+// directory given by dir, for the file given by path, which must have been
+// just loaded. If a journal already exists for that file, and if the file has
+// not been modified since the journal was recorded, all operations are first
+// replayed, so that the full undo/redo tree is restored, and OpenJournal
+// returns true. If the file was modified, the journal is restarted and the
+// error ErrJournalOutdated is returned. Any other error means that no journal
+// is kept.
+func (s *Storage) OpenJournal( dir, path string ) (restored bool, err error) {
+    if s.fileInfo == nil || len(s.tree) > 1 {
+        return false, fmt.Errorf( "Journal requires a freshly loaded file\n" )
+    }
+    s.closeJournal( false )
+    var f *os.File
+    if f, path, err = openJournalFile( dir, path, 0 ); err != nil {
+        return
+    }
+    s.journal = s.newJournal( f, dir )
+
+    var offset int64
+    var info os.FileInfo
+    if info, err = f.Stat(); err != nil {
+        s.closeJournal( false )
+        return
+    }
+    jr := &journalReader{ reader: bufio.NewReaderSize( f, filePageSize ),
+                          size: info.Size() }
+    if jr.checkHeader( path, s.fileInfo ) {
+        offset = s.replayJournal( jr )
+        restored = len(s.tree) > 1
+    } else if jr.count > 0 {
+        err = ErrJournalOutdated
+    }
+    if offset == 0 {
+        header := makeHeader( path, s.fileInfo )
+        _, wErr := f.WriteAt( header, 0 )
+        if wErr != nil {
+            s.closeJournal( true )
+            return false, wErr
+        }
+        offset = int64(len(header))
+    }
+    tErr := f.Truncate( offset )
+    if tErr == nil {
+        _, tErr = f.Seek( offset, io.SeekStart )
+    }
+    if tErr != nil {
+        s.closeJournal( true )
+        return false, tErr
+    }
+    s.journal.recorded = len(s.addData)
+
+    if restored {
+        s.notifyDataChange( Change{ 0, s.originalLength(), s.length, RELOAD } )
+        if s.notifyUndoRedo != nil {
+            s.notifyUndoRedo( s.AreUndoRedoPossible() )
+        }
+        if s.notifyLenChange != nil {
+            s.notifyLenChange( s.length )
+        }
+    }
+    return
+}
+
+// open the journal file kept in dir for the file given by path, with the
+// additional open flags given by flag, and return it with the absolute path.
+func openJournalFile( dir, path string,
+                      flag int ) (f *os.File, abs string, err error) {
+    if abs, err = filepath.Abs( path ); err != nil {
+        return
+    }
+    if err = os.MkdirAll( dir, 0750 ); err != nil {
+        return
+    }
+    f, err = os.OpenFile( journalPath( dir, abs ),
+                          os.O_RDWR | os.O_CREATE | flag, 0600 )
+    return
+}
+
+// restart the journal for the file given by path, after the current data was
+// saved in that file. The undo/redo tree is kept: the saved state becomes the
+// journal root and only the operations that follow it are recorded.
+func (s *Storage) rebaseJournal( path string ) {
+    if s.journal == nil {
+        return
+    }
+    dir := s.journal.dir
+    s.closeJournal( true )
+    if s.fileInfo == nil {
+        return
+    }
+    f, path, err := openJournalFile( dir, path, os.O_TRUNC )
+    if err == nil {
+        if _, err = f.Write( makeHeader( path, s.fileInfo ) ); err != nil {
+            f.Close()
+            os.Remove( f.Name() )
+        }
+    }
+    if err != nil {
+        log.Printf( "Unable to restart undo journal: %v\n", err )
+        return
+    }
+    s.journal = s.newJournal( f, dir )
+}
+
+// restart the journal for the file given by path, after reloading the file.
+func (s *Storage) restartJournal( path string ) {
+    dir := s.journal.dir
+    s.closeJournal( true )
+    if _, err := s.OpenJournal( dir, path ); err != nil {
+        log.Printf( "Unable to restart undo journal: %v\n", err )
+        s.closeJournal( false )
+    }
+}
+
+// stop recording operations. The journal file is removed if remove is true
+// or if there is no operation to restore.
+func (s *Storage) closeJournal( remove bool ) {
+    if s.journal != nil {
+        name := s.journal.file.Name()
+        s.journal.file.Close()
+        if remove || s.journal.next == 1 {
+            os.Remove( name )
+        }
+        s.journal = nil
+    }
+}
+
+// append a record to the journal. In case of error, the journal is closed.
+func (s *Storage) writeRecord( r record ) {
+    if _, err := s.journal.file.Write( r ); err != nil {
+        log.Printf( "Unable to write undo journal: %v - stop recording\n", err )
+        s.closeJournal( true )
+    }
+}
+
+// return the pieces describing the segment of length bytes starting at offset
+// start in the data described by pieces.
+func slicePieces( pieces []piece, start, length int64 ) (slice []piece) {
+    for _, p := range pieces {
+        if length <= 0 {
+            break
+        }
+        if start >= p.length {
+            start -= p.length
+            continue
+        }
+        p.start += start
+        p.length -= start
+        start = 0
+        if p.length > length {
+            p.length = length
+        }
+        slice = append( slice, p )
+        length -= p.length
+    }
+    return
+}
+
+// record the operation just pushed onto the undo/redo tree, before its piece
+// swap is applied, if it follows a journaled state. The inserted pieces are
+// extracted from the swap: since the pieces before the swap index do not
+// change, the swapped pieces start at the same position before and after.
+func (s *Storage) recordOp( op interface{} ) {
+    if ! s.isJournaled( s.current ) {
+        return
+    }
+    var r record
+    var pos, dl, il []int64
+    var swap pieceSwap
+    switch op := op.(type) {
+    case singlePosOp:
+        r = append( r, singlePosRecord ).putVarint( op.tag )
+        pos, dl, il = []int64{ op.position }, []int64{ op.delLen },
+                      []int64{ op.insLen }
+        swap = op.swap
+    case multiPosOp:
+        r = append( r, multiPosRecord ).putVarint( op.tag )
+        r = r.putVarint( int64(len(op.positions)) )
+        pos, dl, il, swap = op.positions, op.delLens, op.insLens, op.swap
+    }
+    start := piecesLength( s.pieces[:swap.index] )
+    shift := int64(0)
+    for i, p := range pos {
+        r = r.putVarint( p ).putVarint( dl[i] )
+        ins := slicePieces( swap.after, p + shift - start, il[i] )
+        r = r.putPieces( ins, s.journal.addBase )
+        shift += il[i] - dl[i]
+    }
+    data := s.addData[s.journal.recorded:]
+    r = r.putVarint( int64(len(data)) )
+    r = append( r, data... )
+    s.journal.recorded = len(s.addData)
+    s.writeRecord( r )
+}
+
+// record the last n operations collapsed in a group.
+func (s *Storage) recordGroup( tag int64, n int ) {
+    if s.isJournaled( s.current ) {
+        s.writeRecord( record{ groupRecord }.putVarint( tag ).putVarint( int64(n) ) )
+    }
+}
+
+// record the number of nodes removed from the tree when a group is aborted.
+func (s *Storage) recordDiscard( n int ) {
+    if s.isJournaled( s.current ) {
+        s.writeRecord( record{ discardRecord }.putVarint( int64(n) ) )
+    }
+}
+
+// record a branch selection. Since only the journaled children of the current
+// node are known in the journal, the index is relative to those children.
+func (s *Storage) recordBranch( index int ) {
+    children := s.tree[s.current].children
+    if ! s.isJournaled( s.current ) || ! s.isJournaled( children[index] ) {
+        return
+    }
+    journaled := 0
+    for _, child := range children[:index] {
+        if s.isJournaled( child ) {
+            journaled ++
+        }
+    }
+    s.writeRecord( record{ branchRecord }.putVarint( int64(journaled) ) )
+}
+
+// record the coalescing of the operation just recorded with its parent node.
+func (s *Storage) recordCoalesce( ) {
+    if s.isJournaled( s.current ) {
+        s.writeRecord( record{ coalesceRecord } )
+    }
+}
+
+// record a move in the tree from the node given by from to the current node:
+// an undo if both are journaled and the current node is the parent, or else a
+// jump to the current node. A redo is recorded as a jump, since the branch it
+// follows may have been selected while the journal was not recording. A move
+// to a state that is not journaled is not recorded.
+func (s *Storage) recordMove( from int ) {
+    if ! s.isJournaled( s.current ) {
+        return
+    }
+    if s.isJournaled( from ) && s.tree[from].parent == s.current {
+        s.writeRecord( record{ undoRecord } )
+    } else {
+        id := int64(s.journal.nodes[s.current])
+        s.writeRecord( record{ jumpRecord }.putVarint( id ) )
+    }
+}
@@ -0,0 +1,218 @@
+package edit
+
+import (
+    "os"
+    "reflect"
+    "testing"
+)
+
+// return a new storage loaded from the file given by path, with its journal
+// kept in dir, and whether the journal was restored.
+func openWithJournal( t *testing.T, path, dir string ) (*Storage, bool) {
+    t.Helper()
+    s, err := NewStorage( path, nil )
+    if err != nil {
+        t.Fatal( err )
+    }
+    restored, err := s.OpenJournal( dir, path )
+    if err != nil {
+        t.Fatal( err )
+    }
+    return s, restored
+}
+
+// check that the storage s2 restored from the journal has the data want, and
+// the same undo/redo tree and branch selections as the storage s1.
+func checkRestored( t *testing.T, s1, s2 *Storage, want, when string ) {
+    t.Helper()
+    checkData( t, s2, want, when )
+    nodes1, current1 := s1.GetUndoTree( )
+    nodes2, current2 := s2.GetUndoTree( )
+    if current1 != current2 || ! reflect.DeepEqual( nodes1, nodes2 ) {
+        t.Fatalf( "%s: restored tree %v at %d, want %v at %d\n", when,
+                  nodes2, current2, nodes1, current1 )
+    }
+    for i := range s1.tree {
+        if s1.tree[i].redo != s2.tree[i].redo {
+            t.Fatalf( "%s: node %d follows branch %d, want %d\n", when,
+                      i, s2.tree[i].redo, s1.tree[i].redo )
+        }
+    }
+}
+
+func TestJournalReplay( t *testing.T ) {
+    tests := []struct {
+        name            string
+        do              func( s *Storage )
+    }{
+        { "nothing", func( s *Storage ) { } },
+        { "operations", func( s *Storage ) {
+            s.InsertBytesAt( 2, 1, []byte("abc") )
+            s.DeleteBytesAt( 0, 2, 4 )
+            s.ReplaceBytesAt( 3, 3, 2, []byte("xyz") )
+            s.ReplaceSegmentsAtMultipleLocations( []int64{ 0, 4 }, 4,
+                        []int64{ 1, 2 }, [][]byte{ []byte("12"), nil } )
+            s.ReplaceByteAtAndEraseFollowingBytes( 1, 5, 'z', 2 )
+            s.FillWithPatternAt( 6, 6, 0, 10, []byte("-+") )
+        } },
+        { "runs", func( s *Storage ) {
+            s.InsertByteAt( 2, 1, 'a' )
+            s.InsertByteAt( 3, 2, 'b' )
+            s.DeleteByteAt( 3, 3 )
+            s.CloseRun( )
+            s.ReplaceByteAt( 6, 4, 'c' )
+            s.ReplaceByteAt( 7, 5, 'd' )
+        } },
+        { "undo and branches", func( s *Storage ) {
+            s.InsertBytesAt( 2, 1, []byte("abc") )
+            s.InsertBytesAt( 0, 2, []byte("xyz") )
+            s.Undo( )
+            s.Undo( )
+            s.DeleteBytesAt( 0, 3, 5 )
+            s.Undo( )
+            s.SelectBranch( 0 )
+            s.Redo( )
+            s.Redo( )
+            s.JumpTo( 3 )
+            s.JumpTo( 0 )
+        } },
+        { "groups", func( s *Storage ) {
+            s.Transaction( 1, func( ) error {
+                s.InsertBytesAt( 2, 2, []byte("abc") )
+                return s.DeleteBytesAt( 0, 3, 1 )
+            } )
+            s.InsertBytesAt( 0, 4, []byte("x") )
+            s.Undo( )
+            s.BeginGroup( 5 )
+            s.InsertBytesAt( 0, 6, []byte("aborted") )
+            s.AbortGroup( )
+            s.BeginGroup( 7 )
+            s.InsertByteAt( 1, 8, 'y' )
+            s.InsertByteAt( 2, 9, 'z' )
+            s.EndGroup( )
+        } },
+    }
+    for _, test := range tests {
+        _, path := newTestStorage( t, "0123456789" )
+        dir := t.TempDir( )
+        s1, _ := openWithJournal( t, path, dir )
+        test.do( s1 )
+        want := string( s1.GetData( 0, s1.Length() ) )
+        s1.Close( )
+        s2, restored := openWithJournal( t, path, dir )
+        if restored != (len(s1.tree) > 1) {
+            t.Errorf( "%s: journal restored is %t\n", test.name, restored )
+        }
+        checkRestored( t, s1, s2, want, test.name )
+        s2.Close( )
+    }
+}
+
+func TestJournalAfterSave( t *testing.T ) {
+    s0, path := newTestStorage( t, "0123456789" )
+    dir := t.TempDir( )
+    s0.Close( )
+    s, _ := openWithJournal( t, path, dir )
+
+    save := func( ) {
+        f, err := os.Create( path )
+        if err == nil {
+            _, err = s.WriteTo( f )
+            f.Close( )
+        }
+        if err != nil {
+            t.Fatal( err )
+        }
+        s.SetSaved( path )
+    }
+    s.InsertBytesAt( 0, 1, []byte("abc") )
+    s.InsertBytesAt( 5, 2, []byte("def") )
+    s.Undo( )
+    save( )
+    s.ReplaceBytesAt( 1, 3, 1, []byte("x") )
+    s.Undo( )
+    s.DeleteBytesAt( 0, 4, 3 )
+    s.CloseRun( )
+    s.Undo( )
+    s.Undo( )                           // beyond the saved state
+    s.Close( )
+
+    s, restored := openWithJournal( t, path, dir )
+    if ! restored {
+        t.Fatalf( "journal not restored after save\n" )
+    }
+    nodes, current := s.GetUndoTree( )
+    want := []UndoNode{
+        { -1, 0, 0, []int{ 1, 2 } },
+        { 0, 1, 3, nil },
+        { 0, 0, 4, nil },
+    }
+    if current != 0 || ! reflect.DeepEqual( nodes, want ) {
+        t.Errorf( "got tree %v at %d, want %v at 0\n", nodes, current, want )
+    }
+    checkData( t, s, "abc0123456789", "restored after save" )
+    if _, _, err := s.Redo( ); err != nil {
+        t.Fatal( err )
+    }
+    checkData( t, s, "0123456789", "redo after save" )
+    s.Close( )
+}
+
+func TestJournalOutdated( t *testing.T ) {
+    _, path := newTestStorage( t, "0123456789" )
+    dir := t.TempDir( )
+    s, _ := openWithJournal( t, path, dir )
+    s.InsertBytesAt( 0, 0, []byte("abc") )
+    s.Close( )
+
+    if err := os.WriteFile( path, []byte("modified"), 0600 ); err != nil {
+        t.Fatal( err )
+    }
+    s, err := NewStorage( path, nil )
+    if err != nil {
+        t.Fatal( err )
+    }
+    defer s.Close( )
+    if restored, err := s.OpenJournal( dir, path );
+                                restored || err != ErrJournalOutdated {
+        t.Errorf( "got %t, %v want false, %v\n", restored, err,
+                  ErrJournalOutdated )
+    }
+    checkData( t, s, "modified", "outdated journal" )
+}
+
+func TestJournalTruncated( t *testing.T ) {
+    _, path := newTestStorage( t, "0123456789" )
+    dir := t.TempDir( )
+    s1, _ := openWithJournal( t, path, dir )
+    s1.InsertBytesAt( 0, 1, []byte("abc") )
+    s1.CloseRun( )
+    size := int64(0)
+    if info, err := s1.journal.file.Stat(); err == nil {
+        size = info.Size()
+    }
+    s1.InsertBytesAt( 2, 2, []byte("def") )
+    name := s1.journal.file.Name()
+    s1.Close( )
+
+    for cut := int64(1); cut < 4; cut ++ {
+        info, err := os.Stat( name )
+        if err != nil {
+            t.Fatal( err )
+        }
+        if err = os.Truncate( name, info.Size() - cut ); err != nil {
+            t.Fatal( err )
+        }
+        s2, _ := openWithJournal( t, path, dir )
+        checkData( t, s2, "abc0123456789", "truncated journal" )
+        if nodes, _ := s2.GetUndoTree(); len(nodes) != 2 {
+            t.Errorf( "truncated journal: %d nodes, want 2\n", len(nodes) )
+        }
+        if info, err = os.Stat( name ); err != nil || info.Size() != size {
+            t.Errorf( "truncated journal: invalid record not removed\n" )
+        }
+        // make the invalid record again
+        s2.InsertBytesAt( 2, 2, []byte("def") )
+        s2.Close( )
+    }
+}
@@ -0,0 +1,98 @@
+package edit
+
+import (
+    "sort"
+)
+
+/*
+    Modified ranges are the segments of data that were inserted or replaced
+    since the data was last loaded or saved, ignoring the bytes that are just
+    shifted by insertions or deletions. Since the original data and the add
+    buffer are never modified, each byte of original or added data is uniquely
+    identified by its source and its position in that source. The segments
+    referred to by the pieces at the time the data was loaded or saved are
+    kept as a base, and a byte is modified if its current piece refers to a
+    segment that is not in the base. Segments of zeros cannot be identified
+    that way, their base is made of their positions in data instead.
+
+    Modified ranges are computed again only after the pieces have changed, so
+    that they always reflect the current state, including after undo or redo.
+*/
+
+// sort ranges and merge the contiguous or overlapping ones.
+func sortRanges( ranges []Range ) []Range {
+    sort.Slice( ranges, func( i, j int ) bool {
+        return ranges[i].Start < ranges[j].Start
+    } )
+    var sorted []Range
+    for _, r := range ranges {
+        sorted = appendRange( sorted, r )
+    }
+    return sorted
+}
+
+// make the current pieces the base for modified ranges.
+func (s *Storage) setBase( ) {
+    var base [zeros+1][]Range
+    var pos int64
+    for _, p := range s.pieces {
+        if p.source == zeros {
+            base[zeros] = append( base[zeros], Range{ pos, p.length } )
+        } else {
+            base[p.source] = append( base[p.source], Range{ p.start, p.length } )
+        }
+        pos += p.length
+    }
+    for i := range base {
+        s.base[i] = sortRanges( base[i] )
+    }
+    s.modified = nil
+    s.modifiedValid = false
+}
+
+// append to ranges the parts of the segment [start:start+length[ that are not
+// included in the sorted list base. The argument pos is the position in data
+// corresponding to start, the returned ranges are given as positions in data.
+func appendExcluded( ranges, base []Range, pos, start, length int64 ) []Range {
+    beyond := start + length
+    i := sort.Search( len(base), func( i int ) bool {
+        return base[i].Start + base[i].Length > start
+    } )
+    for ; i < len(base) && base[i].Start < beyond; i++ {
+        if base[i].Start > start {
+            ranges = appendRange( ranges, Range{ pos, base[i].Start - start } )
+        }
+        if end := base[i].Start + base[i].Length; end > start {
+            pos += end - start
+            start = end
+        }
+    }
+    if start < beyond {
+        ranges = appendRange( ranges, Range{ pos, beyond - start } )
+    }
+    return ranges
+}
+
+// GetModifiedRanges returns the sorted list of data segments that were
+// inserted or replaced since the data was last loaded or saved. Bytes that
+// were just shifted by inserting or deleting other bytes are not included.
+// The returned slice must not be modified.
+func (s *Storage) GetModifiedRanges( ) []Range {
+    if ! s.modifiedValid {
+        var ranges []Range
+        var pos int64
+        for _, p := range s.pieces {
+            if p.source == zeros {
+                ranges = appendExcluded( ranges, s.base[zeros], pos, pos,
+                                         p.length )
+            } else {
+                ranges = appendExcluded( ranges, s.base[p.source], pos,
+                                         p.start, p.length )
+            }
+            pos += p.length
+        }
+        s.modified = ranges
+        s.modifiedValid = true
+    }
+    return s.modified
+}
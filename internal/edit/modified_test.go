@@ -0,0 +1,116 @@
+package edit
+
+import (
+    "testing"
+)
+
+func TestModifiedRanges( t *testing.T ) {
+    tests := []struct {
+        name            string
+        do              func( s *Storage )
+        modified        []Range
+    }{
+        { "unmodified", func( s *Storage ) { }, nil },
+        { "insert", func( s *Storage ) {
+            s.InsertBytesAt( 2, 0, []byte("ab") )
+        }, []Range{ { 2, 2 } } },
+        { "replace", func( s *Storage ) {
+            s.ReplaceByteAt( 3, 0, 'x' )
+        }, []Range{ { 3, 1 } } },
+        { "delete", func( s *Storage ) {
+            s.DeleteBytesAt( 4, 0, 2 )
+        }, nil },
+        { "contiguous", func( s *Storage ) {
+            s.ReplaceByteAt( 1, 0, 'x' )
+            s.CloseRun( )
+            s.ReplaceBytesAt( 2, 0, 1, []byte("yz") )
+        }, []Range{ { 1, 3 } } },
+        { "same bytes", func( s *Storage ) {
+            s.ReplaceBytesAt( 5, 0, 2, []byte("56") )
+        }, []Range{ { 5, 2 } } },
+        { "moved", func( s *Storage ) {
+            s.Transaction( 0, func( ) error {
+                s.DeleteBytesAt( 0, 0, 2 )
+                return s.InsertBytesAt( 8, 0, []byte("01") )
+            } )
+        }, []Range{ { 8, 2 } } },
+        { "zeros", func( s *Storage ) {
+            s.ReplaceByteAtAndEraseFollowingBytes( 2, 0, 'z', 3 )
+        }, []Range{ { 2, 4 } } },
+        { "undone", func( s *Storage ) {
+            s.ReplaceBytesAt( 0, 0, 5, []byte("abc") )
+            s.Undo( )
+        }, nil },
+    }
+    for _, test := range tests {
+        s, _ := newTestStorage( t, "0123456789" )
+        test.do( s )
+        if got := s.GetModifiedRanges(); ! sameRanges( got, test.modified ) {
+            t.Errorf( "%s: modified ranges %v, want %v\n", test.name,
+                      got, test.modified )
+        }
+    }
+}
+
+func TestModifiedRangesAfterSave( t *testing.T ) {
+    s, path := newTestStorage( t, "0123456789" )
+    steps := []struct {
+        name            string
+        do              func( )
+        modified        []Range
+    }{
+        { "replace", func( ) {
+            s.ReplaceByteAt( 3, 0, 'x' )
+            s.CloseRun( )
+            s.ReplaceByteAt( 8, 0, 'y' )
+        }, []Range{ { 3, 1 }, { 8, 1 } } },
+        { "save", func( ) {
+            s.SetSaved( path )
+        }, nil },
+        { "replace after save", func( ) {
+            s.ReplaceByteAt( 6, 0, 'z' )
+        }, []Range{ { 6, 1 } } },
+        { "undo to saved", func( ) {
+            s.Undo( )
+        }, nil },
+        { "undo before saved", func( ) {
+            s.Undo( )
+        }, []Range{ { 8, 1 } } },
+        { "zeros after save", func( ) {
+            s.ReplaceByteAtAndEraseFollowingBytes( 0, 0, 'z', 2 )
+            s.SetSaved( path )
+            s.ReplaceByteAt( 1, 0, 0 )
+        }, []Range{ { 1, 1 } } },
+    }
+    for _, step := range steps {
+        step.do( )
+        if got := s.GetModifiedRanges(); ! sameRanges( got, step.modified ) {
+            t.Errorf( "%s: modified ranges %v, want %v\n", step.name,
+                      got, step.modified )
+        }
+    }
+}
+
+func TestExcludedRanges( t *testing.T ) {
+    tests := []struct {
+        name            string
+        base,
+        excluded        []Range         // excluded from base in [0:20[
+    }{
+        { "empty", nil, []Range{ { 0, 20 } } },
+        { "disjoint", []Range{ { 4, 2 }, { 16, 4 } },
+                      []Range{ { 0, 4 }, { 6, 10 } } },
+        { "contiguous", []Range{ { 2, 4 }, { 6, 2 }, { 10, 10 } },
+                        []Range{ { 0, 2 }, { 8, 2 } } },
+        { "overlapping", []Range{ { 0, 4 }, { 6, 2 }, { 18, 5 } },
+                         []Range{ { 4, 2 }, { 8, 10 } } },
+        { "included", []Range{ { 0, 30 } }, nil },
+    }
+    for _, test := range tests {
+        excluded := appendExcluded( nil, test.base, 0, 0, 20 )
+        if ! sameRanges( excluded, test.excluded ) {
+            t.Errorf( "%s: excluded %v, want %v\n", test.name,
+                      excluded, test.excluded )
+        }
+    }
+}
@@ -0,0 +1,129 @@
+package edit
+
+/*
+    Each data change is notified to all subscribers with the affected range:
+    OldLength bytes starting at Start before the change are replaced with
+    NewLength bytes starting at Start after the change. Data before Start is
+    never modified, and data after the range is just shifted by the difference
+    between both lengths. When an operation modifies several segments (multiple
+    positions, group or run of typed bytes, jump in the undo/redo tree), the
+    range covers all modified segments and the data between them.
+*/
+
+type ChangeKind int
+
+// Kind of operation that changed data
+const (
+    INSERT ChangeKind = iota            // bytes inserted
+    DELETE                              // bytes deleted
+    REPLACE                             // bytes replaced (or several segments)
+    UNDO                                // operation undone
+    REDO                                // operation redone
+    JUMP                                // jump in the undo/redo tree
+    RELOAD                              // whole data reloaded or restored
+)
+
+// Change describes a data change, as notified to subscribers.
+type Change struct {
+    Start,                              // first modified byte position
+    OldLength,                          // range length before change
+    NewLength           int64           // range length after change
+    Kind                ChangeKind      // what caused the change
+}
+
+type subscriber struct {
+    id                  int             // returned when subscribing
+    notify              func( c Change )
+}
+
+// return the change made by applying the change c, then the change next.
+func (c Change) then( next Change ) Change {
+    start := c.Start
+    if next.Start < start {
+        start = next.Start
+    }
+    end := c.Start + c.NewLength        // end in intermediate data
+    if e := next.Start + next.OldLength; e > end {
+        end = e
+    }
+    return Change{ start, end - start - (c.NewLength - c.OldLength),
+                   end - start + (next.NewLength - next.OldLength), c.Kind }
+}
+
+// return the change c made by the previous steps, followed by the change next
+// made by one more step. The argument steps is the number of previous steps.
+func accumulateChange( c, next Change, steps int ) Change {
+    if steps == 0 {
+        return next
+    }
+    return c.then( next )
+}
+
+// return the change made by undoing the change c.
+func (c Change) reverse( ) Change {
+    return Change{ c.Start, c.NewLength, c.OldLength, c.Kind }
+}
+
+// return the change made by doing (or redoing) the operation op.
+func opChange( op interface{} ) (c Change) {
+    switch op := op.(type) {
+    case singlePosOp:
+        c = Change{ op.position, op.delLen, op.insLen, REPLACE }
+        if op.delLen == 0 {
+            c.Kind = INSERT
+        } else if op.insLen == 0 {
+            c.Kind = DELETE
+        }
+    case multiPosOp:
+        n := len(op.positions)
+        first, last := op.positions[0], op.positions[n-1]
+        c = Change{ first, last + op.delLens[n-1] - first, 0, REPLACE }
+        c.NewLength = c.OldLength
+        for i := range op.positions {
+            c.NewLength += op.insLens[i] - op.delLens[i]
+        }
+    case groupOp:
+        c = groupChange( op.ops )
+    case runOp:
+        c = groupChange( op.ops )
+    }
+    return
+}
+
+// return the change made by doing (or redoing) the operations ops in order.
+func groupChange( ops []interface{} ) Change {
+    c := opChange( ops[0] )
+    for _, op := range ops[1:] {
+        c = c.then( opChange( op ) )
+    }
+    c.Kind = REPLACE
+    return c
+}
+
+// AddNotifyDataChange adds a subscriber, the function f, which is called with
+// the affected range each time data changes in storage. It returns an
+// identifier to give to RemoveNotifyDataChange when the subscriber is not
+// interested anymore. Subscribers are called in the order they were added.
+func (s *Storage) AddNotifyDataChange( f func( c Change ) ) (id int) {
+    s.lastSubscriber ++
+    s.subscribers = append( s.subscribers, subscriber{ s.lastSubscriber, f } )
+    return s.lastSubscriber
+}
+
+// RemoveNotifyDataChange removes the subscriber given by the identifier id,
+// as returned by AddNotifyDataChange.
+func (s *Storage) RemoveNotifyDataChange( id int ) {
+    for i, sub := range s.subscribers {
+        if sub.id == id {
+            s.subscribers = append( s.subscribers[:i:i], s.subscribers[i+1:]... )
+            return
+        }
+    }
+}
+
+// call all subscribers with the change c.
+func (s *Storage) notifyDataChange( c Change ) {
+    for _, sub := range s.subscribers {
+        sub.notify( c )
+    }
+}
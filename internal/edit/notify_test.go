@@ -0,0 +1,106 @@
+package edit
+
+import (
+    "testing"
+)
+
+func TestChangeThen( t *testing.T ) {
+    tests := []struct {
+        name            string
+        c, next, want   Change
+    }{
+        { "same position", Change{ 5, 0, 2, INSERT }, Change{ 5, 0, 3, INSERT },
+                           Change{ 5, 0, 5, INSERT } },
+        { "typing", Change{ 5, 0, 1, INSERT }, Change{ 6, 0, 1, INSERT },
+                    Change{ 5, 0, 2, INSERT } },
+        { "deleting backward", Change{ 5, 1, 0, DELETE },
+                               Change{ 4, 1, 0, DELETE },
+                               Change{ 4, 2, 0, DELETE } },
+        { "inside", Change{ 2, 2, 10, REPLACE }, Change{ 4, 2, 1, REPLACE },
+                    Change{ 2, 2, 9, REPLACE } },
+        { "disjoint after", Change{ 2, 1, 3, REPLACE },
+                            Change{ 10, 2, 0, DELETE },
+                            Change{ 2, 8, 8, REPLACE } },
+        { "disjoint before", Change{ 10, 2, 0, DELETE },
+                             Change{ 2, 1, 3, REPLACE },
+                             Change{ 2, 10, 10, DELETE } },
+        { "overlapping", Change{ 4, 4, 4, REPLACE }, Change{ 2, 4, 0, DELETE },
+                         Change{ 2, 6, 2, REPLACE } },
+        { "undone", Change{ 3, 0, 4, INSERT }, Change{ 3, 4, 0, UNDO },
+                    Change{ 3, 0, 0, INSERT } },
+    }
+    for _, test := range tests {
+        if got := test.c.then( test.next ); got != test.want {
+            t.Errorf( "%s: got %v want %v\n", test.name, got, test.want )
+        }
+    }
+}
+
+// subscribe to data changes and check that each notified change covers all
+// bytes that differ from the previous data.
+func checkChanges( t *testing.T, s *Storage ) (count *int) {
+    t.Helper()
+    prev := string( s.GetData( 0, s.Length() ) )
+    count = new( int )
+    s.AddNotifyDataChange( func( c Change ) {
+        *count ++
+        cur := string( s.GetData( 0, s.Length() ) )
+        if c.Start < 0 || c.OldLength < 0 || c.NewLength < 0 ||
+           c.Start + c.OldLength > int64(len(prev)) ||
+           c.Start + c.NewLength > int64(len(cur)) ||
+           c.NewLength - c.OldLength != int64(len(cur) - len(prev)) {
+            t.Fatalf( "change %v inconsistent with %q -> %q\n", c, prev, cur )
+        }
+        if prev[:c.Start] != cur[:c.Start] ||
+           prev[c.Start+c.OldLength:] != cur[c.Start+c.NewLength:] {
+            t.Fatalf( "change %v does not cover %q -> %q\n", c, prev, cur )
+        }
+        prev = cur
+    } )
+    return
+}
+
+func TestNotifiedChanges( t *testing.T ) {
+    s, _ := newTestStorage( t, "0123456789" )
+    count := checkChanges( t, s )
+    steps := []func( ) error{
+        func( ) error { return s.InsertBytesAt( 2, 0, []byte("ab") ) },
+        func( ) error { return s.InsertByteAt( 4, 0, 'c' ) },
+        func( ) error { return s.DeleteByteAt( 4, 0 ) },
+        func( ) error { return s.DeleteByteAt( 3, 0 ) },
+        func( ) error { s.CloseRun(); return nil },
+        func( ) error {
+            return s.ReplaceSegmentsAtMultipleLocations( []int64{ 1, 6 }, 0,
+                            []int64{ 2, 1 }, [][]byte{ nil, []byte("xyz") } )
+        },
+        func( ) error {
+            return s.Transaction( 0, func( ) error {
+                if err := s.DeleteBytesAt( 8, 0, 2 ); err != nil {
+                    return err
+                }
+                return s.InsertBytesAt( 0, 0, []byte("<") )
+            } )
+        },
+        func( ) error { _, _, err := s.Undo(); return err },
+        func( ) error { _, _, err := s.Undo(); return err },
+        func( ) error { return s.FillWithPatternAt( 3, 0, 2, 4,
+                                                    []byte("-") ) },
+        func( ) error { _, err := s.JumpTo( 4 ); return err },
+        func( ) error { _, err := s.JumpTo( 0 ); return err },
+        func( ) error { _, _, err := s.Redo(); return err },
+        func( ) error {
+            s.BeginGroup( 0 )
+            s.InsertBytesAt( 0, 0, []byte("aborted") )
+            s.DeleteBytesAt( 10, 0, 2 )
+            return s.AbortGroup( )
+        },
+    }
+    for i, step := range steps {
+        if err := step( ); err != nil {
+            t.Fatalf( "step %d: %v", i, err )
+        }
+    }
+    if *count != 16 {
+        t.Errorf( "got %d notifications, want 16\n", *count )
+    }
+}
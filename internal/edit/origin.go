@@ -0,0 +1,187 @@
+package edit
+
+import (
+    "container/list"
+    "io"
+    "os"
+)
+
+const (
+    maxResidentSize = 64 * 1024 * 1024  // files larger are read on demand
+    filePageSize    = 64 * 1024         // size of pages read on demand
+    maxCachedPages  = 256               // number of pages kept in memory
+)
+
+/*
+    The original data is either resident, when the file is small enough to be
+    read entirely in memory, or paged, when it is larger. In that case the file
+    is kept open and read on demand in fixed size pages. Only the most recently
+    used pages are kept in memory, so that the memory used does not depend on
+    the file size. Since original data is never modified (edits are kept in
+    the add buffer until saved), pages are never written back. However, if the
+    file itself is modified in place, the pages that are about to be overwritten
+    must first be preserved in memory, where they stay until the file is closed.
+
+    Reading a page may fail if the file becomes unreadable. The error is then
+    returned to the caller, and the page is read again the next time it is
+    needed.
+*/
+type origin interface {
+    size( ) int64                           // original data size
+    getData( start, beyond int64 ) ([]byte, error) // shallow if possible
+    close( ) error                          // release file if needed
+    preserve( start, beyond int64 ) error   // before overwriting the file
+}
+
+type residentOrigin []byte
+
+func (ro residentOrigin) size( ) int64 {
+    return int64(len(ro))
+}
+
+func (ro residentOrigin) getData( start, beyond int64 ) ([]byte, error) {
+    return ro[start:beyond:beyond], nil
+}
+
+func (ro residentOrigin) close( ) error {
+    return nil
+}
+
+func (ro residentOrigin) preserve( start, beyond int64 ) error {
+    return nil  // nothing to do, since data is not read from the file anymore
+}
+
+type filePage struct {
+    number              int64           // page number in file
+    data                []byte          // page content
+}
+
+type pagedOrigin struct {
+    file                *os.File        // open file
+    length              int64           // file size
+    cache               map[int64]*list.Element // cached pages by number
+    lru                 *list.List      // cached pages, most recent first
+    preserved           map[int64][]byte // pages overwritten in file
+}
+
+func (po *pagedOrigin) size( ) int64 {
+    return po.length
+}
+
+func (po *pagedOrigin) close( ) error {
+    po.cache = nil
+    po.lru = nil
+    po.preserved = nil
+    return po.file.Close()
+}
+
+// keep in memory the pages including the data between start and beyond, before
+// that data is overwritten in the file.
+func (po *pagedOrigin) preserve( start, beyond int64 ) error {
+    for n := start / filePageSize; n * filePageSize < beyond; n++ {
+        if _, ok := po.preserved[n]; ! ok {
+            data, err := po.getPage( n )
+            if err != nil {
+                return err
+            }
+            po.preserved[n] = data
+        }
+    }
+    return nil
+}
+
+// return the content of the page number n, either from the cache or from
+// the file. The least recently used page is dropped if the cache is full.
+func (po *pagedOrigin) getPage( n int64 ) ([]byte, error) {
+    if data, ok := po.preserved[n]; ok {
+        return data, nil
+    }
+    if e, ok := po.cache[n]; ok {
+        po.lru.MoveToFront( e )
+        return e.Value.(*filePage).data, nil
+    }
+
+    start := n * filePageSize
+    l := po.length - start
+    if l > filePageSize {
+        l = filePageSize
+    }
+    data := make( []byte, l )
+    if _, err := po.file.ReadAt( data, start ); err != nil && err != io.EOF {
+        return nil, err
+    }
+
+    if po.lru.Len() >= maxCachedPages {
+        last := po.lru.Back()
+        delete( po.cache, last.Value.(*filePage).number )
+        po.lru.Remove( last )
+    }
+    po.cache[n] = po.lru.PushFront( &filePage{ n, data } )
+    return data, nil
+}
+
+func (po *pagedOrigin) getData( start, beyond int64 ) ([]byte, error) {
+    first := start / filePageSize
+    if first == (beyond - 1) / filePageSize {  // within a single page
+        data, err := po.getPage( first )
+        if err != nil {
+            return nil, err
+        }
+        off := start - first * filePageSize
+        l := off + beyond - start
+        return data[off:l:l], nil
+    }
+    data := make( []byte, 0, beyond - start )
+    for pos := start; pos < beyond; {
+        n := pos / filePageSize
+        page, err := po.getPage( n )
+        if err != nil {
+            return nil, err
+        }
+        off := pos - n * filePageSize
+        l := int64(len(page))
+        if n * filePageSize + l > beyond {
+            l = beyond - n * filePageSize
+        }
+        data = append( data, page[off:l]... )
+        pos += l - off
+    }
+    return data, nil
+}
+
+// open the file given by path and return its content as original data,
+// either resident or paged depending on the file size, as well as the file
+// information at the time it was opened.
+func openOrigin( path string ) (origin, os.FileInfo, error) {
+    file, err := os.Open( path )
+    if err != nil {
+        return nil, nil, err
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, nil, err
+    }
+    // seeking allows getting the size of block devices as well as files
+    length, err := file.Seek( 0, io.SeekEnd )
+    if err != nil {
+        file.Close()
+        return nil, nil, err
+    }
+    if length > maxResidentSize {
+        po := new( pagedOrigin )
+        po.file = file
+        po.length = length
+        po.cache = make( map[int64]*list.Element )
+        po.lru = list.New()
+        po.preserved = make( map[int64][]byte )
+        return po, info, nil
+    }
+
+    defer file.Close()
+    data := make( []byte, length )
+    if _, err = file.ReadAt( data, 0 ); err != nil && err != io.EOF {
+        return nil, nil, err
+    }
+    return residentOrigin( data ), info, nil
+}
@@ -0,0 +1,93 @@
+package edit
+
+import (
+    "time"
+)
+
+/*
+    Bytes typed one nibble at a time result in a sequence of tiny operations
+    (inserting, replacing or deleting a byte, or a couple of bytes when a byte
+    is split or joined at an odd nibble). Consecutive operations at contiguous
+    positions are coalesced in a single run, which is undone or redone as a
+    single operation, like typing words in a text editor.
+
+    A run is closed by any other kind of operation, by undo, redo or a jump in
+    the undo/redo tree, by a group, by saving, by a pause longer than runPause
+    between two operations, or explicitly by the caller with CloseRun (when the
+    caret is moved or the input mode is changed). Tags are not compared, since
+    they just indicate where the caller should place its caret: the tag of the
+    first operation in the run is returned when undoing the run, and the tag of
+    the last operation when redoing it, as their positions.
+*/
+
+const (
+    maxRunOpLength  = 2                 // max deleted or inserted length in a run
+    runPause        = time.Second       // max delay between operations in a run
+)
+
+// return whether the operation op can be part of a run.
+func canRun( op interface{} ) bool {
+    if op, ok := op.(singlePosOp); ok {
+        return op.delLen <= maxRunOpLength && op.insLen <= maxRunOpLength
+    }
+    return false
+}
+
+// return the last operation in the run op, which is either a single position
+// operation that starts the run, or a run of single position operations.
+func lastRunOp( op interface{} ) singlePosOp {
+    if run, ok := op.(runOp); ok {
+        return run.ops[len(run.ops)-1].(singlePosOp)
+    }
+    return op.(singlePosOp)
+}
+
+// return whether the operation next takes place at a position contiguous to
+// the operation prev, that is between the byte before prev (as when deleting
+// backward) and the byte after the data inserted by prev (as when typing).
+func contiguous( prev, next singlePosOp ) bool {
+    return next.position >= prev.position - 1 &&
+           next.position <= prev.position + prev.insLen
+}
+
+// merge the operation in the current node, which must be the last tree node,
+// with the operation in its parent node, and make that parent the current node.
+func (s *Storage) coalesce( ) {
+    node := s.tree[s.current]
+    parent := &s.tree[node.parent]
+    var ops []interface{}
+    if run, ok := parent.op.(runOp); ok {
+        ops = run.ops
+    } else {
+        ops = []interface{}{ parent.op }
+    }
+    parent.op = runOp{ append( ops, node.op ) }
+    s.current = node.parent
+    s.dropNodes( len( s.tree ) - 1 )
+}
+
+// extend the run in progress with the operation op just pushed onto the tree,
+// or start a new run with op, or close the run if op cannot be part of a run.
+func (s *Storage) extendRun( op interface{} ) {
+    if ! canRun( op ) || len( s.groups ) > 0 {
+        s.run = 0
+        return
+    }
+    now := time.Now()
+    if s.run != 0 && s.run != s.saved && s.tree[s.current].parent == s.run &&
+       now.Sub( s.runTime ) < runPause &&
+       contiguous( lastRunOp( s.tree[s.run].op ), op.(singlePosOp) ) {
+        s.coalesce( )
+        s.recordCoalesce( )
+    } else {
+        s.run = s.current
+    }
+    s.runTime = now
+}
+
+// CloseRun ends the run of typed bytes in progress, if any, so that the next
+// operation is undone or redone separately. It should be called each time the
+// caret is moved or the input mode is changed.
+func (s *Storage) CloseRun( ) {
+    s.run = 0
+}
@@ -0,0 +1,108 @@
+package edit
+
+import (
+    "testing"
+)
+
+func TestRunCoalescing( t *testing.T ) {
+    insert := func( pos int64, b byte ) func( s *Storage, path string ) {
+        return func( s *Storage, path string ) {
+            s.InsertByteAt( pos, pos, b )
+        }
+    }
+    replace := func( pos int64, b byte ) func( s *Storage, path string ) {
+        return func( s *Storage, path string ) {
+            s.ReplaceByteAt( pos, pos, b )
+        }
+    }
+    remove := func( pos int64 ) func( s *Storage, path string ) {
+        return func( s *Storage, path string ) {
+            s.DeleteByteAt( pos, pos )
+        }
+    }
+    pause := func( s *Storage, path string ) {
+        s.runTime = s.runTime.Add( -runPause )
+    }
+    closeRun := func( s *Storage, path string ) {
+        s.CloseRun( )
+    }
+    save := func( s *Storage, path string ) {
+        s.SetSaved( path )
+    }
+
+    tests := []struct {
+        name            string
+        steps           []func( s *Storage, path string )
+        undos           int             // undo steps back to the initial state
+        want            string
+    }{
+        { "typing", []func( s *Storage, path string ){
+            insert( 2, 'a' ), insert( 3, 'b' ), insert( 4, 'c' ),
+        }, 1, "01abc23456789" },
+        { "overwriting", []func( s *Storage, path string ){
+            replace( 2, 'a' ), replace( 3, 'b' ), replace( 4, 'c' ),
+        }, 1, "01abc56789" },
+        { "deleting backward", []func( s *Storage, path string ){
+            remove( 5 ), remove( 4 ), remove( 3 ),
+        }, 1, "0126789" },
+        { "deleting forward", []func( s *Storage, path string ){
+            remove( 3 ), remove( 3 ), remove( 3 ),
+        }, 1, "0126789" },
+        { "typing then correcting", []func( s *Storage, path string ){
+            insert( 2, 'a' ), insert( 3, 'b' ), remove( 3 ), insert( 3, 'c' ),
+        }, 1, "01ac23456789" },
+        { "not contiguous", []func( s *Storage, path string ){
+            insert( 2, 'a' ), insert( 5, 'b' ), insert( 6, 'c' ),
+        }, 2, "01a23bc456789" },
+        { "too long", []func( s *Storage, path string ){
+            insert( 2, 'a' ), func( s *Storage, path string ) {
+                s.InsertBytesAt( 3, 3, []byte("bcd") )
+            }, insert( 6, 'e' ),
+        }, 3, "01abcde23456789" },
+        { "pause", []func( s *Storage, path string ){
+            insert( 2, 'a' ), insert( 3, 'b' ), pause, insert( 4, 'c' ),
+        }, 2, "01abc23456789" },
+        { "closed", []func( s *Storage, path string ){
+            insert( 2, 'a' ), closeRun, insert( 3, 'b' ), insert( 4, 'c' ),
+        }, 2, "01abc23456789" },
+        { "saved", []func( s *Storage, path string ){
+            insert( 2, 'a' ), save, insert( 3, 'b' ), insert( 4, 'c' ),
+        }, 2, "01abc23456789" },
+    }
+    for _, test := range tests {
+        s, path := newTestStorage( t, "0123456789" )
+        for _, step := range test.steps {
+            step( s, path )
+        }
+        checkData( t, s, test.want, test.name )
+        var undos int
+        for ; undos <= len(test.steps); undos ++ {
+            if u, _ := s.AreUndoRedoPossible(); ! u {
+                break
+            }
+            s.Undo( )
+        }
+        if undos != test.undos {
+            t.Errorf( "%s: %d undo steps, want %d\n", test.name,
+                      undos, test.undos )
+        }
+        checkData( t, s, "0123456789", test.name + " undone" )
+    }
+}
+
+func TestRunPositions( t *testing.T ) {
+    s, _ := newTestStorage( t, "0123456789" )
+    for i, b := range []byte("abc") {
+        s.InsertByteAt( 2 + int64(i), 10 + int64(i), b )
+    }
+    if pos, tag, err := s.Undo( ); err != nil || pos != 2 || tag != 10 {
+        t.Errorf( "undo run: got %d, %d, %v want 2, 10\n", pos, tag, err )
+    }
+    if pos, tag, err := s.Redo( ); err != nil || pos != 4 || tag != 12 {
+        t.Errorf( "redo run: got %d, %d, %v want 4, 12\n", pos, tag, err )
+    }
+    // a run is never extended after undo or redo
+    s.InsertByteAt( 5, 13, 'd' )
+    s.Undo( )
+    checkData( t, s, "01abc23456789", "undo after redo" )
+}
@@ -0,0 +1,139 @@
+package edit
+
+import (
+    "fmt"
+)
+
+type undoNode struct {
+    op                  interface{}     // operation leading to this state
+    parent              int             // previous state (-1 for initial state)
+    children            []int           // following states, oldest first
+    redo                int             // index of the child followed by redo
+}
+
+// UndoNode describes a state in the undo/redo tree. The initial state is the
+// node 0, which has no parent and no operation. Each other node is the state
+// after performing an operation on its parent state. Position and Tag are
+// the values given with the operation that led to that state.
+type UndoNode struct {
+    Parent              int             // previous state (-1 for initial state)
+    Position, Tag       int64           // operation position and tag
+    Children            []int           // following states, oldest first
+}
+
+// reset the undo/redo tree to a single initial state.
+func (s *Storage) resetTree( ) {
+    s.tree = make( []undoNode, 1, defUndoSize )
+    s.tree[0] = undoNode{ nil, -1, nil, 0 }
+    s.current = 0
+    s.saved = 0
+    s.run = 0
+}
+
+// GetUndoTree returns all nodes in the undo/redo tree, indexed by node
+// identifier, as well as the identifier of the current node.
+func (s *Storage) GetUndoTree( ) (nodes []UndoNode, current int) {
+    nodes = make( []UndoNode, len(s.tree) )
+    for i, node := range s.tree {
+        nodes[i].Parent = node.parent
+        if node.op != nil {
+            nodes[i].Position, nodes[i].Tag = opPosition( node.op ), opTag( node.op )
+        }
+        nodes[i].Children = append( []int(nil), node.children... )
+    }
+    return nodes, s.current
+}
+
+// GetBranches returns the identifiers of the nodes that can be reached by
+// redoing from the current node (the branches), oldest first, as well as the
+// index of the branch that Redo will follow. If no operation can be redone,
+// branches is empty.
+func (s *Storage) GetBranches( ) (branches []int, selected int) {
+    node := s.tree[s.current]
+    return append( []int(nil), node.children... ), node.redo
+}
+
+// SelectBranch selects the branch that Redo will follow, given by its index
+// in the list of branches returned by GetBranches. An error is returned if
+// the index is not valid.
+func (s *Storage) SelectBranch( index int ) error {
+    if len( s.groups ) > 0 {
+        return fmt.Errorf( "branch selection not possible within a group\n" )
+    }
+    if err := s.selectBranch( index ); err != nil {
+        return err
+    }
+    s.recordBranch( index )
+    return nil
+}
+
+func (s *Storage) selectBranch( index int ) error {
+    node := &s.tree[s.current]
+    if index < 0 || index >= len( node.children ) {
+        return fmt.Errorf( "invalid branch %d\n", index )
+    }
+    node.redo = index
+    return nil
+}
+
+// undo and redo operations, without notification, in order to reach the node
+// given by id from the current node, through their closest common ancestor.
+// The position of the last operation undone or redone is returned, as well as
+// the whole data change.
+func (s *Storage) jumpTo( id int ) (pos int64, c Change, err error) {
+    if id < 0 || id >= len( s.tree ) {
+        return 0, c, fmt.Errorf( "invalid undo node %d\n", id )
+    }
+    ancestors := make( map[int]bool )
+    for n := s.current; n != -1; n = s.tree[n].parent {
+        ancestors[n] = true
+    }
+    var path []int                      // from id up to the common ancestor
+    n := id
+    for ; ! ancestors[n]; n = s.tree[n].parent {
+        path = append( path, n )
+    }
+    var step Change
+    steps := 0
+    for s.current != n {
+        pos, _, step = s.undoStep( )
+        c = accumulateChange( c, step, steps )
+        steps ++
+    }
+    for i := len(path) - 1; i >= 0; i-- {
+        node := &s.tree[s.current]
+        for j, child := range node.children {
+            if child == path[i] {
+                node.redo = j
+                break
+            }
+        }
+        pos, _, step = s.redoStep( )
+        c = accumulateChange( c, step, steps )
+        steps ++
+    }
+    c.Kind = JUMP
+    return
+}
+
+// JumpTo undoes and redoes operations as needed to reach the state given by
+// the node identifier id in the undo/redo tree, and returns the position of
+// the last operation undone or redone. An error is returned if id is not a
+// valid node identifier.
+func (s *Storage) JumpTo( id int ) (pos int64, err error) {
+    if len( s.groups ) > 0 {
+        return 0, fmt.Errorf( "jump not possible within a group\n" )
+    }
+    s.CloseRun( )
+    curLen, from := s.length, s.current
+    var c Change
+    if pos, c, err = s.jumpTo( id ); err != nil {
+        return
+    }
+    s.recordMove( from )
+    if s.notifyUndoRedo != nil {
+        s.notifyUndoRedo( s.AreUndoRedoPossible() )
+    }
+    s.notifySwap( curLen, c )
+    return
+}
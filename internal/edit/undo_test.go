@@ -0,0 +1,161 @@
+package edit
+
+import (
+    "fmt"
+    "reflect"
+    "testing"
+)
+
+// make the undo/redo tree:
+//  0 "abc" -> 1 "Xabc" -> 2 "XYabc"
+//          |          `-> 4 "XaZbc" -> 5 "XaZb"
+//          `-> 3 "ab"
+func makeTestTree( t *testing.T ) *Storage {
+    t.Helper()
+    s, _ := newTestStorage( t, "abc" )
+    steps := []func( ) error{
+        func( ) error { return s.InsertBytesAt( 0, 1, []byte("X") ) },
+        func( ) error { return s.InsertBytesAt( 1, 2, []byte("Y") ) },
+        func( ) error { _, _, err := s.Undo(); return err },
+        func( ) error { _, _, err := s.Undo(); return err },
+        func( ) error { return s.DeleteBytesAt( 2, 3, 1 ) },
+        func( ) error { _, err := s.JumpTo( 1 ); return err },
+        func( ) error { return s.InsertBytesAt( 2, 4, []byte("Z") ) },
+        func( ) error { return s.DeleteBytesAt( 4, 5, 1 ) },
+    }
+    for i, step := range steps {
+        if err := step( ); err != nil {
+            t.Fatalf( "step %d: %v", i, err )
+        }
+        s.CloseRun( )
+    }
+    return s
+}
+
+var testTreeStates = []string{ "abc", "Xabc", "XYabc", "ab", "XaZbc", "XaZb" }
+
+func TestUndoTree( t *testing.T ) {
+    s := makeTestTree( t )
+    nodes, current := s.GetUndoTree( )
+    want := []UndoNode{
+        { -1, 0, 0, []int{ 1, 3 } },
+        { 0, 0, 1, []int{ 2, 4 } },
+        { 1, 1, 2, nil },
+        { 0, 2, 3, nil },
+        { 1, 2, 4, []int{ 5 } },
+        { 4, 4, 5, nil },
+    }
+    if current != 5 || ! reflect.DeepEqual( nodes, want ) {
+        t.Errorf( "got tree %v at %d, want %v at 5\n", nodes, current, want )
+    }
+}
+
+func TestJumpTo( t *testing.T ) {
+    s := makeTestTree( t )
+    tests := []struct {
+        id              int
+        pos             int64
+    }{
+        { 2, 1 },                       // across branches
+        { 3, 2 },                       // back to root, then another branch
+        { 3, 0 },                       // no move
+        { 0, 2 },                       // undo only
+        { 5, 4 },                       // redo only
+        { 4, 4 },
+        { 1, 2 },
+    }
+    for _, test := range tests {
+        pos, err := s.JumpTo( test.id )
+        if err != nil {
+            t.Fatalf( "JumpTo %d: %v", test.id, err )
+        }
+        if _, current := s.GetUndoTree(); current != test.id {
+            t.Fatalf( "JumpTo %d: current is %d\n", test.id, current )
+        }
+        checkData( t, s, testTreeStates[test.id], "JumpTo" )
+        if test.pos != 0 && pos != test.pos {
+            t.Errorf( "JumpTo %d: position %d, want %d\n",
+                      test.id, pos, test.pos )
+        }
+    }
+    if _, err := s.JumpTo( 6 ); err == nil {
+        t.Errorf( "JumpTo invalid node succeeded\n" )
+    }
+    checkData( t, s, testTreeStates[1], "invalid JumpTo" )
+}
+
+func TestBranches( t *testing.T ) {
+    s := makeTestTree( t )
+    if _, err := s.JumpTo( 1 ); err != nil {
+        t.Fatal( err )
+    }
+    // redo follows the branch last undone, unless another one is selected
+    tests := []struct {
+        selected        int             // -1 to keep the current selection
+        want            string
+        tag             int64
+    }{
+        { -1, "XaZbc", 4 },
+        { 0, "XYabc", 2 },
+        { -1, "XYabc", 2 },
+        { 1, "XaZbc", 4 },
+    }
+    for _, test := range tests {
+        if test.selected >= 0 {
+            if err := s.SelectBranch( test.selected ); err != nil {
+                t.Fatal( err )
+            }
+        }
+        branches, selected := s.GetBranches( )
+        if ! reflect.DeepEqual( branches, []int{ 2, 4 } ) ||
+           (test.selected >= 0 && selected != test.selected) {
+            t.Fatalf( "got branches %v, %d\n", branches, selected )
+        }
+        _, tag, err := s.Redo( )
+        if err != nil {
+            t.Fatal( err )
+        }
+        checkData( t, s, test.want, "redo" )
+        if tag != test.tag {
+            t.Errorf( "redo: tag %d, want %d\n", tag, test.tag )
+        }
+        if _, _, err := s.Undo(); err != nil {
+            t.Fatal( err )
+        }
+    }
+    for _, index := range []int{ -1, 2 } {
+        if err := s.SelectBranch( index ); err == nil {
+            t.Errorf( "SelectBranch %d succeeded\n", index )
+        }
+    }
+}
+
+func TestBranchesInGroup( t *testing.T ) {
+    s := makeTestTree( t )
+    if _, err := s.JumpTo( 1 ); err != nil {
+        t.Fatal( err )
+    }
+    s.SelectBranch( 0 )
+    nodes, _ := s.GetUndoTree( )
+    s.BeginGroup( 0 )
+    s.InsertBytesAt( 0, 0, []byte("abc") )
+    if _, err := s.JumpTo( 0 ); err == nil {
+        t.Errorf( "JumpTo within a group succeeded\n" )
+    }
+    if err := s.SelectBranch( 0 ); err == nil {
+        t.Errorf( "SelectBranch within a group succeeded\n" )
+    }
+    s.DeleteBytesAt( 1, 0, 2 )
+    if err := s.AbortGroup( ); err != nil {
+        t.Fatal( err )
+    }
+    checkData( t, s, testTreeStates[1], "AbortGroup" )
+    after, current := s.GetUndoTree( )
+    if current != 1 || fmt.Sprint( after ) != fmt.Sprint( nodes ) {
+        t.Errorf( "AbortGroup: tree %v at %d, want %v at 1\n",
+                  after, current, nodes )
+    }
+    if _, selected := s.GetBranches(); selected != 0 {
+        t.Errorf( "AbortGroup: branch %d selected, want 0\n", selected )
+    }
+}
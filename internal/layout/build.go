@@ -10,6 +10,7 @@
 // can be:
 //  - a presentation of constant value, boolean, integer or text.
 //  - a presentation of an input field, boolean, integer, text or button.
+//  - a scrollable list of rows, made of text columns.
 //  - a container of widgets, box or grid.
 //
 // Each widget has a name and a horizontal padding on the left side. Widgets
@@ -28,6 +29,7 @@ import (
 
 	"github.com/gotk3/gotk3/gtk"
 	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
 )
 
 /*
@@ -216,6 +218,29 @@ type StrList struct {
     KeyPress    func( name string, key uint, mod KeyModifier) bool
 }
 
+/*
+    List:
+
+        Scrollable list of rows, all made of the same columns. Each column has
+        a title shown above the list, and each row has a text per column, given
+        as markup. Rows are appended or cleared after creation, through the
+        list value, and a row can be activated by the user with a double click
+        or the return key.
+*/
+type ListDef struct {
+    Name        string          // used to manipulate item after creation
+    Padding     uint            // left padding in parent box or cell
+    Columns     []ListColDef    // list of column definitions
+    Format      *TextFmt        // presentation format (all columns)
+    Activated   func( name string, row int ) bool // row activation
+}
+
+// List column definition (title and text alignment in column)
+type ListColDef struct {
+    Title       string          // column title
+    Align       AlignAttr       // how to align text in column
+}
+
 // Button behavior control (enabled, press or toggle)
 type ButtonCtl struct {
     Enable      bool            // initial enabled state
@@ -785,6 +810,95 @@ func (lo *Layout) addConstItem( def *ConstDef,
     return itemRef, nil
 }
 
+// apply format attributes and alignment to all texts rendered by renderer
+func setRendererFormat( renderer *gtk.CellRendererText,
+                        format *TextFmt, align AlignAttr ) (err error) {
+    if format != nil {
+        if format.Attributes & MONOSPACE == MONOSPACE {
+            err = renderer.SetProperty( "family", "monospace" )
+        }
+        if err == nil && format.Attributes & BOLD == BOLD {
+            err = renderer.SetProperty( "weight", 700 )
+        }
+        if err == nil && format.Attributes & ITALIC == ITALIC {
+            err = renderer.SetProperty( "style", 2 )    // PANGO_STYLE_ITALIC
+        }
+    }
+    if err == nil {
+        var xAlign float32
+        switch align {
+        case CENTER:
+            xAlign = 0.5
+        case RIGHT:
+            xAlign = 1.0
+        }
+        err = renderer.SetProperty( "xalign", xAlign )
+    }
+    return
+}
+
+func (lo *Layout) addListItem( def *ListDef ) (*itemReference, error) {
+    types := make( []glib.Type, len(def.Columns) )
+    for i := range types {
+        types[i] = glib.TYPE_STRING
+    }
+    store, err := gtk.ListStoreNew( types... )
+    if err != nil {
+        return nil, fmt.Errorf("addListItem: Could not create store: %v", err)
+    }
+    view, err := gtk.TreeViewNewWithModel( store )
+    if err != nil {
+        return nil, fmt.Errorf("addListItem: Could not create view: %v", err)
+    }
+    dl := &DataList{ store: store, view: view }
+    for i, colDef := range def.Columns {
+        renderer, err := gtk.CellRendererTextNew( )
+        if err != nil {
+            return nil,
+                   fmt.Errorf("addListItem: Could not create renderer: %v", err)
+        }
+        err = setRendererFormat( renderer, def.Format, colDef.Align )
+        if err != nil {
+            return nil,
+                   fmt.Errorf("addListItem: Could not set format: %v", err)
+        }
+        column, err := gtk.TreeViewColumnNewWithAttribute( colDef.Title,
+                                                   renderer, "markup", i )
+        if err != nil {
+            return nil,
+                   fmt.Errorf("addListItem: Could not create column: %v", err)
+        }
+        column.SetResizable( true )
+        view.AppendColumn( column )
+        dl.columns = append( dl.columns, column )
+    }
+    if def.Activated != nil {
+        view.Connect( "row-activated", func( tv *gtk.TreeView ) {
+            if path, _ := tv.GetCursor(); path != nil {
+                if indices := path.GetIndices(); len(indices) > 0 {
+                    def.Activated( def.Name, indices[0] )
+                }
+            }
+        } )
+    }
+    scrolled, err := gtk.ScrolledWindowNew( nil, nil )
+    if err != nil {
+        return nil,
+               fmt.Errorf("addListItem: Could not create scrolled window: %v",
+                          err)
+    }
+    scrolled.SetPolicy( gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC )
+    scrolled.Add( view )
+    if def.Name != "" {
+        lo.access[def.Name] = &itemReference{ def.Format, false, dl }
+    }
+    if def.Padding > 0 {
+        return &itemReference{ def.Format, false,
+                        wrapChildInHorizontalBox( scrolled, def.Padding )}, nil
+    }
+    return &itemReference{ def.Format, false, scrolled }, nil
+}
+
 func wrapInFrame( w gtk.IWidget,
                   title string, border bool ) (*gtk.Frame, error) {
 
@@ -820,6 +934,8 @@ func (lo *Layout)addBoxItem( def * BoxDef ) (*itemReference, error) {
             itemRef, err = lo.addConstItem( itemDef, def.Direction )
         case *InputDef:
             itemRef, err = lo.addInputItem( itemDef )
+        case *ListDef:
+            itemRef, err = lo.addListItem( itemDef )
         default:
             return nil, fmt.Errorf("addBoxItem: unsupported type %T\n", itemDef)
         }
@@ -871,6 +987,8 @@ func (lo *Layout)addItemToGrid( dg *DataGrid, c, r int,
         itemRef, err = lo.addConstItem( itemDef, HORIZONTAL )
     case *InputDef:
         itemRef, err = lo.addInputItem( itemDef )
+    case *ListDef:
+        itemRef, err = lo.addListItem( itemDef )
     default:
         return fmt.Errorf( "addItem: unsupported type %T\n", itemDef )
         
@@ -904,6 +1022,15 @@ type DataGrid struct {
     rowItems    [][]*itemReference
 }
 
+// DataList is an opaque data type used to refer to a specific list in a Layout.
+// It is returned by GetItemValue when the item name matches a list definition.
+// It is used with AppendRow, Clear and SetColumnTitle to update the list.
+type DataList struct {
+    store       *gtk.ListStore
+    view        *gtk.TreeView
+    columns     []*gtk.TreeViewColumn
+}
+
 // Layout is an opaque data type used to refer to the whole widget layout.
 type Layout struct {
     root   gtk.IWidget
@@ -967,6 +1094,8 @@ func NewLayout( def interface{} ) (layout *Layout, err error) {
         itemRef, err = layout.addConstItem( def, HORIZONTAL )
     case *InputDef:
         itemRef, err = layout.addInputItem( def )
+    case *ListDef:
+        itemRef, err = layout.addListItem( def )
     default:
         return nil, fmt.Errorf( "makeLayout: unsupported type %T\n", def )
     }
@@ -63,6 +63,38 @@ func (dg *DataGrid)SetColVisible( index int, visible bool ) error {
     return nil
 }
 
+// AppendRow appends a row at the end of the list, with the given values, one
+// markup text per column. It returns an error if the number of values does not
+// match the number of columns.
+func (dl *DataList)AppendRow( values ...string ) error {
+    if len(values) != len(dl.columns) {
+        return fmt.Errorf( "AppendRow: %d values for %d columns\n",
+                           len(values), len(dl.columns) )
+    }
+    columns := make( []int, len(values) )
+    data := make( []interface{}, len(values) )
+    for i, v := range values {
+        columns[i] = i
+        data[i] = v
+    }
+    return dl.store.Set( dl.store.Append( ), columns, data )
+}
+
+// Clear removes all rows from the list.
+func (dl *DataList)Clear( ) {
+    dl.store.Clear( )
+}
+
+// SetColumnTitle sets the title of the column specified by the argument index.
+// It returns an error if index is out of range.
+func (dl *DataList)SetColumnTitle( index int, title string ) error {
+    if index < 0 || index >= len(dl.columns) {
+        return fmt.Errorf( "SetColumnTitle: column %d out of range\n", index )
+    }
+    dl.columns[index].SetTitle( title )
+    return nil
+}
+
 func (lo *Layout)getButton( name string ) (*TextFmt, *gtk.Button, error) {
     ref, ok := lo.access[name]
     if ! ok {
@@ -222,6 +254,8 @@ func (lo *Layout) GetItemValue( name string ) (interface{}, error) {
     switch item := ref.item.(type) {
     case *DataGrid:
         return item, nil
+    case *DataList:
+        return item, nil
     case *gtk.CheckButton:
         return item.ToggleButton.GetActive(), nil
 
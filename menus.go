@@ -33,30 +33,43 @@ const (
 
     ENABLE_UNDO = false
     ENABLE_REDO = false
+    ENABLE_BRANCH = false
+    ENABLE_HISTORY = false
     ENABLE_PROTECT = false
     ENABLE_CUT = false
     ENABLE_COPY = false
     ENABLE_PASTE = false
     ENABLE_DELETE = false
+    ENABLE_FILL = false
     ENABLE_SELECT_ALL = false
     ENABLE_EXPLORE = false
+    ENABLE_CHECKSUM = false
+    ENABLE_ANALYSIS = false
     ENABLE_PREFERENCES = true
 
     ENABLE_TOOL_BAR = true
     ENABLE_STATUS_BAR = true
+    ENABLE_MINIMAP = true
     ENABLE_LARGER = false
     ENABLE_SMALLER = false
     ENABLE_NORMAL = false
 
     ENABLE_FIND = false
     ENABLE_REPLACE = false
+    ENABLE_FIND_SELECTION = false
+    ENABLE_FIND_ALL = false
     ENABLE_GOTO = false
+    ENABLE_NEXT_CHANGE = false
+    ENABLE_PREVIOUS_CHANGE = false
+
+    ENABLE_OPERATIONS = false
 
     ENABLE_CONTENTS = true
     ENABLE_ABOUT = true
 )
 
-func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
+func getMenuDefs( enableStatus, enableTool,
+                  enableMinimap, minimapClasses bool ) (int, *[]layout.MenuItemDef) {
 
     menuResIds = make( map[string]menuTextIds )
     noAccel := layout.AccelCode{ 0, 0, 0 }
@@ -114,16 +127,21 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
     }
 
     xpl := func () {
-        showExploreDialog( getBytesAtCaret( 0 ) )
+        if data, pos := getBytesAtCaret( MAX_EXPLORE_LENGTH ); data != nil {
+            showExploreDialog( data, pos )
+        }
     }
 
     menuResIds["undo"] = menuTextIds{ menuEditUndo, menuEditUndoHelp }
     menuResIds["redo"] = menuTextIds{ menuEditRedo, menuEditRedoHelp }
+    menuResIds["branch"] = menuTextIds{ menuEditRedoBranch, menuEditRedoBranchHelp }
+    menuResIds["history"] = menuTextIds{ menuEditHistory, menuEditHistoryHelp }
 // "protect" is treated as a special case
     menuResIds["cut"] = menuTextIds{ menuEditCut, menuEditCutHelp }
     menuResIds["copy"] = menuTextIds{ menuEditCopy, menuEditCopyHelp }
     menuResIds["paste"] = menuTextIds{ menuEditPaste, menuEditPasteHelp }
     menuResIds["delete"] = menuTextIds{ menuEditDelete, menuEditDeleteHelp }
+    menuResIds["fill"] = menuTextIds{ menuEditFill, menuEditFillHelp }
     menuResIds["selectAll"] = menuTextIds{ menuEditSelect, menuEditSelectHelp }
     menuResIds["preferences"] = menuTextIds{ menuEditPreferences, menuEditPreferencesHelp }
 
@@ -134,6 +152,12 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
         { "redo", localizeText(menuEditRedo), localizeText(menuEditRedoHelp),
           nil, redoLast, layout.AccelCode{ 'z', gdk.CONTROL_MASK | gdk.SHIFT_MASK,
           gtk.ACCEL_VISIBLE }, ENABLE_REDO, false, false },
+        { "branch", localizeText(menuEditRedoBranch),
+          localizeText(menuEditRedoBranchHelp), nil, nextRedoBranch,
+          noAccel, ENABLE_BRANCH, false, false },
+        { "history", localizeText(menuEditHistory),
+          localizeText(menuEditHistoryHelp), nil, undoHistoryDialog,
+          noAccel, ENABLE_HISTORY, false, false },
         separator,
         { "protect", localizeText(menuEditModify), localizeText(menuEditModifyHelp),
           nil, prtct, noAccel, ENABLE_PROTECT, false, false },
@@ -150,6 +174,8 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
         { "delete", localizeText(menuEditDelete), localizeText(menuEditDeleteHelp),
           nil, deleteSelection, layout.AccelCode{ gdk.KEY_Delete, 0,
           gtk.ACCEL_VISIBLE }, ENABLE_DELETE, false, false },
+        { "fill", localizeText(menuEditFill), localizeText(menuEditFillHelp),
+          nil, fillDialog, noAccel, ENABLE_FILL, false, false },
         separator,
         { "selectAll", localizeText(menuEditSelect), localizeText(menuEditSelectHelp),
           nil, selectAll, layout.AccelCode{ 'a', gdk.CONTROL_MASK,
@@ -162,6 +188,9 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
 
     menuResIds["toolbar"] = menuTextIds{ menuViewToolbar, menuViewToolbarHelp }
     menuResIds["statusbar"] = menuTextIds{ menuViewStatusbar, menuViewStatusbarHelp }
+    menuResIds["minimap"] = menuTextIds{ menuViewMinimap, menuViewMinimapHelp }
+    menuResIds["minimapClasses"] = menuTextIds{ menuViewMinimapClasses,
+                                                menuViewMinimapClassesHelp }
     menuResIds["larger"] = menuTextIds{ menuViewLarger, menuViewLargerHelp }
     menuResIds["smaller"] = menuTextIds{ menuViewSmaller, menuViewSmallerHelp }
     menuResIds["normal"] = menuTextIds{ menuViewNormal, menuViewNormalHelp }
@@ -173,6 +202,12 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
         { "statusbar", localizeText(menuViewStatusbar),
           localizeText(menuViewStatusbarHelp), nil, updateStatusbarVisibility,
           noAccel, ENABLE_STATUS_BAR, true, enableStatus },
+        { "minimap", localizeText(menuViewMinimap),
+          localizeText(menuViewMinimapHelp), nil, updateMinimapVisibility,
+          noAccel, ENABLE_MINIMAP, true, enableMinimap },
+        { "minimapClasses", localizeText(menuViewMinimapClasses),
+          localizeText(menuViewMinimapClassesHelp), nil, updateMinimapMode,
+          noAccel, ENABLE_MINIMAP, true, minimapClasses },
         { "larger", localizeText(menuViewLarger), localizeText(menuViewLargerHelp),
           nil, increaseFontSize, layout.AccelCode{ '+', gdk.CONTROL_MASK,
           gtk.ACCEL_VISIBLE }, ENABLE_LARGER, false, false },
@@ -186,8 +221,19 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
 
     menuResIds["find"] = menuTextIds{ menuSearchFind, menuSearchFindHelp }
     menuResIds["replace"] = menuTextIds{ menuSearchReplace, menuSearchReplaceHelp }
+    menuResIds["findSelection"] = menuTextIds{ menuSearchFindSelection,
+                                               menuSearchFindSelectionHelp }
+    menuResIds["findAll"] = menuTextIds{ menuSearchFindAll, menuSearchFindAllHelp }
     menuResIds["goto"] = menuTextIds{ menuSearchGoto, menuSearchGotoHelp }
+    menuResIds["nextChange"] = menuTextIds{ menuSearchNextChange,
+                                            menuSearchNextChangeHelp }
+    menuResIds["previousChange"] = menuTextIds{ menuSearchPreviousChange,
+                                                menuSearchPreviousChangeHelp }
     menuResIds["explore"] = menuTextIds{ menuSearchExplore, menuSearchExploreHelp }
+    menuResIds["checksum"] = menuTextIds{ menuSearchChecksum,
+                                          menuSearchChecksumHelp }
+    menuResIds["analysis"] = menuTextIds{ menuSearchAnalysis,
+                                          menuSearchAnalysisHelp }
 
     var searchMenuDef = []layout.MenuItemDef {
         { "find", localizeText(menuSearchFind), localizeText(menuSearchFindHelp),
@@ -197,14 +243,87 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
           localizeText(menuSearchReplaceHelp), nil, replaceDialog,
           layout.AccelCode{ 'h', gdk.CONTROL_MASK, gtk.ACCEL_VISIBLE },
           ENABLE_REPLACE, false, false },
+        { "findSelection", localizeText(menuSearchFindSelection),
+          localizeText(menuSearchFindSelectionHelp), nil, findSelection,
+          layout.AccelCode{ gdk.KEY_F3, gdk.CONTROL_MASK, gtk.ACCEL_VISIBLE },
+          ENABLE_FIND_SELECTION, false, false },
+        { "findAll", localizeText(menuSearchFindAll),
+          localizeText(menuSearchFindAllHelp), nil, findAll,
+          layout.AccelCode{ 'f', gdk.CONTROL_MASK | gdk.SHIFT_MASK,
+          gtk.ACCEL_VISIBLE }, ENABLE_FIND_ALL, false, false },
         separator,
         { "goto", localizeText(menuSearchGoto), localizeText(menuSearchGotoHelp),
           nil, gotoDialog, layout.AccelCode{ 'j', gdk.CONTROL_MASK,
           gtk.ACCEL_VISIBLE }, ENABLE_GOTO, false, false },
+        { "nextChange", localizeText(menuSearchNextChange),
+          localizeText(menuSearchNextChangeHelp), nil, gotoNextChange,
+          layout.AccelCode{ gdk.KEY_F8, 0, gtk.ACCEL_VISIBLE },
+          ENABLE_NEXT_CHANGE, false, false },
+        { "previousChange", localizeText(menuSearchPreviousChange),
+          localizeText(menuSearchPreviousChangeHelp), nil, gotoPreviousChange,
+          layout.AccelCode{ gdk.KEY_F8, gdk.SHIFT_MASK, gtk.ACCEL_VISIBLE },
+          ENABLE_PREVIOUS_CHANGE, false, false },
         separator,
         { "explore", localizeText(menuSearchExplore), localizeText(menuSearchExploreHelp),
           nil, xpl, layout.AccelCode{ 'e', gdk.CONTROL_MASK | gdk.MOD1_MASK,
           gtk.ACCEL_VISIBLE }, ENABLE_EXPLORE, false, false },
+        { "checksum", localizeText(menuSearchChecksum),
+          localizeText(menuSearchChecksumHelp), nil, checksumDialog,
+          noAccel, ENABLE_CHECKSUM, false, false },
+        { "analysis", localizeText(menuSearchAnalysis),
+          localizeText(menuSearchAnalysisHelp), nil, analysisDialog,
+          noAccel, ENABLE_ANALYSIS, false, false },
+    }
+
+    menuResIds["xor"] = menuTextIds{ menuOperationsXor, menuOperationsXorHelp }
+    menuResIds["and"] = menuTextIds{ menuOperationsAnd, menuOperationsAndHelp }
+    menuResIds["or"] = menuTextIds{ menuOperationsOr, menuOperationsOrHelp }
+    menuResIds["not"] = menuTextIds{ menuOperationsNot, menuOperationsNotHelp }
+    menuResIds["shiftLeft"] = menuTextIds{ menuOperationsShiftLeft,
+                                           menuOperationsShiftLeftHelp }
+    menuResIds["shiftRight"] = menuTextIds{ menuOperationsShiftRight,
+                                            menuOperationsShiftRightHelp }
+    menuResIds["rotateLeft"] = menuTextIds{ menuOperationsRotateLeft,
+                                            menuOperationsRotateLeftHelp }
+    menuResIds["rotateRight"] = menuTextIds{ menuOperationsRotateRight,
+                                             menuOperationsRotateRightHelp }
+    menuResIds["add"] = menuTextIds{ menuOperationsAdd, menuOperationsAddHelp }
+    menuResIds["subtract"] = menuTextIds{ menuOperationsSubtract,
+                                          menuOperationsSubtractHelp }
+
+    var operationsMenuDef = []layout.MenuItemDef {
+        { "xor", localizeText(menuOperationsXor),
+          localizeText(menuOperationsXorHelp), nil, xorSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        { "and", localizeText(menuOperationsAnd),
+          localizeText(menuOperationsAndHelp), nil, andSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        { "or", localizeText(menuOperationsOr),
+          localizeText(menuOperationsOrHelp), nil, orSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        { "not", localizeText(menuOperationsNot),
+          localizeText(menuOperationsNotHelp), nil, notSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        separator,
+        { "shiftLeft", localizeText(menuOperationsShiftLeft),
+          localizeText(menuOperationsShiftLeftHelp), nil, shiftLeftSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        { "shiftRight", localizeText(menuOperationsShiftRight),
+          localizeText(menuOperationsShiftRightHelp), nil, shiftRightSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        { "rotateLeft", localizeText(menuOperationsRotateLeft),
+          localizeText(menuOperationsRotateLeftHelp), nil, rotateLeftSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        { "rotateRight", localizeText(menuOperationsRotateRight),
+          localizeText(menuOperationsRotateRightHelp), nil, rotateRightSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        separator,
+        { "add", localizeText(menuOperationsAdd),
+          localizeText(menuOperationsAddHelp), nil, addToSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
+        { "subtract", localizeText(menuOperationsSubtract),
+          localizeText(menuOperationsSubtractHelp), nil, subtractFromSelection,
+          noAccel, ENABLE_OPERATIONS, false, false },
     }
 
     menuResIds["contents"] = menuTextIds{ menuHelpContent, menuHelpContentHelp }
@@ -221,6 +340,7 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
     menuResIds["edit"] = menuTextIds{ menuEdit, -1 }
     menuResIds["view"] = menuTextIds{ menuView, -1 }
     menuResIds["search"] = menuTextIds{ menuSearch, -1 }
+    menuResIds["operations"] = menuTextIds{ menuOperations, -1 }
     menuResIds["help"] = menuTextIds{ menuHelp, -1 }
 
     var menuDef = []layout.MenuItemDef {
@@ -232,6 +352,8 @@ func getMenuDefs( enableStatus, enableTool bool ) (int, *[]layout.MenuItemDef) {
           noAccel, true, false, false },
         { "search", localizeText(menuSearch), "", &searchMenuDef, nil,
           noAccel, true, false, false },
+        { "operations", localizeText(menuOperations), "", &operationsMenuDef,
+          nil, noAccel, true, false, false },
         { "help", localizeText(menuHelp), "", &helpMenuDef, nil,
           noAccel, true, false, false },
     }
@@ -359,8 +481,11 @@ func initMenus( protect bool ) (*gtk.AccelGroup, *gtk.MenuBar) {
     protectState = protect
     enableStatusbar := getBoolPreference( STATUS_BAR )
     enableToolbar := getBoolPreference( TOOL_BAR )
+    enableMinimap := getBoolPreference( MINIMAP )
+    minimapClasses := getBoolPreference( MINIMAP_CLASSES )
 
-    nItems, menuTreeDef := getMenuDefs( enableStatusbar, enableToolbar )
+    nItems, menuTreeDef := getMenuDefs( enableStatusbar, enableToolbar,
+                                        enableMinimap, minimapClasses )
     accel, menubar := layout.InitMenuBar( nItems, menuTreeDef, (*menuHint)(nil) )
     initFileHistory()
     if fileHistory.Depth() > 0 {
@@ -558,7 +683,12 @@ func dataExists( state bool ) {
     toolLayout.SetButtonActive( "find", state )
     layout.EnableMenuItem( "replace", state )
     toolLayout.SetButtonActive( "replace", state )
+    layout.EnableMenuItem( "findAll", state )
     layout.EnableMenuItem( "goto", state )
+    layout.EnableMenuItem( "nextChange", state )
+    layout.EnableMenuItem( "previousChange", state )
+    layout.EnableMenuItem( "checksum", state )
+    layout.EnableMenuItem( "analysis", state )
 }
 
 func pasteDataExists( state bool ) {
@@ -574,6 +704,18 @@ func selectionDataExists( enableState bool, readOnly bool ) {
     layout.EnableMenuItem( "cut", enableState && ! readOnly && hasPageFocus() )
     toolLayout.SetButtonActive( "cut", enableState && ! readOnly && hasPageFocus() )
     layout.EnableMenuItem( "delete", enableState && ! readOnly &&hasPageFocus() )
+    layout.EnableMenuItem( "findSelection", enableState )
+    layout.EnableMenuItem( "fill", ! readOnly && hasPageFocus() )
+    enableOperations( enableState && ! readOnly && hasPageFocus() )
+}
+
+func enableOperations( state bool ) {
+    for _, name := range []string{ "xor", "and", "or", "not",
+                                   "shiftLeft", "shiftRight",
+                                   "rotateLeft", "rotateRight",
+                                   "add", "subtract" } {
+        layout.EnableMenuItem( name, state )
+    }
 }
 
 func undoRedoUpdate( undo, redo bool ) {
@@ -581,6 +723,14 @@ func undoRedoUpdate( undo, redo bool ) {
     toolLayout.SetButtonActive( "undo", undo )
     layout.EnableMenuItem( "redo", redo )
     toolLayout.SetButtonActive( "redo", redo )
+    // alternative branches exist only if redo is possible
+    branches := false
+    if pc := getCurrentWorkAreaPageContext(); pc != nil && redo {
+        b, _ := pc.store.GetBranches()
+        branches = len(b) > 1
+    }
+    layout.EnableMenuItem( "branch", branches )
+    layout.EnableMenuItem( "history", undo || redo )
 }
 
 func modificationAllowed( enableState, modificationState bool ) {
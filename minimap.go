@@ -0,0 +1,376 @@
+package main
+
+import (
+    "log"
+    "math"
+
+    "internal/edit"
+    "internal/layout"
+
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/cairo"
+)
+
+/*
+    The minimap is a narrow strip beside the page scrollbar, giving an overview
+    of the whole data. Data is split in blocks, up to MINIMAP_MAX_BLOCKS, each
+    block being coloured either by its entropy or by its dominant byte class
+    (zeros, ascii or high bytes), according to preferences. Modified ranges and
+    search matches are marked over the blocks, as well as the visible part of
+    the page. Clicking or dragging in the strip scrolls the page.
+
+    Blocks are calculated in the background, a limited number of bytes at a
+    time when the main loop is idle, so that opening a large file stays fast.
+    After a data change, only the blocks covering the changed bytes are marked
+    dirty and calculated again, or all blocks from the change start if the data
+    length changed. Dirty blocks keep their previous value, which is drawn
+    until they are calculated again, so that the strip does not blank out
+    while editing. When the number of blocks changes, each new block starts
+    with the value of the old block at the same relative place.
+*/
+
+const (
+    MINIMAP_WIDTH = 24
+    MINIMAP_MIN_BLOCK = 256             // min bytes per block
+    MINIMAP_MAX_BLOCKS = 4096
+    MINIMAP_IDLE_BYTES = 1024 * 1024    // max bytes calculated in one go
+    MINIMAP_MARK_WIDTH = 6              // modified or match marks
+)
+
+// byte classes
+const (
+    ZERO_BYTES = iota
+    ASCII_BYTES
+    HIGH_BYTES
+    MIXED_BYTES
+)
+
+type minimapBlock struct {
+    entropy     float32             // in bits per byte
+    class       uint8
+    valid       bool                // has a value, even if dirty
+    dirty       bool                // must be calculated again
+}
+
+type minimap struct {
+    pc          *pageContext
+    area        *gtk.DrawingArea
+    blockSize   int64
+    blocks      []minimapBlock
+    nDirty      int                 // number of dirty blocks
+    next        int                 // next block to check for calculation
+    idle        glib.SourceHandle
+    running     bool                // idle source is active
+}
+
+func newMinimap( pc *pageContext ) (mm *minimap, err error) {
+    mm = &minimap{ pc: pc }
+    if mm.area, err = gtk.DrawingAreaNew(); err != nil {
+        return
+    }
+    mm.area.SetSizeRequest( MINIMAP_WIDTH, -1 )
+    mm.area.SetNoShowAll( ! getBoolPreference( MINIMAP ) )
+    return
+}
+
+func (mm *minimap) activate( ) {
+    mm.area.SetEvents( int(gdk.EXPOSURE_MASK | gdk.BUTTON_PRESS_MASK |
+                           gdk.BUTTON1_MOTION_MASK ) )
+    mm.area.Connect( "draw", mm.draw )
+    mm.area.Connect( "button_press_event", mm.buttonPress )
+    mm.area.Connect( "motion-notify-event", mm.motion )
+    mm.pc.store.AddNotifyDataChange( mm.update )
+    mm.invalidate( 0, mm.pc.store.Length() )
+}
+
+// stop calculating blocks, before the page is removed
+func (mm *minimap) stop( ) {
+    if mm.running {
+        glib.SourceRemove( mm.idle )
+        mm.running = false
+    }
+}
+
+// replace all blocks with nBlocks dirty blocks of blockSize bytes, each new
+// block keeping the value of the old block at the same relative place.
+func (mm *minimap) resize( blockSize int64, nBlocks int ) {
+    blocks := make( []minimapBlock, nBlocks )
+    if n := len(mm.blocks); n > 0 {
+        for i := range blocks {
+            blocks[i] = mm.blocks[i * n / nBlocks]
+        }
+    }
+    for i := range blocks {
+        blocks[i].dirty = true
+    }
+    mm.blockSize = blockSize
+    mm.blocks = blocks
+    mm.nDirty = nBlocks
+    mm.next = 0
+}
+
+// calculate again the blocks covering the data segment [start:beyond[, after
+// adjusting the block size to the current data length.
+func (mm *minimap) invalidate( start, beyond int64 ) {
+    length := mm.pc.store.Length()
+    blockSize := (length + MINIMAP_MAX_BLOCKS - 1) / MINIMAP_MAX_BLOCKS
+    if blockSize < MINIMAP_MIN_BLOCK {
+        blockSize = MINIMAP_MIN_BLOCK
+    }
+    nBlocks := int((length + blockSize - 1) / blockSize)
+    if blockSize != mm.blockSize || nBlocks != len(mm.blocks) {
+        mm.resize( blockSize, nBlocks )
+    } else {
+        if beyond > length {
+            beyond = length
+        }
+        first := int(start / blockSize)
+        for i := first; int64(i) * blockSize < beyond; i++ {
+            if ! mm.blocks[i].dirty {
+                mm.blocks[i].dirty = true
+                mm.nDirty ++
+            }
+        }
+        if first < mm.next {
+            mm.next = first
+        }
+    }
+    if ! mm.running && mm.nDirty > 0 {
+        mm.idle = glib.IdleAdd( mm.calculate )
+        mm.running = true
+    }
+    mm.area.QueueDraw( )
+}
+
+// called each time data changes in the page storage. If the data length did
+// not change, only the changed bytes need calculating again, otherwise all
+// bytes after the change start have moved.
+func (mm *minimap) update( c edit.Change ) {
+    switch {
+    case c.Kind == edit.RELOAD:
+        mm.invalidate( 0, mm.pc.store.Length() )
+    case c.OldLength == c.NewLength:
+        mm.invalidate( c.Start, c.Start + c.NewLength )
+    default:
+        mm.invalidate( c.Start, mm.pc.store.Length() )
+    }
+}
+
+func getByteClass( counts *[256]int64, total int64 ) uint8 {
+    var zero, ascii int64
+    zero = counts[0]
+    for v := 0x20; v < 0x7f; v++ {
+        ascii += counts[v]
+    }
+    ascii += counts['\t'] + counts['\n'] + counts['\r']
+    high := total - zero - ascii
+    switch {
+    case zero * 2 > total:
+        return ZERO_BYTES
+    case ascii * 4 > total * 3:
+        return ASCII_BYTES
+    case high * 2 > total:
+        return HIGH_BYTES
+    }
+    return MIXED_BYTES
+}
+
+// calculate at most MINIMAP_IDLE_BYTES of dirty blocks, and return true if
+// more blocks remain to be calculated.
+func (mm *minimap) calculate( ) bool {
+    length := mm.pc.store.Length()
+    for done := int64(0); done < MINIMAP_IDLE_BYTES &&
+                          mm.next < len(mm.blocks); mm.next++ {
+        if ! mm.blocks[mm.next].dirty {
+            continue
+        }
+        start := int64(mm.next) * mm.blockSize
+        beyond := start + mm.blockSize
+        if beyond > length {
+            beyond = length
+        }
+        var counts [256]int64
+        for _, b := range mm.pc.store.GetData( start, beyond ) {
+            counts[b] ++
+        }
+        total := beyond - start
+        mm.blocks[mm.next] = minimapBlock{
+                                float32(getEntropy( &counts, total )),
+                                getByteClass( &counts, total ), true, false }
+        mm.nDirty --
+        done += total
+    }
+    mm.area.QueueDraw( )
+    if mm.nDirty > 0 {
+        if mm.next >= len(mm.blocks) {
+            mm.next = 0
+        }
+        return true
+    }
+    log.Printf( "minimap: %d blocks calculated\n", len(mm.blocks) )
+    mm.running = false
+    return false
+}
+
+// set the color for entropy e, in bits per byte: from dark blue for low
+// entropy through green to red for high entropy.
+func setEntropyColor( cr *cairo.Context, e float64 ) {
+    x := e / 8
+    cr.SetSourceRGB( math.Max( 0, 2 * x - 1 ),
+                     1 - math.Abs( 2 * x - 1 ),
+                     math.Max( 0, 1 - 2 * x ) * 0.6 )
+}
+
+var byteClassColors = [MIXED_BYTES+1][3]float64 {
+    { 0.1, 0.1, 0.1 },                  // ZERO_BYTES
+    { 0.2, 0.5, 0.9 },                  // ASCII_BYTES
+    { 0.9, 0.3, 0.2 },                  // HIGH_BYTES
+    { 0.5, 0.5, 0.5 },                  // MIXED_BYTES
+}
+
+func (mm *minimap) draw( da *gtk.DrawingArea, cr *cairo.Context ) {
+    w := float64(da.GetAllocatedWidth())
+    h := float64(da.GetAllocatedHeight())
+    setHexBackgroundColor( cr )
+    cr.Rectangle( 0, 0, w, h )
+    cr.Fill( )
+
+    length := mm.pc.store.Length()
+    n := len(mm.blocks)
+    if n == 0 || length == 0 {
+        return
+    }
+
+    // one line per pixel, each line is made of one or more blocks
+    byClass := getBoolPreference( MINIMAP_CLASSES )
+    for y := 0; y < int(h); y++ {
+        first := int( int64(y) * int64(n) / int64(h) )
+        beyond := int( int64(y + 1) * int64(n) / int64(h) )
+        if beyond <= first {
+            beyond = first + 1
+        }
+        if beyond > n {
+            beyond = n
+        }
+        var classes [MIXED_BYTES+1]int
+        class := 0
+        var e float64
+        valid := 0
+        for _, b := range mm.blocks[first:beyond] {
+            if ! b.valid {              // never calculated yet
+                continue
+            }
+            valid ++
+            e += float64(b.entropy)
+            classes[b.class] ++
+            if classes[b.class] > classes[class] {
+                class = int(b.class)
+            }
+        }
+        if valid == 0 {
+            continue
+        }
+        if byClass {
+            c := byteClassColors[class]
+            cr.SetSourceRGB( c[0], c[1], c[2] )
+        } else {
+            setEntropyColor( cr, e / float64(valid) )
+        }
+        cr.Rectangle( 0, float64(y), w, 1 )
+        cr.Fill( )
+    }
+
+    scale := h / float64(length)
+    setModifiedColor( cr )
+    for _, r := range mm.pc.store.GetModifiedRanges() {
+        cr.Rectangle( 0, float64(r.Start) * scale, MINIMAP_MARK_WIDTH,
+                      math.Max( 1, float64(r.Length) * scale ) )
+    }
+    cr.Fill( )
+
+    if mm.pc.search {
+        _, array, sizes := getSearchMatches()
+        setOtherMatchesColor( cr )
+        for i, m := range array {
+            cr.Rectangle( w - MINIMAP_MARK_WIDTH, float64(m) * scale,
+                          MINIMAP_MARK_WIDTH,
+                          math.Max( 1, float64(sizes[i]) * scale ) )
+        }
+        cr.Fill( )
+    }
+
+    // frame the visible part of the page
+    adj := mm.pc.barAdjust
+    if upper := adj.GetUpper(); upper > 0 {
+        top := h * adj.GetValue() / upper
+        height := math.Max( 2, h * adj.GetPageSize() / upper )
+        setCaretColor( cr )
+        cr.SetLineWidth( 1 )
+        cr.Rectangle( 0.5, top + 0.5, w - 1, math.Min( height, h - top ) - 1 )
+        cr.Stroke( )
+    }
+}
+
+// scroll the page so that the position corresponding to the vertical
+// coordinate y in the strip is in the middle of the page.
+func (mm *minimap) scrollTo( da *gtk.DrawingArea, y float64 ) {
+    adj := mm.pc.barAdjust
+    upper := adj.GetUpper()
+    pageSize := adj.GetPageSize()
+    origin := upper * y / float64(da.GetAllocatedHeight()) - pageSize / 2
+    if origin > upper - pageSize {
+        origin = upper - pageSize
+    }
+    if origin < 0 {
+        origin = 0
+    }
+    adj.SetValue( origin )
+}
+
+func (mm *minimap) buttonPress( da *gtk.DrawingArea, event *gdk.Event ) bool {
+    buttonEvent := gdk.EventButtonNewFromEvent( event )
+    if buttonEvent.Button() != gdk.BUTTON_PRIMARY {
+        return false
+    }
+    mm.scrollTo( da, buttonEvent.Y() )
+    return true
+}
+
+func (mm *minimap) motion( da *gtk.DrawingArea, event *gdk.Event ) bool {
+    _, y := gdk.EventMotionNewFromEvent( event ).MotionVal()
+    mm.scrollTo( da, y )
+    return true
+}
+
+func (mm *minimap) setVisible( visible bool ) {
+    mm.area.SetNoShowAll( ! visible )
+    if visible {
+        mm.area.Show()
+    } else {
+        mm.area.Hide()
+    }
+}
+
+// called from the view menu
+func updateMinimapVisibility( ) {
+    state := layout.IsMenuItemChecked( "minimap" )
+    for _, pg := range mainArea.pages {
+        if pg.context != nil {
+            pg.context.minimap.setVisible( state )
+        }
+    }
+    updateBarPreferences( MINIMAP, state )
+}
+
+// called from the view menu
+func updateMinimapMode( ) {
+    state := layout.IsMenuItemChecked( "minimapClasses" )
+    updateBarPreferences( MINIMAP_CLASSES, state )
+    for _, pg := range mainArea.pages {
+        if pg.context != nil {
+            pg.context.minimap.area.QueueDraw( )
+        }
+    }
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+    "log"
+    "fmt"
+    "errors"
+    "strings"
+    "strconv"
+    "encoding/binary"
+
+    "internal/layout"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+/*
+    Operations transform the current selection in place: each byte, or each
+    16, 32 or 64 bit word read with the endianness shared with the explore
+    dialog, is combined with an operand. The operand is either a number or a
+    string of hexadecimal bytes, which is split in words of the same size and
+    repeated as many times as needed to cover the whole selection (for example
+    to xor data with a multi-byte key). For shifts and rotations the operand
+    is the number of bits.
+
+    The transformed selection replaces the original selection in a single
+    operation, which is undone or redone at once.
+*/
+
+const (
+    OP_XOR = iota
+    OP_AND
+    OP_OR
+    OP_NOT
+    OP_SHIFT_LEFT
+    OP_SHIFT_RIGHT
+    OP_ROTATE_LEFT
+    OP_ROTATE_RIGHT
+    OP_ADD
+    OP_SUBTRACT
+)
+
+// apply the operation op to the word value v of the given bit size, with the
+// operand o. The result is truncated to the word size.
+func applyOperation( op int, v, o uint64, bits uint ) uint64 {
+    switch op {
+    case OP_XOR:
+        v ^= o
+    case OP_AND:
+        v &= o
+    case OP_OR:
+        v |= o
+    case OP_NOT:
+        v = ^v
+    case OP_SHIFT_LEFT:
+        v <<= o
+    case OP_SHIFT_RIGHT:
+        v >>= o
+    case OP_ROTATE_LEFT:
+        r := uint(o % uint64(bits))
+        v = v << r | v >> (bits - r)
+    case OP_ROTATE_RIGHT:
+        r := uint(o % uint64(bits))
+        v = v >> r | v << (bits - r)
+    case OP_ADD:
+        v += o
+    case OP_SUBTRACT:
+        v -= o
+    default:
+        log.Panicf( "applyOperation: unknown operation %d\n", op )
+    }
+    if bits < 64 {
+        v &= 1 << bits - 1
+    }
+    return v
+}
+
+// get the word of size bytes at the beginning of b, in the given byte order.
+func getWord( b []byte, size int, order binary.ByteOrder ) uint64 {
+    switch size {
+    case 1:
+        return uint64(b[0])
+    case 2:
+        return uint64(order.Uint16( b ))
+    case 4:
+        return uint64(order.Uint32( b ))
+    case 8:
+        return order.Uint64( b )
+    }
+    log.Panicf( "getWord: unsupported word size %d\n", size )
+    return 0
+}
+
+// put the word v of size bytes at the beginning of b, in the given byte order.
+func putWord( b []byte, v uint64, size int, order binary.ByteOrder ) {
+    switch size {
+    case 1:
+        b[0] = byte(v)
+    case 2:
+        order.PutUint16( b, uint16(v) )
+    case 4:
+        order.PutUint32( b, uint32(v) )
+    case 8:
+        order.PutUint64( b, v )
+    default:
+        log.Panicf( "putWord: unsupported word size %d\n", size )
+    }
+}
+
+// transform in place data made of words of size bytes with the operation op,
+// using in turn each operand word. The data length must be a multiple of size.
+func transformData( data []byte, op int, operand []uint64,
+                    size int, order binary.ByteOrder ) {
+    bits := uint(size << 3)
+    for i, j := 0, 0; i < len(data); i += size {
+        v := getWord( data[i:], size, order )
+        putWord( data[i:], applyOperation( op, v, operand[j], bits ),
+                 size, order )
+        if j++; j == len(operand) {
+            j = 0
+        }
+    }
+}
+
+// return the bytes given as a string of hex digits, possibly separated by
+// spaces.
+func getHexBytes( text string ) ([]byte, error) {
+    text = strings.Join( strings.Fields( text ), "" )
+    if len(text) & 1 == 1 || ! isHexString( text ) {
+        return nil, errors.New( localizeText(dialogOperationInvalidBytes) )
+    }
+    b := make( []byte, len(text) / 2 )
+    for i := 0; i < len(b); i++ {
+        b[i] = getNibbleFromHexDigit( text[2*i] ) << 4 |
+               getNibbleFromHexDigit( text[2*i+1] )
+    }
+    return b, nil
+}
+
+// return the value of a number of the given bit size, signed or unsigned, in
+// decimal or in hexadecimal prefixed with 0x. A signed number is returned as
+// its two's complement.
+func getNumber( text string, bits int ) (uint64, error) {
+    text = strings.TrimSpace( text )
+    if v, err := strconv.ParseUint( text, 0, bits ); err == nil {
+        return v, nil
+    }
+    if v, err := strconv.ParseInt( text, 0, bits ); err == nil {
+        return uint64(v) & (^uint64(0) >> (64 - bits)), nil
+    }
+    return 0, fmt.Errorf( localizeText(dialogOperationInvalidNumber), bits )
+}
+
+// return the operand words from the text entered in the operation dialog,
+// either a number or a string of hex bytes, according to isNumber.
+func getOperand( text string, isNumber bool, size int,
+                 order binary.ByteOrder ) ([]uint64, error) {
+    text = strings.TrimSpace( text )
+    if text == "" {
+        return nil, errors.New( localizeText(dialogOperationNoOperand) )
+    }
+    if isNumber {
+        v, err := getNumber( text, size << 3 )
+        if err != nil {
+            return nil, err
+        }
+        return []uint64{ v }, nil
+    }
+    b, err := getHexBytes( text )
+    if err != nil {
+        return nil, err
+    }
+    if len(b) % size != 0 {
+        return nil, fmt.Errorf( localizeText(dialogOperationBytesNotWords), size )
+    }
+    operand := make( []uint64, len(b) / size )
+    for i := range operand {
+        operand[i] = getWord( b[i*size:], size, order )
+    }
+    return operand, nil
+}
+
+func isHexString( s string ) bool {
+    for i := 0; i < len(s); i++ {
+        if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') &&
+                      (c < 'A' || c > 'F') {
+            return false
+        }
+    }
+    return true
+}
+
+// apply the operation op to the current selection, in place. An error is
+// returned if the selection cannot be read or replaced.
+func transformSelection( op int, operand []uint64,
+                         size int, order binary.ByteOrder ) error {
+    pc := getCurrentPageContext()
+    s, l := pc.getSelection()
+    if s == -1 {
+        return fmt.Errorf( "transformSelection: no selection\n" )
+    }
+    if l % int64(size) != 0 {
+        return fmt.Errorf( localizeText(dialogOperationSelectionNotWords), size )
+    }
+    log.Printf( "transformSelection: operation %d on [%d, %d[ words %d\n",
+                op, s, s+l, size )
+    data := make( []byte, l )
+    if _, err := pc.store.ReadAt( data, s ); err != nil {
+        return err
+    }
+    transformData( data, op, operand, size, order )
+    if err := pc.store.ReplaceBytesAt( s, 0, l, data ); err != nil {
+        return err
+    }
+    pc.canvas.QueueDraw( )    // force redraw
+    return nil
+}
+
+// ---- operation dialog
+
+// operation dialog settings, kept from one operation to the next
+var (
+    operandHistory      *layout.History
+    operandIsNumber     bool
+    operationWordSize   int = 8         // in bits
+)
+
+const (
+    OPERAND_INPUT_SIZE = 256
+
+    OPERAND_PRM = "operandPrm"
+    OPERAND_INP = "operandInp"
+    OPERAND_TYPE_PRM = "operandTypePrm"
+    OPERAND_TYPE = "operandType"
+    WORD_SIZE_PRM = "wordSizePrm"
+    WORD_SIZE = "wordSize"
+    OPERATION_ENDIAN_PRM = "opEndianPrm"
+    OPERATION_STATUS = "opStatus"
+)
+
+func getOperationEndianness( ) binary.ByteOrder {
+    if getBoolPreference( BIG_ENDIAN_NAME ) {
+        return binary.BigEndian
+    }
+    return binary.LittleEndian
+}
+
+// return the prompt and the selection list for the endianness shared with the
+// explore dialog, which is updated in preferences as soon as it is changed.
+func getEndiannessDefs( promptName string,
+                        promptFmt *layout.TextFmt ) (*layout.ConstDef,
+                                                     *layout.InputDef) {
+    endianNames := []string{ localizeText(dialogExploreEndianBig),
+                             localizeText(dialogExploreEndianLittle) }
+    endianName := endianNames[1]
+    if getBoolPreference( BIG_ENDIAN_NAME ) {
+        endianName = endianNames[0]
+    }
+    endianChanged := func( name string, val interface{} ) bool {
+        pref := preferences{}
+        pref[name] = val.(string) == localizeText(dialogExploreEndianBig)
+        updatePreferences( pref )
+        return false
+    }
+    endianPrm := layout.ConstDef{ promptName, 0,
+                                  localizeText(dialogExploreEndian), "",
+                                  promptFmt }
+    endianCtl := layout.StrList{ endianNames, false, 0, nil, nil }
+    endianVal := layout.InputDef{ BIG_ENDIAN_NAME, 0, endianName,
+                                  localizeText(tooltipSelList),
+                                  endianChanged, &endianCtl }
+    return &endianPrm, &endianVal
+}
+
+func getOperationDialogDef( ) interface{} {
+
+    promptFmt := layout.TextFmt{ layout.REGULAR, layout.LEFT, 0, false, nil }
+    statusFmt := layout.TextFmt{ layout.ITALIC, layout.LEFT, 0, false, nil }
+    tooltipSL := localizeText(tooltipSelList)
+
+    operandPrm := layout.ConstDef{ OPERAND_PRM, 0,
+                                   localizeText(dialogOperationOperandPrompt), "",
+                                   &promptFmt }
+    operandCtl := layout.StrList{ operandHistory.Get(), true,
+                                  OPERAND_INPUT_SIZE, nil, nil }
+    operandInp := layout.InputDef{ OPERAND_INP, 0, "",
+                                   localizeText(tooltipOperand), nil,
+                                   &operandCtl }
+
+    typeNames := []string{ localizeText(dialogOperationOperandBytes),
+                           localizeText(dialogOperationOperandNumber) }
+    typeName := typeNames[0]
+    if operandIsNumber {
+        typeName = typeNames[1]
+    }
+    typeChanged := func( name string, val interface{} ) bool {
+        operandIsNumber = val.(string) == localizeText(dialogOperationOperandNumber)
+        return false
+    }
+    typePrm := layout.ConstDef{ OPERAND_TYPE_PRM, 0,
+                                localizeText(dialogOperationOperandType), "",
+                                &promptFmt }
+    typeCtl := layout.StrList{ typeNames, false, 0, nil, nil }
+    typeVal := layout.InputDef{ OPERAND_TYPE, 0, typeName, tooltipSL,
+                                typeChanged, &typeCtl }
+
+    sizeChanged := func( name string, val interface{} ) bool {
+        operationWordSize = int(val.(float64))
+        return false
+    }
+    sizePrm := layout.ConstDef{ WORD_SIZE_PRM, 0,
+                                localizeText(dialogOperationWordSizePrompt), "",
+                                &promptFmt }
+    sizeCtl := layout.IntList{ []int{ 8, 16, 32, 64 }, false }
+    sizeVal := layout.InputDef{ WORD_SIZE, 0, operationWordSize, tooltipSL,
+                                sizeChanged, &sizeCtl }
+
+    endianPrm, endianVal := getEndiannessDefs( OPERATION_ENDIAN_PRM, &promptFmt )
+
+    status := layout.ConstDef{ OPERATION_STATUS, 0, "", "", &statusFmt }
+
+    gd := layout.GridDef{ "", 0, layout.HorizontalDef{ 10, []layout.ColDef{
+                                                            { false },
+                                                            { true },
+                                                                   },
+                                                     },
+                          layout.VerticalDef{ 5, []layout.RowDef{
+                                { false, []interface{}{ &operandPrm, &operandInp } },
+                                { false, []interface{}{ &typePrm, &typeVal } },
+                                { false, []interface{}{ &sizePrm, &sizeVal } },
+                                { false, []interface{}{ endianPrm, endianVal } },
+                                                                },
+                                            },
+                        }
+    bd := layout.BoxDef{ "", 0, 15, 0, "", false, layout.VERTICAL,
+                         []interface{}{ &gd, &status } }
+    return &bd
+}
+
+// ask for the operand and word size of the operation op, and apply it to the
+// current selection. The dialog stays open until the operand is valid.
+func operationDialog( op int, titleId int ) {
+    var err error
+    if nil == operandHistory {
+        if operandHistory, err = layout.NewHistory( MAX_HISTORY_DEPTH ); err != nil {
+            log.Fatalf("operationDialog: could not create operand history: %v", err)
+        }
+    }
+    od, err := gtk.DialogNewWithButtons( localizeText(titleId), window,
+                    gtk.DIALOG_MODAL | gtk.DIALOG_DESTROY_WITH_PARENT,
+                    []interface{} { localizeText(buttonApply), gtk.RESPONSE_ACCEPT },
+                    []interface{} { localizeText(buttonCancel), gtk.RESPONSE_CANCEL } )
+    if err != nil {
+        log.Fatal("operationDialog: could not create gtk dialog:", err)
+    }
+    od.SetDefaultResponse( gtk.RESPONSE_ACCEPT )
+    carea, err := od.GetContentArea()
+    if err != nil {
+        log.Fatal("operationDialog: could not get content area:", err)
+    }
+    lo, err := layout.NewLayout( getOperationDialogDef( ) )
+    if err != nil {
+        log.Fatal("operationDialog: could not make layout:", err)
+    }
+    carea.Container.Add( lo.GetRootWidget() )
+    carea.ShowAll()
+    for od.Run() == gtk.RESPONSE_ACCEPT {
+        value, err := lo.GetItemValue( OPERAND_INP )
+        if err != nil {
+            log.Fatalf("operationDialog: can't get operand input\n")
+        }
+        text := value.(string)
+        size := operationWordSize >> 3
+        order := getOperationEndianness( )
+        var operand []uint64
+        operand, err = getOperand( text, operandIsNumber, size, order )
+        if err == nil {
+            err = transformSelection( op, operand, size, order )
+        }
+        if err == nil {
+            operandHistory.Update( text )
+            break
+        }
+        lo.SetItemValue( OPERATION_STATUS, err.Error() )
+    }
+    od.Destroy()
+}
+
+func xorSelection( ) {
+    operationDialog( OP_XOR, menuOperationsXor )
+}
+
+func andSelection( ) {
+    operationDialog( OP_AND, menuOperationsAnd )
+}
+
+func orSelection( ) {
+    operationDialog( OP_OR, menuOperationsOr )
+}
+
+// not does not need any operand and gives the same result whatever the size
+func notSelection( ) {
+    err := transformSelection( OP_NOT, []uint64{ 0 }, 1, binary.BigEndian )
+    if err != nil {
+        errorDisplay( "%v", err )
+    }
+}
+
+func shiftLeftSelection( ) {
+    operationDialog( OP_SHIFT_LEFT, menuOperationsShiftLeft )
+}
+
+func shiftRightSelection( ) {
+    operationDialog( OP_SHIFT_RIGHT, menuOperationsShiftRight )
+}
+
+func rotateLeftSelection( ) {
+    operationDialog( OP_ROTATE_LEFT, menuOperationsRotateLeft )
+}
+
+func rotateRightSelection( ) {
+    operationDialog( OP_ROTATE_RIGHT, menuOperationsRotateRight )
+}
+
+func addToSelection( ) {
+    operationDialog( OP_ADD, menuOperationsAdd )
+}
+
+func subtractFromSelection( ) {
+    operationDialog( OP_SUBTRACT, menuOperationsSubtract )
+}
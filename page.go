@@ -1,16 +1,19 @@
 package main
 
 import (
+    "io"
     "fmt"
     "log"
+    "path/filepath"
+    "sort"
 //    "strings"
-    "os"
     "internal/edit"
     "internal/layout"
 
 	"github.com/gotk3/gotk3/gtk"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/glib"
 )
 
 const (
@@ -59,6 +62,7 @@ type pageContext struct {
     canvas              *gtk.DrawingArea
     barAdjust           *gtk.Adjustment
     scrollBar           *gtk.Scrollbar
+    minimap             *minimap
     pageBox             *gtk.Box
 
     store               *edit.Storage
@@ -120,11 +124,24 @@ func getBytesAtCaret( nBytes int64 ) (data[]byte, nibblePos int64) {
     if nBytes == 0 || bytePos + nBytes > byteLen {
         nBytes = byteLen - bytePos
     }
-    data = pc.store.GetData( bytePos, bytePos + nBytes )
+    data = make( []byte, nBytes )
+    if _, err := pc.store.ReadAt( data, bytePos ); err != nil && err != io.EOF {
+        pc.showReadError( err )
+        data = nil
+    }
     nibblePos = pc.caretPos
     return
 }
 
+// report an error reading the file of page pc once idle, since it may happen
+// while drawing.
+func (pc *pageContext) showReadError( err error ) {
+    glib.IdleAdd( func( ) bool {
+        errorDisplay( localizeText( readError ), getPageName( pc ), err )
+        return false
+    } )
+}
+
 func getByteSizeFromCaret( ) int64 {
     pc := getCurrentPageContext()
     byteLen := pc.store.Length()
@@ -219,6 +236,30 @@ func redoLast( ) {
     pc.canvas.QueueDraw( )    // force redraw
 }
 
+// select the next branch to follow when redoing, after an undo. Branches
+// appear each time a new operation is done after undoing a previous one.
+func nextRedoBranch( ) {
+    log.Println( "nextRedoBranch" )
+    pc := getCurrentPageContext()
+    branches, selected := pc.store.GetBranches()
+    if len(branches) > 1 {
+        pc.store.SelectBranch( (selected + 1) % len(branches) )
+    }
+}
+
+// undo and redo as needed to return to the state given by id in the undo/redo
+// tree, as chosen in the undo history dialog.
+func jumpToUndoState( id int ) {
+    log.Println( "jumpToUndoState" )
+    pc := getCurrentPageContext()
+    pos, err := pc.store.JumpTo( id )
+    if err != nil {
+        log.Panicf( "jumpToUndoState: failed to jump: %v\n", err )
+    }
+    pc.setCaretPosition( 2 * pos, ABSOLUTE )
+    pc.canvas.QueueDraw( )    // force redraw
+}
+
 func deleteSelection( ) {
     log.Println( "deleteSelection" )
     pc := getCurrentPageContext()
@@ -236,25 +277,38 @@ func selectAll( ) {
     pc.canvas.QueueDraw( )    // force redraw
 }
 
-func showHighlights( matchIndex, number int, bytePos int64 ) {
+// show the match count in the status bar, with the match index if matchIndex
+// is not -1, and whether the search is still in progress.
+func showMatchCount( matchIndex, number int ) {
     pc := getCurrentPageContext()
     pc.search = number > 0
+    pc.minimap.area.QueueDraw( )
+    var status string
+    if matchIndex != -1 {
+        status = fmt.Sprintf( localizeText( match ), matchIndex + 1, number )
+    } else if number > 0 {
+        status = fmt.Sprintf( localizeText( nMatches ), number )
+    } else if isSearchInProgress() {
+        status = localizeText( searching )
+    } else {
+        status = localizeText( noMatch )
+    }
+    if number > 0 && isSearchInProgress() {
+        status += " " + localizeText( stillSearching )
+    }
+    showApplicationStatus( status )
+    pc.canvas.QueueDraw( )    // force redraw
+}
+
+func showHighlights( matchIndex, number int, bytePos int64 ) {
+    pc := getCurrentPageContext()
     printDebug( "showHighlights: number=%d, matchIndex=%d\n", number, matchIndex )
+    showMatchCount( matchIndex, number )
     if matchIndex != -1 {
-        showApplicationStatus( fmt.Sprintf(  localizeText( match ),
-                               matchIndex + 1, number ) )
         pc.caretPos = bytePos << 1
         pc.scrollPositionUpdate( pc.caretPos )
         pc.showBytePosition()
-    } else {
-        if number > 0 {
-            showApplicationStatus( fmt.Sprintf( localizeText( nMatches ),
-                                                number ) )
-        } else {
-            showApplicationStatus( localizeText( noMatch ) )
-        }
     }
-    pc.canvas.QueueDraw( )    // force redraw
 }
 
 func removeHighlights() {
@@ -403,10 +457,34 @@ func (pc *pageContext) addBoundingRectangles(
 }
 
 func ( pc *pageContext )getHighlightBoundingRectangles( ) (hr, ar []rectangle) {
-    size, pos, array := getSearchMatches()
+    pos, array, sizes := getSearchMatches()
     for i := 0; i < len(array); i++ {
         hr, ar = pc.addBoundingRectangles( hr, ar, array[i] == pos,
-                                          array[i], array[i] + size )
+                                          array[i], array[i] + sizes[i] )
+    }
+    return
+}
+
+// get the rectangles covering the bytes modified since last saved, only within
+// the visible lines.
+func ( pc *pageContext )getModifiedBoundingRectangles( ) (hr, ar []rectangle) {
+    ranges := pc.store.GetModifiedRanges()
+    startLine, beyondLine, _ := pc.getDataLinesNYPos( )
+    first := startLine * int64(pc.nBytesLine)
+    beyond := beyondLine * int64(pc.nBytesLine)
+
+    i := sort.Search( len(ranges), func( i int ) bool {
+        return ranges[i].Start + ranges[i].Length > first
+    } )
+    for ; i < len(ranges) && ranges[i].Start < beyond; i++ {
+        start, end := ranges[i].Start, ranges[i].Start + ranges[i].Length
+        if start < first {
+            start = first
+        }
+        if end > beyond {
+            end = beyond
+        }
+        hr, ar = pc.addBoundingRectangles( hr, ar, false, start, end )
     }
     return
 }
@@ -667,7 +745,18 @@ func (pc *pageContext)drawDataBackground( cr *cairo.Context ) {
     cr.Rectangle( aRect.x, aRect.y, aRect.w, aRect.h )
     cr.Fill( )
 
-    hr, ar := pc.getSelectionBoundingRectangles( &pc.sel )
+    hr, ar := pc.getModifiedBoundingRectangles( )
+    setModifiedColor( cr )
+    for _, r := range hr {
+        cr.Rectangle( r.x, r.y, r.w, r.h )
+    }
+    cr.Fill( )
+    for _, r := range ar {
+        cr.Rectangle( r.x, r.y, r.w, r.h )
+    }
+    cr.Fill( )
+
+    hr, ar = pc.getSelectionBoundingRectangles( &pc.sel )
     setSelectionColor( cr )
     for _, r := range hr {
         printDebug( "sel hexa rectangle x=%f, y=%f, w=%f, h=%f\n", r.x, r.y, r.w, r.h )
@@ -806,6 +895,38 @@ func gotoPos( pos int64 ) {
     pc.canvas.QueueDraw( )    // force redraw
 }
 
+// move the caret to the start of the first bytes modified since last saved
+// that follow the caret.
+func gotoNextChange( ) {
+    pc := getCurrentPageContext()
+    ranges := pc.store.GetModifiedRanges()
+    pos := pc.caretPos >> 1
+    i := sort.Search( len(ranges), func( i int ) bool {
+        return ranges[i].Start > pos
+    } )
+    if i == len(ranges) {
+        showApplicationStatus( localizeText( noChange ) )
+        return
+    }
+    gotoPos( ranges[i].Start << 1 )
+}
+
+// move the caret to the start of the last bytes modified since last saved
+// that start before the caret.
+func gotoPreviousChange( ) {
+    pc := getCurrentPageContext()
+    ranges := pc.store.GetModifiedRanges()
+    pos := pc.caretPos >> 1
+    i := sort.Search( len(ranges), func( i int ) bool {
+        return ranges[i].Start >= pos
+    } )
+    if i == 0 {
+        showApplicationStatus( localizeText( noChange ) )
+        return
+    }
+    gotoPos( ranges[i-1].Start << 1 )
+}
+
 func (pc *pageContext) updateScrollFromAreaHeight( height int ) {
     pos := pc.barAdjust.GetValue()
     upper := pc.barAdjust.GetUpper()
@@ -916,6 +1037,7 @@ func updatePagePosition( adj *gtk.Adjustment ) {
                size, upper, lower, pInc, sInc, pos)
     pc := getCurrentPageContext()
     pc.canvas.QueueDraw( )    // force redraw
+    pc.minimap.area.QueueDraw( )
 }
 
 func drawCaret( pc *pageContext, cr *cairo.Context ) {
@@ -1088,9 +1210,15 @@ func (pc *pageContext)setStorage( path string ) (err error) {
     }
     pc.store, err = edit.NewStorage( path, getClipboard() )
     if err == nil {
-        pc.store.SetNotifyDataChange( updateSearch )
+        if path != "" && getBoolPreference( UNDO_JOURNAL ) {
+            pc.openJournal( path )
+        }
+        pc.store.AddNotifyDataChange( func( c edit.Change ) {
+            pc.updateSearch( c )
+        } )
         pc.store.SetNotifyLenChange( updateStoreLength )
         pc.store.SetNotifyUndoRedoAble( undoRedoUpdate )
+        pc.store.SetNotifyReadError( pc.showReadError )
         l := pc.store.Length()
         dataExists( l > 0 )
         explorePossible( pc.caretPos < ( l << 1 ) )
@@ -1098,6 +1226,20 @@ func (pc *pageContext)setStorage( path string ) (err error) {
     return
 }
 
+// openJournal starts recording the undo journal for the page storage, after
+// restoring the undo/redo history from a previous journal if possible.
+func (pc *pageContext)openJournal( path string ) {
+    dir := filepath.Join( hexedHome, HEXED_JOURNAL_DIR )
+    restored, err := pc.store.OpenJournal( dir, path )
+    if err == edit.ErrJournalOutdated {
+        warningDisplay( localizeText( warningJournalOutdated ), path )
+    } else if err != nil {
+        log.Printf( "Unable to open undo journal for %s: %v\n", path, err )
+    } else if restored {
+        log.Printf( "Undo history restored for %s\n", path )
+    }
+}
+
 // refreshPageStatus is called when language has changed (in case status
 // strings depend on the language)
 func refreshPageStatus( ) {
@@ -1142,7 +1284,7 @@ func (pc *pageContext) refresh( ) {
     // protection switch depends on read only status
     modificationAllowed( ! pc.readOnly, ! pc.tempReadOnly )
     // update pattern matches
-    pc.findPattern( )
+    pc.showPageMatches( )
 }
 
 func (pc *pageContext) setTempReadOnly( readOnly bool ) {
@@ -1152,6 +1294,7 @@ func (pc *pageContext) setTempReadOnly( readOnly bool ) {
         }
     } else {
         pc.tempReadOnly = readOnly
+        pc.store.CloseRun()
         showReadOnly( pc.tempReadOnly )
         showInputMode( pc.tempReadOnly, pc.replaceMode )
         clipboardAvail := isClipboardDataAvailable()
@@ -1303,6 +1446,9 @@ func (pc *pageContext)init( path string, readOnly bool ) (err error) {
     if err != nil {
         return
     }
+    if pc.minimap, err = newMinimap( pc ); err != nil {
+        return
+    }
 
     // create horizontal box for canvas and scrollbar
     pc.pageBox, err = gtk.BoxNew( gtk.ORIENTATION_HORIZONTAL, 0 )
@@ -1313,6 +1459,7 @@ func (pc *pageContext)init( path string, readOnly bool ) (err error) {
     // Assemble the box
     pc.pageBox.PackStart( pc.canvas, true, true, 1 )
     pc.pageBox.PackStart( pc.scrollBar, false, false, 0 )
+    pc.pageBox.PackStart( pc.minimap.area, false, false, 0 )
 
     minWidth, minHeight := pc.getMinAreaSize()
     pc.canvas.SetSizeRequest( minWidth, minHeight )
@@ -1328,7 +1475,7 @@ func (pc *pageContext)init( path string, readOnly bool ) (err error) {
     showReadOnly( pc.tempReadOnly )
 
     modificationAllowed( ! pc.readOnly, false )
-    pc.virgin = true
+    pc.virgin = ! pc.store.IsDirty()    // unless history was restored
     return
 }
 
@@ -1357,7 +1504,12 @@ func getSelectionData( maxLen int64 ) ( sel []byte ) {
             if l > maxLen {
                 l = maxLen
             }
-            sel = pc.store.GetData( s, s + l )
+            sel = make( []byte, l )
+            _, err := pc.store.ReadAt( sel, s )
+            if err != nil && err != io.EOF {
+                pc.showReadError( err )
+                sel = nil
+            }
         }
     }
     return
@@ -1404,6 +1556,7 @@ func (pc *pageContext)activate( ) {
 
     da.SetCanFocus( true )
     pc.InitCaretPosition( )
+    pc.minimap.activate( )
     return
 }
 
@@ -1496,22 +1649,39 @@ func newPageContent( name string, readOnly bool ) (content *gtk.Widget,
 }
 
 func (pc *pageContext) saveContentAs( path string ) (err error) {
-    if getBoolPreference( CREATE_BACKUP_FILES ) {
-        backupPath := path + "~"
-        if err := os.Rename( path, backupPath ); err != nil {
-            log.Printf( "Error creating backup file %s: %v - ignoring\n",
-                        backupPath, err )
-        }
-    }
     l := pc.store.Length()
     if l > 0 {
-        err = os.WriteFile( path, pc.store.GetData( 0, l ), 0666 )
+        backup := getBoolPreference( CREATE_BACKUP_FILES )
+        // changes can be written in place only in the file loaded or last
+        // saved. Special files, such as block devices, can only be written in
+        // place. Regular files are patched in place only if requested and if
+        // no backup is needed, since a crash while writing would leave them
+        // half written, otherwise they are replaced atomically.
+        regular := isRegularFile( path )
+        inPlace := pc.store.IsLoadedFile( path ) && ( ! regular ||
+                   ( ! backup && getBoolPreference( SAVE_IN_PLACE ) ) )
+        if inPlace {
+            err = pc.store.WriteChangesInPlace( path )
+            if err != nil {
+                if ! regular {
+                    return
+                }
+                printDebug( "saveContentAs: %v", err )
+                inPlace = false
+            }
+        }
+        if ! inPlace {
+            if err = writeFileAtomically( path, pc.store, backup ); err == nil {
+                pc.store.SetSaved( path )
+            }
+        }
         if err == nil {
             pc.virgin = true
+            pc.canvas.QueueDraw( )  // modified bytes are not highlighted anymore
+            pc.minimap.area.QueueDraw( )
         }
     } else {
         err = fmt.Errorf( "Empty page was not saved\n" )
     }
     return
 }
-
@@ -48,6 +48,16 @@ func readPreferences( ) {
         if nil != err {
 		    log.Fatalf( "readPreferences: unable to decode preferences: %v\n", err )
         }
+        // preferences added after the file was created take default values,
+        // converted to JSON types as if they were read from the file.
+        defaults := make(preferences)
+        encoded, _ := json.Marshal( defaultPreferences( ) )
+        json.Unmarshal( encoded, &defaults )
+        for k, v := range defaults {
+            if _, ok := pref[k]; ! ok {
+                pref[k] = v
+            }
+        }
 //        fmt.Printf( "Read from preference file:\n%v\n", preferences )
     }
 }
@@ -78,7 +88,11 @@ const (
     START_REPLACE_MODE = "start_replace_mode"
     WRAP_MATCHES = "wrap around_matches"
     REPLACE_AS_ASCII = "replace_string_as_ascii"
+    SEARCH_IN_SELECTION = "search_within_selection"
+    OVERLAPPING_MATCHES = "overlapping_matches"
     CREATE_BACKUP_FILES = "create_backup_files"
+    SAVE_IN_PLACE = "save_in_place"
+    UNDO_JOURNAL = "undo_journal"
     COLOR_THEME_NAME = "theme_name"
     BIG_ENDIAN_NAME = "big_endian"
     BITSTREAM_MSBF = "bitsteam_msbf"
@@ -86,10 +100,13 @@ const (
     RECENT_FILES = "recent_files"
     STATUS_BAR = "status_bar"
     TOOL_BAR = "tool_bar"
+    MINIMAP = "minimap"
+    MINIMAP_CLASSES = "minimap_byte_classes"
+    RESULTS_DOCK = "results_dock"
 )
 
-func writeDefault( ) {
-    data := preferences {
+func defaultPreferences( ) preferences {
+    return preferences {
                 FONT_NAME : DEFAULT_FONT_NAME,
                 FONT_SIZE : DEFAULT_FONT_SIZE,
                 MIN_BYTES_LINE : 16,
@@ -102,7 +119,11 @@ func writeDefault( ) {
                 START_REPLACE_MODE: false,
                 WRAP_MATCHES: true,
                 REPLACE_AS_ASCII: false,
+                SEARCH_IN_SELECTION: false,
+                OVERLAPPING_MATCHES: false,
                 CREATE_BACKUP_FILES: false,
+                SAVE_IN_PLACE: false,
+                UNDO_JOURNAL: false,
                 COLOR_THEME_NAME: "Hexed Dark",
                 BIG_ENDIAN_NAME: true,
                 BITSTREAM_MSBF: true,
@@ -110,8 +131,14 @@ func writeDefault( ) {
                 RECENT_FILES: make( []string, 0 ),
                 STATUS_BAR: true,
                 TOOL_BAR: false,
+                MINIMAP: true,
+                MINIMAP_CLASSES: false,
+                RESULTS_DOCK: RESULTS_BOTTOM,
     }
-    writePreferences( data )
+}
+
+func writeDefault( ) {
+    writePreferences( defaultPreferences( ) )
 }
 
 var pref  preferences = nil
@@ -0,0 +1,268 @@
+package main
+
+import (
+    "io"
+    "fmt"
+    "html"
+    "regexp"
+    "strings"
+)
+
+/*
+    In regex mode, the search text is a regular expression (in Go syntax) that
+    is matched against bytes instead of UTF-8 characters: data is read as if
+    each byte was a Latin-1 character, so that '.' matches any single byte
+    (except '\n', unless the flag s is set), \xHH matches the byte of value HH,
+    and a character class like [\x80-\xFF] matches a range of byte values.
+    Ignoring case adds the flag i to the expression.
+
+    Matches are searched throughout the whole data, one after the other, and
+    may have various lengths, up to REGEX_MAX_MATCH bytes for matches crossing
+    the boundary between two chunks of data searched in background. Empty
+    matches are ignored. Assertions like ^, $ or \b are checked against the
+    bytes around each match, the search range giving the start and end of the
+    text. The replacement text may refer to the groups captured by each match
+    with $1 or ${name}, use $$ for a single $, and include any byte as \xHH,
+    as well as \n, \t, \r and \\.
+*/
+
+// compile the search regular expression given by text and return the markup
+// to show as the search input tooltip, either the syntax error or a reminder.
+func compileSearchRegexp( text string ) string {
+    if text == "" {
+        return localizeText( tooltipRegexSearch )
+    }
+    if ignoreCase {
+        text = "(?i)" + text
+    }
+    re, err := regexp.Compile( text )
+    if err != nil {
+        return `<span foreground="red" style="italic">` +
+               html.EscapeString( err.Error() ) + `</span>`
+    }
+    searchRegexp = re
+    return localizeText( tooltipRegexSearch )
+}
+
+// sliceRuneReader reads data in memory one byte at a time, returning each
+// byte as a rune.
+type sliceRuneReader struct {
+    data        []byte
+    index       int
+}
+
+func (r *sliceRuneReader) ReadRune( ) (rune, int, error) {
+    if r.index == len(r.data) {
+        return 0, 0, io.EOF
+    }
+    b := r.data[r.index]
+    r.index ++
+    return rune(b), 1, nil
+}
+
+// return a finder for the first non-empty match of re in data at or after
+// from. Since data is searched in the background, re is given instead of
+// using searchRegexp. Except at the start of data, re is matched after the
+// byte before from, so that assertions like ^ or \b are checked against that
+// byte instead of matching as if from was the start of data.
+func getRegexpFinder( re *regexp.Regexp ) searchFinder {
+    // nil if too complex, then matched without context
+    reAfter, _ := regexp.Compile( `\A(?s:.)(?s:.*?)(` + re.String() + ")" )
+    return func( data []byte, from int ) (int, int) {
+        for from < len(data) {
+            var start, end int
+            if from == 0 || reAfter == nil {
+                loc := re.FindReaderIndex(
+                                    &sliceRuneReader{ data: data[from:] } )
+                if loc == nil {
+                    break
+                }
+                start, end = from + loc[0], from + loc[1]
+            } else {
+                loc := reAfter.FindReaderSubmatchIndex(
+                                    &sliceRuneReader{ data: data[from-1:] } )
+                if loc == nil {
+                    break
+                }
+                start, end = from - 1 + loc[2], from - 1 + loc[3]
+            }
+            if end == start {               // ignore empty match
+                from = start + 1
+                continue
+            }
+            return start, end
+        }
+        return -1, -1
+    }
+}
+
+// return a function giving the data replacing the match of the given size at
+// position pos, by expanding the template with the groups captured in that
+// match. The match is matched again with the bytes just before and after it,
+// so that assertions are checked as they were when searching.
+func (pc *pageContext) getRegexpExpander( template []byte ) func( pos,
+                                                    size int64 ) []byte {
+    // searchRegexp as group 1 filling the whole text, indexed by the context
+    // bytes: 1 before, 2 after, 3 both.
+    var inContext [4]*regexp.Regexp
+    match := func( context int, text []byte ) []int {
+        if inContext[context] == nil {
+            expr := "(" + searchRegexp.String() + ")"
+            if context & 1 != 0 {
+                expr = `(?s:.)` + expr
+            }
+            if context & 2 != 0 {
+                expr += `(?s:.)`
+            }
+            re, err := regexp.Compile( `\A` + expr + `\z` )
+            if err != nil {
+                return nil
+            }
+            inContext[context] = re
+        }
+        loc := inContext[context].FindReaderSubmatchIndex(
+                                        &sliceRuneReader{ data: text } )
+        if loc == nil {
+            return nil
+        }
+        loc = loc[2:]                       // searchRegexp groups
+        if context & 1 != 0 {
+            for i := range loc {
+                if loc[i] != -1 {
+                    loc[i] --
+                }
+            }
+        }
+        return loc
+    }
+
+    return func( pos, size int64 ) []byte {
+        start, end, context := pos, pos + size, 0
+        if start > 0 {
+            start --
+            context |= 1
+        }
+        if end < pc.store.Length() {
+            end ++
+            context |= 2
+        }
+        data := pc.store.GetData( start, end )
+        src := data[pos-start:pos-start+size]
+        loc := match( context, data )
+        if loc == nil {
+            // the search range did not include the bytes around the match
+            loc = match( 0, src )
+        }
+        if loc == nil {                     // should not happen
+            loc = []int{ 0, len(src) }
+        }
+        return searchRegexp.Expand( nil, template, src, loc )
+    }
+}
+
+// return the data matched by the regular expression text, or false if text is
+// not a literal.
+func getRegexpLiteral( text string ) ([]byte, bool) {
+    re, err := regexp.Compile( text )
+    if err != nil {
+        return nil, false
+    }
+    prefix, complete := re.LiteralPrefix()
+    if ! complete {
+        return nil, false
+    }
+    data := make( []byte, 0, len(prefix) )
+    for _, r := range prefix {
+        if r > 0xff {
+            return nil, false
+        }
+        data = append( data, byte(r) )
+    }
+    return data, true
+}
+
+func isPrintableAscii( b byte ) bool {
+    return b >= ' ' && b <= '~'
+}
+
+// return the regular expression matching exactly data.
+func getRegexpFromData( data []byte ) string {
+    var b strings.Builder
+    for _, c := range data {
+        if isPrintableAscii( c ) {
+            b.WriteString( regexp.QuoteMeta( string(c) ) )
+        } else {
+            fmt.Fprintf( &b, `\x%02X`, c )
+        }
+    }
+    return b.String()
+}
+
+// return the replacement template given by text, after replacing escape
+// sequences with the bytes they stand for. A $ given by an escape sequence is
+// doubled so that it does not refer to a group.
+func getReplaceTemplate( text string ) (template []byte) {
+    for i := 0; i < len(text); i++ {
+        c := text[i]
+        if c == '\\' && i + 1 < len(text) {
+            i++
+            switch c = text[i]; c {
+            case 'n':
+                c = '\n'
+            case 't':
+                c = '\t'
+            case 'r':
+                c = '\r'
+            case 'x':
+                if i + 2 < len(text) && isHexDigit( text[i+1] ) &&
+                                        isHexDigit( text[i+2] ) {
+                    c = getNibbleFromHexDigit( text[i+1] ) << 4 |
+                        getNibbleFromHexDigit( text[i+2] )
+                    i += 2
+                }
+            }
+            if c == '$' {
+                template = append( template, '$' )
+            }
+        }
+        template = append( template, c )
+    }
+    return
+}
+
+func isHexDigit( c byte ) bool {
+    return strings.IndexByte( "0123456789abcdefABCDEF", c ) != -1
+}
+
+// return the data given by template, or false if template refers to a group.
+func getDataFromTemplate( template []byte ) ([]byte, bool) {
+    data := make( []byte, 0, len(template) )
+    for i := 0; i < len(template); i++ {
+        if template[i] == '$' {
+            if i + 1 == len(template) || template[i+1] != '$' {
+                return nil, false
+            }
+            i++
+        }
+        data = append( data, template[i] )
+    }
+    return data, true
+}
+
+// return the replacement text giving exactly data.
+func getTemplateTextFromData( data []byte ) string {
+    var b strings.Builder
+    for _, c := range data {
+        switch {
+        case c == '\\':
+            b.WriteString( `\\` )
+        case c == '$':
+            b.WriteString( "$$" )
+        case isPrintableAscii( c ):
+            b.WriteByte( c )
+        default:
+            fmt.Fprintf( &b, `\x%02X`, c )
+        }
+    }
+    return b.String()
+}
@@ -26,6 +26,18 @@ const (
     match
     noMatch
     nMatches
+    searching
+    stillSearching
+    resultsFirst
+    resultsInPages
+    resultsOffset
+    resultsHex
+    resultsAscii
+    resultsPage
+    resultsExportTitle
+    resultsExportError
+    readError
+    noChange
 
     actionCopyValue
 
@@ -33,6 +45,7 @@ const (
     menuEdit
     menuView
     menuSearch
+    menuOperations
     menuHelp
 
     menuFileNew
@@ -64,6 +77,10 @@ const (
 
     menuEditRedo
     menuEditRedoHelp
+    menuEditRedoBranch
+    menuEditRedoBranchHelp
+    menuEditHistory
+    menuEditHistoryHelp
 
     menuEditFreeze
     menuEditFreezeHelp
@@ -82,6 +99,8 @@ const (
 
     menuEditDelete
     menuEditDeleteHelp
+    menuEditFill
+    menuEditFillHelp
 
     menuEditSelect
     menuEditSelectHelp
@@ -95,6 +114,11 @@ const (
     menuViewStatusbar
     menuViewStatusbarHelp
 
+    menuViewMinimap
+    menuViewMinimapHelp
+    menuViewMinimapClasses
+    menuViewMinimapClassesHelp
+
     menuViewLarger
     menuViewLargerHelp
 
@@ -109,12 +133,48 @@ const (
 
     menuSearchReplace
     menuSearchReplaceHelp
+    menuSearchFindSelection
+    menuSearchFindSelectionHelp
+    menuSearchFindAll
+    menuSearchFindAllHelp
 
     menuSearchGoto
     menuSearchGotoHelp
 
+    menuSearchNextChange
+    menuSearchNextChangeHelp
+    menuSearchPreviousChange
+    menuSearchPreviousChangeHelp
+
     menuSearchExplore
     menuSearchExploreHelp
+    menuSearchChecksum
+    menuSearchChecksumHelp
+    menuSearchAnalysis
+    menuSearchAnalysisHelp
+
+    menuOperationsXor
+    menuOperationsXorHelp
+    menuOperationsAnd
+    menuOperationsAndHelp
+    menuOperationsOr
+    menuOperationsOrHelp
+    menuOperationsNot
+    menuOperationsNotHelp
+
+    menuOperationsShiftLeft
+    menuOperationsShiftLeftHelp
+    menuOperationsShiftRight
+    menuOperationsShiftRightHelp
+    menuOperationsRotateLeft
+    menuOperationsRotateLeftHelp
+    menuOperationsRotateRight
+    menuOperationsRotateRightHelp
+
+    menuOperationsAdd
+    menuOperationsAddHelp
+    menuOperationsSubtract
+    menuOperationsSubtractHelp
 
     menuHelpContent
     menuHelpContentHelp
@@ -146,9 +206,14 @@ const (
 
     dialogPreferencesSearch
     dialogPreferencesSearchWrapAround
+    dialogPreferencesSearchText
+    dialogPreferencesSearchSelection
+    dialogPreferencesSearchOverlap
 
     dialogPreferencesSave
     dialogPreferencesSaveBackup
+    dialogPreferencesSaveInPlace
+    dialogPreferencesSaveJournal
 
     dialogPreferencesTheme
     dialogPreferencesThemeName
@@ -186,6 +251,59 @@ const (
     dialogExploreFloat32
     dialogExploreFloat64
 
+    dialogOperationOperandPrompt
+    dialogOperationOperandType
+    dialogOperationOperandBytes
+    dialogOperationOperandNumber
+    dialogOperationWordSizePrompt
+    dialogOperationNoOperand
+    dialogOperationInvalidNumber
+    dialogOperationInvalidBytes
+    dialogOperationBytesNotWords
+    dialogOperationSelectionNotWords
+
+    dialogFillTitle
+    dialogFillSource
+    dialogFillPattern
+    dialogFillCounter
+    dialogFillRandom
+    dialogFillPseudoRandom
+    dialogFillLFSR
+    dialogFillPatternPrompt
+    dialogFillStartPrompt
+    dialogFillStepPrompt
+    dialogFillCountPrompt
+    dialogFillSelection
+    dialogFillInvalidCount
+    dialogFillZeroSeed
+    dialogFillNoPattern
+
+    dialogChecksumTitle
+    dialogChecksumAlgorithm
+    dialogChecksumSelection
+    dialogChecksumPage
+    dialogChecksumResult
+    dialogChecksumOffsetPrompt
+    dialogChecksumInvalidOffset
+    dialogChecksumCalculating
+
+    dialogAnalysisTitle
+    dialogHistoryTitle
+    dialogHistoryPrompt
+    dialogHistoryState
+    dialogHistoryOffset
+    dialogHistoryInitial
+    dialogAnalysisSelection
+    dialogAnalysisPage
+    dialogAnalysisEntropy
+    dialogAnalysisChiSquare
+    dialogAnalysisMean
+    dialogAnalysisPrintable
+    dialogAnalysisZero
+    dialogAnalysisHigh
+    dialogAnalysisHistogram
+    dialogAnalysisEntropyGraph
+
     dialogAboutDescription
 
     buttonOk
@@ -194,10 +312,22 @@ const (
     buttonCloseWithoutSave
 
     buttonGo
+    buttonApply
     buttonNext
     buttonPrevious
+    buttonIgnoreCase
+    buttonOverlapping
+    buttonAllPages
+    buttonExport
+    searchModeHex
+    searchModeText
+    searchModeUtf16LE
+    searchModeUtf16BE
+    searchModeRegex
     buttonReplace
     buttonReplaceAll
+    buttonWrite
+    buttonClose
 
     tooltipCloseFile
 
@@ -209,7 +339,19 @@ const (
     tooltipReplaceAll
 
     tooltipAscii
+    tooltipHex
     tooltipWrapAround
+    tooltipSearchMode
+    tooltipIgnoreCase
+    tooltipWithinSelection
+    tooltipOverlapping
+    tooltipAllPages
+    tooltipExport
+    tooltipCloseResults
+    tooltipDockResults
+    resultsWindowTitle
+    tooltipRegexSearch
+    tooltipRegexReplace
 
     tooltipCloseSearch
 
@@ -219,7 +361,13 @@ const (
 
     tooltipCopyValue
 
+    tooltipOperand
+    tooltipFillPattern
+    tooltipFillNumber
+    tooltipEntropyGraph
+
     warningCloseFile
+    warningJournalOutdated
     gotoPrompt
     findPrompt
     replacePrompt
@@ -285,6 +433,7 @@ func updateLanguage( prefName string ) {
     refreshPageStatus( )
     refreshDialogs( )
     refreshSearchArea( )
+    refreshResultsArea( )
 }
 
 func initResources( ) {
@@ -308,6 +457,18 @@ var englishRes [arrayLength]string = [arrayLength]string {
     "Match %d of %d",                                       // match
     "No matches found",                                     // noMatch
     "%d matches",                                           // nMatches
+    "Searching…",                                           // searching
+    "(searching…)",                                         // stillSearching
+    "First %d of %d matches",                               // resultsFirst
+    "%d matches in %d pages",                               // resultsInPages
+    "Offset",                                               // resultsOffset
+    "Hex",                                                  // resultsHex
+    "ASCII",                                                // resultsAscii
+    "Page",                                                 // resultsPage
+    "Export Results",                                       // resultsExportTitle
+    "Unable to export results to %s (%v)",                  // resultsExportError
+    "Unable to read %s (%v)",                               // readError
+    "No other modified byte",                               // noChange
 
     "copy value",                                           // actionCopyValue
 
@@ -316,6 +477,7 @@ var englishRes [arrayLength]string = [arrayLength]string {
     "_Edit",                                                // menuEdit
     "_View",                                                // menuView
     "_Search",                                              // menuSearch
+    "_Operations",                                          // menuOperations
     "_Help",                                                // menuHelp
 
     "New",                                                  // menuFileNew
@@ -347,6 +509,10 @@ var englishRes [arrayLength]string = [arrayLength]string {
 
     "Redo",                                                 // menuEditRedo
     "redo previously undone operation",                     // menuEditRedoHelp
+    "Next Redo Branch",                                     // menuEditRedoBranch
+    "select the next alternative operation to redo",        // menuEditRedoBranchHelp
+    "Undo History",                                         // menuEditHistory
+    "return to any previous state of the page",             // menuEditHistoryHelp
 
     "Switch to Read Only",                                  // menuEditFreeze
     "Prevent modifying accidentaly the file",               // menuEditFreezeHelp
@@ -365,6 +531,8 @@ var englishRes [arrayLength]string = [arrayLength]string {
 
     "Delete",                                               // menuEditPaste
     "delete selected area",                                 // menuEditPasteHelp
+    "Fill...",                                              // menuEditFill
+    "fill the selection or insert generated bytes",         // menuEditFillHelp
 
     "Select All",                                           // menuEditSelect
     "select the entire document",                           // menuEditSelectHelp
@@ -378,6 +546,11 @@ var englishRes [arrayLength]string = [arrayLength]string {
     "Statusbar",                                            // menuViewStatusbar
     "show or hide the statusbar",                           // menuViewStatusbarHelp
 
+    "Minimap",                                              // menuViewMinimap
+    "show or hide the data overview beside the scrollbar",  // menuViewMinimapHelp
+    "Minimap by Byte Class",                                // menuViewMinimapClasses
+    "colour the minimap by byte class instead of entropy",  // menuViewMinimapClassesHelp
+
     "Larger font",                                          // menuViewLarger
     "increase font size",                                   // menuViewLargerHelp
 
@@ -392,12 +565,48 @@ var englishRes [arrayLength]string = [arrayLength]string {
 
     "Replace",                                              // menuSearchReplace
     "Replace the current match",                            // menuSearchReplaceHelp
+    "Find Selection",                                       // menuSearchFindSelection
+    "Search for the bytes currently selected",              // menuSearchFindSelectionHelp
+    "Find All",                                             // menuSearchFindAll
+    "Show all matches in a results panel",                  // menuSearchFindAllHelp
 
     "Go to",                                                // menuSearchGoto
     "move to the given byte location",                      // menuSearchGotoHelp
 
+    "Next Change",                                          // menuSearchNextChange
+    "move to the next bytes modified since last saved",     // menuSearchNextChangeHelp
+    "Previous Change",                                      // menuSearchPreviousChange
+    "move to the previous bytes modified since last saved", // menuSearchPreviousChangeHelp
+
     "Explore",                                              // menuSearchExplore
     "explore the current selection",                        // menuSearchExploreHelp
+    "Checksum...",                                          // menuSearchChecksum
+    "calculate a checksum or a hash of the selection or of the whole file", // menuSearchChecksumHelp
+    "Analysis...",                                          // menuSearchAnalysis
+    "show the byte statistics of the selection or of the whole file", // menuSearchAnalysisHelp
+
+    "Xor",                                                  // menuOperationsXor
+    "xor the selection with a value or a key",              // menuOperationsXorHelp
+    "And",                                                  // menuOperationsAnd
+    "and the selection with a mask",                        // menuOperationsAndHelp
+    "Or",                                                   // menuOperationsOr
+    "or the selection with a mask",                         // menuOperationsOrHelp
+    "Not",                                                  // menuOperationsNot
+    "invert all bits in the selection",                     // menuOperationsNotHelp
+
+    "Shift Left",                                           // menuOperationsShiftLeft
+    "shift the selection bytes or words left",              // menuOperationsShiftLeftHelp
+    "Shift Right",                                          // menuOperationsShiftRight
+    "shift the selection bytes or words right",             // menuOperationsShiftRightHelp
+    "Rotate Left",                                          // menuOperationsRotateLeft
+    "rotate the selection bytes or words left",             // menuOperationsRotateLeftHelp
+    "Rotate Right",                                         // menuOperationsRotateRight
+    "rotate the selection bytes or words right",            // menuOperationsRotateRightHelp
+
+    "Add",                                                  // menuOperationsAdd
+    "add a value to the selection bytes or words",          // menuOperationsAddHelp
+    "Subtract",                                             // menuOperationsSubtract
+    "subtract a value from the selection bytes or words",   // menuOperationsSubtractHelp
 
     "Contents",                                             // menuHelpContent
     "show Hexed manual",                                    // menuHelpContentHelp
@@ -429,9 +638,14 @@ var englishRes [arrayLength]string = [arrayLength]string {
 
     "Search",                                               // dialogPreferencesSearch
     "Start in wrap around mode",                            // dialogPreferencesSearchWrapAround
+    "Start searching text instead of hex",                  // dialogPreferencesSearchText
+    "Start searching within selection",                     // dialogPreferencesSearchSelection
+    "Start finding overlapping matches",                    // dialogPreferencesSearchOverlap
 
     "Updating",                                             // dialogPreferencesSave
     "Create a backup file before saving",                   // dialogPreferencesSaveBackup
+    "Patch files in place when their size is unchanged",    // dialogPreferencesSaveInPlace
+    "Keep undo history after closing",                      // dialogPreferencesSaveJournal
 
     "Theme",                                                // dialogPreferencesTheme
     "Select name",                                          // dialogPreferencesThemeName
@@ -469,6 +683,59 @@ var englishRes [arrayLength]string = [arrayLength]string {
     "float 32",                                             // dialogExploreFloat32
     "float 64",                                             // dialogExploreFloat64
 
+    "Operand",                                              // dialogOperationOperandPrompt
+    "Operand type",                                         // dialogOperationOperandType
+    "Hex bytes",                                            // dialogOperationOperandBytes
+    "Number",                                               // dialogOperationOperandNumber
+    "Word size in bits",                                    // dialogOperationWordSizePrompt
+    "Enter an operand",                                     // dialogOperationNoOperand
+    "The operand is not a %d bit number",                   // dialogOperationInvalidNumber
+    "The operand is not a string of hex bytes",             // dialogOperationInvalidBytes
+    "The operand length is not a multiple of %d bytes",     // dialogOperationBytesNotWords
+    "The selection length is not a multiple of %d bytes",   // dialogOperationSelectionNotWords
+
+    "Fill",                                                 // dialogFillTitle
+    "Fill with",                                            // dialogFillSource
+    "Repeated pattern",                                     // dialogFillPattern
+    "Counter",                                              // dialogFillCounter
+    "Random bytes",                                         // dialogFillRandom
+    "Pseudo-random bytes",                                  // dialogFillPseudoRandom
+    "LFSR sequence",                                        // dialogFillLFSR
+    "Pattern",                                              // dialogFillPatternPrompt
+    "Start value or seed",                                  // dialogFillStartPrompt
+    "Counter step",                                         // dialogFillStepPrompt
+    "Bytes to insert",                                      // dialogFillCountPrompt
+    "Selected bytes",                                       // dialogFillSelection
+    "The number of bytes to insert is not valid",           // dialogFillInvalidCount
+    "The LFSR seed cannot be 0",                            // dialogFillZeroSeed
+    "Enter a pattern of hex bytes",                         // dialogFillNoPattern
+
+    "Checksum",                                             // dialogChecksumTitle
+    "Algorithm",                                            // dialogChecksumAlgorithm
+    "Selection of %d bytes at offset 0x%x",                 // dialogChecksumSelection
+    "Whole file of %d bytes",                               // dialogChecksumPage
+    "Result",                                               // dialogChecksumResult
+    "Write at offset",                                      // dialogChecksumOffsetPrompt
+    "The result does not fit at that offset",               // dialogChecksumInvalidOffset
+    "Calculating…",                                         // dialogChecksumCalculating
+
+    "Analysis",                                             // dialogAnalysisTitle
+    "Undo History",                                         // dialogHistoryTitle
+    "Double-click a state to return to it",                 // dialogHistoryPrompt
+    "State",                                                // dialogHistoryState
+    "Offset",                                               // dialogHistoryOffset
+    "initial",                                              // dialogHistoryInitial
+    "Selection of %d bytes at offset 0x%x",                 // dialogAnalysisSelection
+    "Whole file of %d bytes",                               // dialogAnalysisPage
+    "Entropy in bits per byte",                             // dialogAnalysisEntropy
+    "Chi-square",                                           // dialogAnalysisChiSquare
+    "Mean byte value",                                      // dialogAnalysisMean
+    "Printable bytes",                                      // dialogAnalysisPrintable
+    "Zero bytes",                                           // dialogAnalysisZero
+    "High bytes (0x80-0xff)",                               // dialogAnalysisHigh
+    "Byte frequencies",                                     // dialogAnalysisHistogram
+    "Entropy along the offsets",                            // dialogAnalysisEntropyGraph
+
     "A small binary file editor",                           // dialogAboutDescription
 
     "Yes",                                                  // buttonOk
@@ -477,11 +744,23 @@ var englishRes [arrayLength]string = [arrayLength]string {
     "Close without saving",                                 // buttonCloseWithoutSave
 
     "Go",                                                   // buttonGo
+    "Apply",                                                // buttonApply
     "Next",                                                 // buttonNext
     "Previous",                                             // buttonPrevious
+    "Aa",                                                   // buttonIgnoreCase
+    "AAA",                                                  // buttonOverlapping
+    "Tabs",                                                 // buttonAllPages
+    "Export",                                               // buttonExport
+    "Hex",                                                  // searchModeHex
+    "Text",                                                 // searchModeText
+    "UTF-16LE",                                             // searchModeUtf16LE
+    "UTF-16BE",                                             // searchModeUtf16BE
+    "Regex",                                                // searchModeRegex
 
     "Replace",                                              // buttonReplace
     "Replace All",                                          // buttonReplaceAll
+    "Write",                                                // buttonWrite
+    "Close",                                                // buttonClose
 
     "Close file",                                           // tooltipCloseFile
 
@@ -493,8 +772,20 @@ var englishRes [arrayLength]string = [arrayLength]string {
     "Replace all matches",                                  // tooltipReplaceAll
 
     "ASCII",                                                // tooltipAscii
+    "Hex",                                                  // tooltipHex
 
     "Wrap Around matches",                                  // tooltipWrapAround
+    "Search and replace hex digits or text",                // tooltipSearchMode
+    "Ignore case of ASCII letters in text",                 // tooltipIgnoreCase
+    "Search only within the selection",                     // tooltipWithinSelection
+    "Find overlapping matches",                             // tooltipOverlapping
+    "Search in all open pages",                             // tooltipAllPages
+    "Export all results to a CSV (.csv) or text file",      // tooltipExport
+    "Close results",                                        // tooltipCloseResults
+    "Place results below or beside pages, or in their own window", // tooltipDockResults
+    "Search Results",                                       // resultsWindowTitle
+    "Regular expression matching bytes, as \\xHH or [\\x80-\\xFF]", // tooltipRegexSearch
+    "Replacement bytes, with $1 or ${name} for captured groups and \\xHH for any byte", // tooltipRegexReplace
     "Close search",                                         // tooltipCloseSearch
 
     "increase or decrease with +/- buttons",                // tooltipSpinButton
@@ -503,7 +794,13 @@ var englishRes [arrayLength]string = [arrayLength]string {
 
     "Right click to copy Value",                            // tooltipCopyValue
 
+    "Enter hex bytes or a number (decimal, 0x hexadecimal)", // tooltipOperand
+    "Enter hex bytes",                                      // tooltipFillPattern
+    "Enter a number (decimal, 0x hexadecimal)",             // tooltipFillNumber
+    "Click to go to that offset",                           // tooltipEntropyGraph
+
     "if you close without saving, all modifications will be lost",  // warningCloseFile
+    "%s was modified since its undo history was recorded: that history is lost",  // warningJournalOutdated
     "Enter byte address in hexadecimal",                    // gotoPrompt
     "Enter hex string to find",                             // findPrompt
     "Replacement Hex string",                               // replacePrompt
@@ -527,6 +824,18 @@ var frenchRes [arrayLength]string = [arrayLength]string {
     "Place %d sur %d",                                      // match
     "Introuvable",                                          // noMatch
     "%d places",                                            // nMatches
+    "Recherche…",                                           // searching
+    "(recherche en cours…)",                                // stillSearching
+    "%d premières places sur %d",                           // resultsFirst
+    "%d places dans %d pages",                              // resultsInPages
+    "Position",                                             // resultsOffset
+    "Hexa",                                                 // resultsHex
+    "ASCII",                                                // resultsAscii
+    "Page",                                                 // resultsPage
+    "Exporter les résultats",                               // resultsExportTitle
+    "Impossible d'exporter les résultats dans %s (%v)",     // resultsExportError
+    "Impossible de lire %s (%v)",                           // readError
+    "Aucun autre octet modifié",                            // noChange
 
     "copier la valeur",                                     // actionCopyValue
 
@@ -534,6 +843,7 @@ var frenchRes [arrayLength]string = [arrayLength]string {
     "_Edition",                                             // menuEdit
     "_Vue",                                                 // menuView
     "_Recherche",                                           // menuSearch
+    "_Opérations",                                          // menuOperations
     "_Aide",                                                // menuHelp
 
     "Nouveau",                                              // menuFileNew
@@ -565,6 +875,10 @@ var frenchRes [arrayLength]string = [arrayLength]string {
 
     "Refaire",                                              // menuEditRedo
     "répete la précedente commande annullée",               // menuEditRedoHelp
+    "Alternative suivante",                                 // menuEditRedoBranch
+    "choisit la prochaine commande alternative à refaire",  // menuEditRedoBranchHelp
+    "Historique",                                           // menuEditHistory
+    "revient à un état antérieur de la page",               // menuEditHistoryHelp
 
     "Passer en mode Lecture",                               // menuEditFreeze
     "Empèche la modification accidentelle du fichier",      // menuEditFreezeHelp
@@ -583,6 +897,8 @@ var frenchRes [arrayLength]string = [arrayLength]string {
 
     "supprimer",                                            // menuEditDelete
     "supprime la sélection",                                // menuEditDeletehHelp
+    "Remplir...",                                           // menuEditFill
+    "remplit la sélection ou insère des octets générés",    // menuEditFillHelp
 
     "Selecter tout",                                        // menuEditSelect
     "sélecte the document complet",                         // menuEditSelectHelp
@@ -596,6 +912,11 @@ var frenchRes [arrayLength]string = [arrayLength]string {
     "Barre d'état",                                         // menuViewStatusbar
     "montre ou cache la barre d'état",                      // menuViewStatusbarHelp
 
+    "Minicarte",                                            // menuViewMinimap
+    "montre ou cache la vue d'ensemble des données à côté de la barre de défilement", // menuViewMinimapHelp
+    "Minicarte par classe d'octets",                        // menuViewMinimapClasses
+    "colore la minicarte par classe d'octets au lieu de l'entropie", // menuViewMinimapClassesHelp
+
     "Caractères plus gros",                                 // menuViewLarger
     "augmente la taille des caractères",                    // menuViewLargerHelp
 
@@ -610,12 +931,48 @@ var frenchRes [arrayLength]string = [arrayLength]string {
 
     "Remplacer",                                            // menuSearchReplace
     "Remplace la séquence trouvée",                         // menuSearchReplaceHelp
+    "Chercher la sélection",                                // menuSearchFindSelection
+    "Recherche les octets sélectionnés",                    // menuSearchFindSelectionHelp
+    "Tout chercher",                                        // menuSearchFindAll
+    "Montre toutes les correspondances dans un panneau",    // menuSearchFindAllHelp
 
     "Aller à",                                              // menuSearchGoto
     "Positionne le curseur a l'adresse donnée",             // menuSearchGotoHelp
 
+    "Modification suivante",                                // menuSearchNextChange
+    "Positionne le curseur sur les octets modifiés suivants", // menuSearchNextChangeHelp
+    "Modification précédente",                              // menuSearchPreviousChange
+    "Positionne le curseur sur les octets modifiés précédents", // menuSearchPreviousChangeHelp
+
     "Explorer",                                             // menuSearchExplore
     "explorer la selection",                                // menuSearchExploreHelp
+    "Somme de contrôle...",                                 // menuSearchChecksum
+    "calcule une somme de contrôle ou un hachage de la sélection ou du fichier entier", // menuSearchChecksumHelp
+    "Analyse...",                                           // menuSearchAnalysis
+    "montre les statistiques des octets de la sélection ou du fichier entier", // menuSearchAnalysisHelp
+
+    "Ou exclusif",                                          // menuOperationsXor
+    "combine la sélection avec une valeur ou une clé par ou exclusif", // menuOperationsXorHelp
+    "Et",                                                   // menuOperationsAnd
+    "combine la sélection avec un masque par et",           // menuOperationsAndHelp
+    "Ou",                                                   // menuOperationsOr
+    "combine la sélection avec un masque par ou",           // menuOperationsOrHelp
+    "Non",                                                  // menuOperationsNot
+    "inverse tous les bits de la sélection",                // menuOperationsNotHelp
+
+    "Décalage à gauche",                                    // menuOperationsShiftLeft
+    "décale à gauche les octets ou mots de la sélection",   // menuOperationsShiftLeftHelp
+    "Décalage à droite",                                    // menuOperationsShiftRight
+    "décale à droite les octets ou mots de la sélection",   // menuOperationsShiftRightHelp
+    "Rotation à gauche",                                    // menuOperationsRotateLeft
+    "fait tourner à gauche les octets ou mots de la sélection", // menuOperationsRotateLeftHelp
+    "Rotation à droite",                                    // menuOperationsRotateRight
+    "fait tourner à droite les octets ou mots de la sélection", // menuOperationsRotateRightHelp
+
+    "Ajouter",                                              // menuOperationsAdd
+    "ajoute une valeur aux octets ou mots de la sélection", // menuOperationsAddHelp
+    "Soustraire",                                           // menuOperationsSubtract
+    "soustrait une valeur des octets ou mots de la sélection", // menuOperationsSubtractHelp
 
     "Contenu",                                              // menuHelpContent
     "consulte le manuel d'hexed",                           // menuHelpContentHelp
@@ -647,9 +1004,14 @@ var frenchRes [arrayLength]string = [arrayLength]string {
 
     "Chercher",                                             // dialogPreferencesSearch
     "Démarrer en mode circulaire",                          // dialogPreferencesSearchWrapAround
+    "Démarrer en recherche de texte au lieu d'hexa",        // dialogPreferencesSearchText
+    "Démarrer en recherche dans la sélection",              // dialogPreferencesSearchSelection
+    "Démarrer en recherche des chevauchements",             // dialogPreferencesSearchOverlap
 
     "Mise à jour",                                          // dialogPreferencesSave
     "Sauvegarder le ficher avant d'enregister",             // dialogPreferencesSaveBackup
+    "Modifier les fichiers sur place si leur taille est inchangée", // dialogPreferencesSaveInPlace
+    "Conserver l'historique après fermeture",               // dialogPreferencesSaveJournal
 
     "Thème",                                                // dialogPreferencesTheme
     "Choisissez le thème",                                  // dialogPreferencesThemeName
@@ -687,6 +1049,59 @@ var frenchRes [arrayLength]string = [arrayLength]string {
     "flottant 32",                                          // dialogExploreFloat32
     "flottant 64",                                          // dialogExploreFloat64
 
+    "Opérande",                                             // dialogOperationOperandPrompt
+    "Type d'opérande",                                      // dialogOperationOperandType
+    "Octets hexa",                                          // dialogOperationOperandBytes
+    "Nombre",                                               // dialogOperationOperandNumber
+    "Taille des mots en bits",                              // dialogOperationWordSizePrompt
+    "Entrez un opérande",                                   // dialogOperationNoOperand
+    "L'opérande n'est pas un nombre de %d bits",            // dialogOperationInvalidNumber
+    "L'opérande n'est pas une chaine d'octets hexa",        // dialogOperationInvalidBytes
+    "La longueur de l'opérande n'est pas un multiple de %d octets", // dialogOperationBytesNotWords
+    "La longueur de la sélection n'est pas un multiple de %d octets", // dialogOperationSelectionNotWords
+
+    "Remplir",                                              // dialogFillTitle
+    "Remplir avec",                                         // dialogFillSource
+    "Motif répété",                                         // dialogFillPattern
+    "Compteur",                                             // dialogFillCounter
+    "Octets aléatoires",                                    // dialogFillRandom
+    "Octets pseudo-aléatoires",                             // dialogFillPseudoRandom
+    "Séquence LFSR",                                        // dialogFillLFSR
+    "Motif",                                                // dialogFillPatternPrompt
+    "Valeur initiale ou graine",                            // dialogFillStartPrompt
+    "Pas du compteur",                                      // dialogFillStepPrompt
+    "Octets à insérer",                                     // dialogFillCountPrompt
+    "Octets sélectionnés",                                  // dialogFillSelection
+    "Le nombre d'octets à insérer n'est pas valide",        // dialogFillInvalidCount
+    "La graine du LFSR ne peut pas être 0",                 // dialogFillZeroSeed
+    "Entrez un motif d'octets hexa",                        // dialogFillNoPattern
+
+    "Somme de contrôle",                                    // dialogChecksumTitle
+    "Algorithme",                                           // dialogChecksumAlgorithm
+    "Sélection de %d octets à la position 0x%x",            // dialogChecksumSelection
+    "Fichier entier de %d octets",                          // dialogChecksumPage
+    "Résultat",                                             // dialogChecksumResult
+    "Ecrire à la position",                                 // dialogChecksumOffsetPrompt
+    "Le résultat ne tient pas à cette position",            // dialogChecksumInvalidOffset
+    "Calcul en cours…",                                     // dialogChecksumCalculating
+
+    "Analyse",                                              // dialogAnalysisTitle
+    "Historique des modifications",                         // dialogHistoryTitle
+    "Double-cliquez sur un état pour y revenir",            // dialogHistoryPrompt
+    "État",                                                 // dialogHistoryState
+    "Position",                                             // dialogHistoryOffset
+    "initial",                                              // dialogHistoryInitial
+    "Sélection de %d octets à la position 0x%x",            // dialogAnalysisSelection
+    "Fichier entier de %d octets",                          // dialogAnalysisPage
+    "Entropie en bits par octet",                           // dialogAnalysisEntropy
+    "Khi carré",                                            // dialogAnalysisChiSquare
+    "Valeur moyenne des octets",                            // dialogAnalysisMean
+    "Octets imprimables",                                   // dialogAnalysisPrintable
+    "Octets nuls",                                          // dialogAnalysisZero
+    "Octets hauts (0x80-0xff)",                             // dialogAnalysisHigh
+    "Fréquence des octets",                                 // dialogAnalysisHistogram
+    "Entropie le long des positions",                       // dialogAnalysisEntropyGraph
+
     "Un petit editeur de fichiers binaires",                // dialogAboutDescription
 
     "Oui",                                                  // buttonOk
@@ -695,11 +1110,23 @@ var frenchRes [arrayLength]string = [arrayLength]string {
     "Fermer sans enregistrer",                              // buttonCloseWithoutSave
 
     "Aller",                                                // buttonGo
+    "Appliquer",                                            // buttonApply
     "Suivant",                                              // buttonNext
     "Précédent",                                            // buttonPrevious
+    "Aa",                                                   // buttonIgnoreCase
+    "AAA",                                                  // buttonOverlapping
+    "Onglets",                                              // buttonAllPages
+    "Exporter",                                             // buttonExport
+    "Hexa",                                                 // searchModeHex
+    "Texte",                                                // searchModeText
+    "UTF-16LE",                                             // searchModeUtf16LE
+    "UTF-16BE",                                             // searchModeUtf16BE
+    "Regex",                                                // searchModeRegex
 
     "Remplace",                                             // buttonReplace
     "Remplace tous",                                        // buttonReplaceAll
+    "Ecrire",                                               // buttonWrite
+    "Fermer",                                               // buttonClose
 
     "Fermer le fichier",                                    // tooltipCLoseFile
 
@@ -711,8 +1138,20 @@ var frenchRes [arrayLength]string = [arrayLength]string {
     "Remplacer toutes les correspondances",                 // tooltipReplacePrevious
 
     "ASCII",                                                // tooltipAscii
+    "Hexa",                                                 // tooltipHex
 
     "Boucler les correspondances",                          // tooltipWrapAround
+    "Recherche et remplace des chiffres hexa ou du texte",  // tooltipSearchMode
+    "Ignore la casse des lettres ASCII dans le texte",      // tooltipIgnoreCase
+    "Cherche seulement dans la sélection",                  // tooltipWithinSelection
+    "Trouve les correspondances qui se chevauchent",        // tooltipOverlapping
+    "Cherche dans toutes les pages ouvertes",               // tooltipAllPages
+    "Exporte tous les résultats dans un fichier CSV (.csv) ou texte", // tooltipExport
+    "Ferme les résultats",                                  // tooltipCloseResults
+    "Place les résultats sous ou à côté des pages, ou dans leur propre fenêtre", // tooltipDockResults
+    "Résultats de recherche",                               // resultsWindowTitle
+    "Expression régulière sur des octets, comme \\xHH ou [\\x80-\\xFF]", // tooltipRegexSearch
+    "Octets de remplacement, avec $1 ou ${nom} pour les groupes capturés et \\xHH pour tout octet", // tooltipRegexReplace
     "Fermer la recherche",                                  // tooltipCloseSearch
 
     "Augmenter ou diminuer par les boutons +/-",            // tooltipSpinButton
@@ -721,7 +1160,13 @@ var frenchRes [arrayLength]string = [arrayLength]string {
 
     "Cliquer à droite pour copier la valeur",               // tooltipCopyValue
 
+    "Entrez des octets hexa ou un nombre (décimal, 0x hexadécimal)", // tooltipOperand
+    "Entrez des octets hexa",                               // tooltipFillPattern
+    "Entrez un nombre (décimal, 0x hexadécimal)",           // tooltipFillNumber
+    "Cliquez pour aller à cette position",                  // tooltipEntropyGraph
+
     "Si vous fermez sans enregister, toutes les modifications seront perdues",  // warningCloseFile
+    "%s a été modifié depuis l'enregistrement de son historique : cet historique est perdu",  // warningJournalOutdated
     "Entrez l'adresse de l'octet en hexadecimal",           // gotoPrompt
     "Chercher les characteres hexa",                        // findPrompt
     "Remplacer avec la chaine hexa",                        // replacePrompt
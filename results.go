@@ -0,0 +1,497 @@
+package main
+
+import (
+    "os"
+    "fmt"
+    "log"
+    "html"
+    "bufio"
+    "strings"
+    "encoding/csv"
+
+    "internal/layout"
+
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/glib"
+)
+
+/*
+    The results panel lists all matches of the current search with their
+    offset, the surrounding bytes in hex and ASCII, and the page they are in.
+    When searching all pages, matches are listed page after page, in the tab
+    order. While visible, it follows the matches as they are found or updated,
+    and activating a match in another page makes that page current. It shows
+    at most MAX_RESULT_ROWS rows, but all results are exported, either as CSV
+    if the file name ends with .csv or as tab separated text otherwise.
+
+    The panel is docked below the pages, or beside them, or is shown in its own
+    window. The dock button in its header moves it from one place to the next,
+    and the last place is kept in preferences. Docked, it shares a paned area
+    with the pages, so that it can be resized at their expense.
+*/
+
+const (
+    RESULTS_DOCK_ICON_NAME = "view-dual-symbolic"
+    RESULTS_WINDOW_WIDTH = 600
+    RESULTS_WINDOW_HEIGHT = 300
+)
+
+// where the results panel is shown
+const (
+    RESULTS_BOTTOM = iota           // docked below pages
+    RESULTS_RIGHT                   // docked beside pages
+    RESULTS_WINDOW                  // in its own window
+    RESULTS_DOCKS
+)
+
+const (
+    MAX_RESULT_ROWS = 1000          // rows shown in list
+    RESULT_CONTEXT = 8              // bytes shown before and after a match
+    RESULT_MAX_MATCH = 16           // match bytes shown, followed by …
+)
+
+type searchResult struct {
+    pc          *pageContext        // page where the match was found
+    pos, size   int64               // match position and size in page
+}
+
+var (
+    resultsArea     *layout.Layout  // results panel
+    resultsVisible  bool            // is results panel visible?
+    resultsPending  bool            // refresh already scheduled
+    results         []searchResult  // all results, shown or not
+
+    resultsDock     int             // where the results panel is shown
+    dockBox         *gtk.Box        // holds the paned area in main window
+    dockPaned       *gtk.Paned      // pages and docked results panel
+    dockPages       *gtk.Widget     // pages, always in dockPaned
+    dockPanel       *gtk.Widget     // results panel
+    dockWindow      *gtk.Window     // results window if not docked
+)
+
+func newResultsArea( ) *gtk.Widget {
+    titleFmt := layout.TextFmt{ layout.REGULAR, layout.LEFT, 0, false, nil }
+    title := layout.ConstDef{ "resultsTitle", 5, "", "", &titleFmt }
+
+    butFmt := layout.TextFmt{ layout.REGULAR, layout.CENTER, 0, false, nil }
+    butCtl := layout.ButtonCtl{ true, false, false }
+
+    exportLabel := layout.TextDef{ localizeText( buttonExport ), &butFmt }
+    export := layout.InputDef{ "export", 0, &exportLabel,
+                               localizeText( tooltipExport ),
+                               exportResults, &butCtl }
+
+    dockLabel := layout.IconDef{ RESULTS_DOCK_ICON_NAME }
+    dock := layout.InputDef{ "dockResults", 0, &dockLabel,
+                             localizeText( tooltipDockResults ),
+                             moveResults, &butCtl }
+
+    closeLabel := layout.IconDef{ SEARCH_CLOSE_ICON_NAME }
+    closeResults := layout.InputDef{ "closeResults", 0, &closeLabel,
+                                     localizeText( tooltipCloseResults ),
+                                     exitResults, &butCtl }
+
+    header := layout.GridDef{ "resultsHeader", 0,
+                              layout.HorizontalDef{ 0, []layout.ColDef{
+                                                        { true },
+                                                        { false },
+                                                        { false },
+                                                        { false }, },
+                                                  },
+                              layout.VerticalDef{ 0, []layout.RowDef{
+                                                    { false, []interface{}{
+                                                            &title,
+                                                            &export,
+                                                            &dock,
+                                                            &closeResults } },
+                                                                      },
+                                                },
+                            }
+
+    listFmt := layout.TextFmt{ layout.MONOSPACE, layout.LEFT, 0, false, nil }
+    list := layout.ListDef{ "resultsList", 0, []layout.ListColDef{
+                                { localizeText( resultsOffset ), layout.RIGHT },
+                                { localizeText( resultsHex ), layout.LEFT },
+                                { localizeText( resultsAscii ), layout.LEFT },
+                                { localizeText( resultsPage ), layout.LEFT }, },
+                            &listFmt, gotoResult }
+
+    gd := layout.GridDef{ "resultsGrid", 0,
+                          layout.HorizontalDef{ 0, []layout.ColDef{ { true } } },
+                          layout.VerticalDef{ 0, []layout.RowDef{
+                                                { false, []interface{}{
+                                                            &header } },
+                                                { true, []interface{}{
+                                                            &list } },
+                                                                  },
+                                            },
+                        }
+
+    var err error
+    resultsArea, err = layout.NewLayout( &gd )
+    if err != nil {
+        log.Fatalf( "newResultsArea: Unable to create layout: %v\n", err )
+    }
+    resultsVisible = false
+    return resultsArea.GetRootWidget()
+}
+
+func refreshResultsArea( ) {
+    resultsArea.SetButtonLabel( "export", localizeText( buttonExport ) )
+    resultsArea.SetItemTooltip( "export", localizeText( tooltipExport ) )
+    resultsArea.SetItemTooltip( "dockResults",
+                                localizeText( tooltipDockResults ) )
+    resultsArea.SetItemTooltip( "closeResults",
+                                localizeText( tooltipCloseResults ) )
+    if dockWindow != nil {
+        dockWindow.SetTitle( localizeText( resultsWindowTitle ) )
+    }
+
+    list := getResultsList( )
+    for i, id := range []int{ resultsOffset, resultsHex,
+                              resultsAscii, resultsPage } {
+        list.SetColumnTitle( i, localizeText( id ) )
+    }
+    refreshResults( )
+}
+
+func getResultsList( ) *layout.DataList {
+    value, err := resultsArea.GetItemValue( "resultsList" )
+    if err != nil {
+        log.Fatalf( "getResultsList: unable to access list: %v", err )
+    }
+    return value.(*layout.DataList)
+}
+
+// return a box holding the pages and the results panel given by panel, placed
+// as it was last time.
+func newResultsDock( pages, panel *gtk.Widget ) *gtk.Box {
+    box, err := gtk.BoxNew( gtk.ORIENTATION_VERTICAL, 0 )
+    if err != nil {
+        log.Fatalf( "newResultsDock: Unable to create a box: %v\n", err )
+    }
+    dockBox, dockPages, dockPanel = box, pages, panel
+    dock := getIntPreference( RESULTS_DOCK )
+    if dock < 0 || dock >= RESULTS_DOCKS {
+        dock = RESULTS_BOTTOM
+    }
+    dockResults( dock )
+    return box
+}
+
+// return a new window showing the results panel.
+func newResultsWindow( ) *gtk.Window {
+    w, err := gtk.WindowNew( gtk.WINDOW_TOPLEVEL )
+    if err != nil {
+        log.Fatalf( "newResultsWindow: Unable to create window: %v\n", err )
+    }
+    w.SetTitle( localizeText( resultsWindowTitle ) )
+    w.SetTransientFor( window )
+    w.SetDestroyWithParent( true )
+    w.SetDefaultSize( RESULTS_WINDOW_WIDTH, RESULTS_WINDOW_HEIGHT )
+    w.Add( dockPanel )
+    w.Connect( "delete_event", func( ) bool {
+        hideResultsArea( )
+        return true                 // keep window for next time
+    } )
+    return w
+}
+
+// place the results panel according to dock: a new paned area is made for
+// the pages, with the panel below or beside them, or in its own window.
+func dockResults( dock int ) {
+    if dockPaned != nil {
+        dockPaned.Remove( dockPages )
+        if dockWindow == nil {
+            dockPaned.Remove( dockPanel )
+        }
+        dockBox.Remove( dockPaned )
+    }
+    if dockWindow != nil {
+        dockWindow.Remove( dockPanel )
+        dockWindow.Destroy( )
+        dockWindow = nil
+    }
+
+    orientation := gtk.ORIENTATION_VERTICAL
+    if dock == RESULTS_RIGHT {
+        orientation = gtk.ORIENTATION_HORIZONTAL
+    }
+    paned, err := gtk.PanedNew( orientation )
+    if err != nil {
+        log.Fatalf( "dockResults: Unable to create a paned area: %v\n", err )
+    }
+    paned.Pack1( dockPages, true, false )
+    if dock == RESULTS_WINDOW {
+        dockWindow = newResultsWindow( )
+        if resultsVisible {
+            dockWindow.ShowAll( )
+        }
+    } else {
+        paned.Pack2( dockPanel, false, true )
+    }
+    dockBox.PackStart( paned, true, true, 0 )
+    paned.Show( )
+    dockPaned, resultsDock = paned, dock
+}
+
+// move the results panel to its next place, and remember it.
+func moveResults( name string, val interface{} ) bool {
+    dock := (resultsDock + 1) % RESULTS_DOCKS
+    dockResults( dock )
+    pref := preferences{}
+    pref[RESULTS_DOCK] = dock
+    updatePreferences( pref )
+    return true
+}
+
+func showResultsArea( ) {
+    resultsArea.SetVisible( true )
+    if dockWindow != nil {
+        dockWindow.ShowAll( )
+    }
+    resultsVisible = true
+    refreshResults( )
+}
+
+func hideResultsArea( ) {
+    resultsArea.SetVisible( false )
+    if dockWindow != nil {
+        dockWindow.Hide( )
+    }
+    resultsVisible = false
+    results = nil
+    getResultsList( ).Clear( )
+}
+
+func exitResults( name string, val interface{} ) bool {
+    hideResultsArea( )
+    return true
+}
+
+// show all matches of the current search in the results panel, after showing
+// the search area if needed.
+func findAll( ) {
+    if ! areaVisible {
+        searchDialog( )
+    }
+    showResultsArea( )
+}
+
+// called each time matches change, to refresh the results panel once idle.
+func invalidateResults( ) {
+    if resultsVisible && ! resultsPending {
+        resultsPending = true
+        glib.IdleAdd( func( ) bool {
+            resultsPending = false
+            refreshResults( )
+            return false
+        } )
+    }
+}
+
+func refreshResults( ) {
+    if ! resultsVisible {
+        return
+    }
+    results = results[0:0]
+    current := getCurrentWorkAreaPageContext( )
+    nPages := 0
+    for _, pg := range mainArea.pages {
+        pc := pg.context
+        positions, sizes := matches, matchSizes
+        if pc != current {
+            r := pageMatches[pc]
+            if ! allPages || r == nil {
+                continue
+            }
+            positions, sizes = r.positions, r.sizes
+        }
+        if len(positions) > 0 {
+            nPages ++
+        }
+        for i, pos := range positions {
+            results = append( results, searchResult{ pc, pos, sizes[i] } )
+        }
+    }
+
+    list := getResultsList( )
+    list.Clear( )
+    for i, r := range results {
+        if i == MAX_RESULT_ROWS {
+            break
+        }
+        hex, ascii := r.getContext( "<b>", "</b>", true )
+        err := list.AppendRow( fmt.Sprintf( r.pc.addFmt, r.pos ), hex, ascii,
+                               html.EscapeString( getPageName( r.pc ) ) )
+        if err != nil {
+            log.Fatalf( "refreshResults: unable to append result: %v", err )
+        }
+    }
+    var title string
+    if len(results) > MAX_RESULT_ROWS {
+        title = fmt.Sprintf( localizeText( resultsFirst ),
+                             MAX_RESULT_ROWS, len(results) )
+    } else if allPages {
+        title = fmt.Sprintf( localizeText( resultsInPages ),
+                             len(results), nPages )
+    } else {
+        title = fmt.Sprintf( localizeText( nMatches ), len(results) )
+    }
+    resultsArea.SetItemValue( "resultsTitle", title )
+}
+
+// return the hex and ASCII bytes around the result, with the match bytes
+// between open and close, escaped for markup if escape is true. Both are
+// empty if the result is outdated and does not fit in the data anymore.
+func (r *searchResult) getContext( open, close string,
+                                   escape bool ) (hex, ascii string) {
+    length := r.pc.store.Length()
+    if r.pos < 0 || r.size < 0 || r.pos + r.size > length {
+        return
+    }
+    start := r.pos - RESULT_CONTEXT
+    if start < 0 {
+        start = 0
+    }
+    beyond := r.pos + r.size + RESULT_CONTEXT
+    if beyond > length {
+        beyond = length
+    }
+    shown := r.size
+    ellipsis := ""
+    if shown > RESULT_MAX_MATCH {
+        shown = RESULT_MAX_MATCH
+        ellipsis = "…"
+    }
+    data := r.pc.store.GetData( start, beyond )
+    if int64(len(data)) < beyond - start {     // outdated result
+        return
+    }
+    before := data[:r.pos-start]
+    match := data[r.pos-start:r.pos-start+shown]
+    after := data[r.pos-start+r.size:]
+
+    parts := make( []string, 0, 3 )
+    if len(before) > 0 {
+        parts = append( parts, getResultHex( before ) )
+    }
+    parts = append( parts, open + getResultHex( match ) + ellipsis + close )
+    if len(after) > 0 {
+        parts = append( parts, getResultHex( after ) )
+    }
+    hex = strings.Join( parts, " " )
+
+    text := func( data []byte ) string {
+        if escape {
+            return html.EscapeString( getResultAscii( data ) )
+        }
+        return getResultAscii( data )
+    }
+    ascii = text( before ) + open + text( match ) + ellipsis + close +
+            text( after )
+    return
+}
+
+func getResultHex( data []byte ) string {
+    var b strings.Builder
+    for i, c := range data {
+        if i > 0 {
+            b.WriteByte( ' ' )
+        }
+        fmt.Fprintf( &b, "%02X", c )
+    }
+    return b.String()
+}
+
+func getResultAscii( data []byte ) string {
+    var b strings.Builder
+    for _, c := range data {
+        if isPrintableAscii( c ) {
+            b.WriteByte( c )
+        } else {
+            b.WriteByte( '.' )
+        }
+    }
+    return b.String()
+}
+
+// called when a row is activated (double click) to go to its match, after
+// making its page current if needed.
+func gotoResult( name string, row int ) bool {
+    if row >= len(results) {
+        return false
+    }
+    r := results[row]
+    if r.pc != getCurrentWorkAreaPageContext( ) {
+        n := getPageNumber( r.pc )
+        if n == -1 {
+            return false
+        }
+        mainArea.selectPage( n )
+    }
+    if i := getMatchIndexAt( r.pos ); i != -1 {
+        searchPos = r.pos
+        showHighlights( i, len(matches), r.pos )
+        updateReplaceButton( )
+    }
+    return true
+}
+
+func exportResults( name string, val interface{} ) bool {
+    dialog, err := gtk.FileChooserDialogNewWith2Buttons(
+                    localizeText( resultsExportTitle ), window,
+                    gtk.FILE_CHOOSER_ACTION_SAVE,
+                    localizeText( buttonCancel ), gtk.RESPONSE_CANCEL,
+                    localizeText( buttonSave ), gtk.RESPONSE_ACCEPT )
+    if err != nil {
+        log.Fatalf( "exportResults error: %v\n", err )
+    }
+    dialog.SetDoOverwriteConfirmation( true )
+    var path string
+    if dialog.Run( ) == gtk.RESPONSE_ACCEPT {
+        path = dialog.GetFilename( )
+    }
+    dialog.Destroy()
+    if path != "" {
+        if err = writeResults( path ); err != nil {
+            errorDisplay( localizeText( resultsExportError ), path, err )
+        }
+    }
+    return true
+}
+
+// write all results in file path, as CSV if path ends with .csv, otherwise as
+// tab separated text.
+func writeResults( path string ) error {
+    f, err := os.Create( path )
+    if err != nil {
+        return err
+    }
+    if strings.HasSuffix( strings.ToLower( path ), ".csv" ) {
+        w := csv.NewWriter( f )
+        w.Write( []string{ localizeText( resultsOffset ),
+                           localizeText( resultsHex ),
+                           localizeText( resultsAscii ),
+                           localizeText( resultsPage ) } )
+        for _, r := range results {
+            hex, ascii := r.getContext( "[", "]", false )
+            w.Write( []string{ fmt.Sprintf( r.pc.addFmt, r.pos ), hex, ascii,
+                               getPageName( r.pc ) } )
+        }
+        w.Flush()
+        err = w.Error()
+    } else {
+        w := bufio.NewWriter( f )
+        for _, r := range results {
+            hex, ascii := r.getContext( "[", "]", false )
+            fmt.Fprintf( w, "%s\t%s\t%s\t%s\n", fmt.Sprintf( r.pc.addFmt, r.pos ),
+                         hex, ascii, getPageName( r.pc ) )
+        }
+        err = w.Flush()
+    }
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
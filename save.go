@@ -0,0 +1,156 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "math/rand"
+    "os"
+    "path/filepath"
+)
+
+// Saving a file is done in a way that never leaves the original file half
+// written, even in case of crash: the new content is first written to a
+// temporary file in the same directory, and synced to disk. The original file
+// mode, ownership and extended attributes are then copied to the temporary
+// file, which is finally renamed as the original file. The original inode is
+// never modified (it is still used if data is read on demand), and a backup,
+// if requested, is just a hard link to the original inode (or a copy if hard
+// links are not possible). Special files, such as block devices, cannot be
+// replaced: they can only be modified in place (see edit.WriteChangesInPlace).
+
+// create a backup file as a hard link to the original file, or as a copy of
+// the original file if linking is not possible.
+func backupFile( path string, info os.FileInfo ) error {
+    backupPath := path + "~"
+    if err := os.Remove( backupPath ); err != nil && ! os.IsNotExist( err ) {
+        return err
+    }
+    if err := os.Link( path, backupPath ); err == nil {
+        return nil
+    }
+    src, err := os.Open( path )
+    if err != nil {
+        return err
+    }
+    defer src.Close()
+    dst, err := os.OpenFile( backupPath, os.O_WRONLY | os.O_CREATE | os.O_EXCL,
+                             info.Mode().Perm() )
+    if err != nil {
+        return err
+    }
+    _, err = io.Copy( dst, src )
+    if cErr := dst.Close(); err == nil {
+        err = cErr
+    }
+    if err == nil {
+        copyFileAttributes( path, backupPath, info )
+    }
+    return err
+}
+
+// return whether path is an existing regular file (following symbolic links).
+func isRegularFile( path string ) bool {
+    info, err := os.Stat( path )
+    return err == nil && info.Mode().IsRegular()
+}
+
+// sync the directory, so that the rename is durable. Errors are ignored since
+// not all file systems support syncing directories.
+func syncDirectory( dir string ) {
+    if d, err := os.Open( dir ); err == nil {
+        d.Sync()
+        d.Close()
+    }
+}
+
+// create a new temporary file in directory dir for the file name, with the
+// permissions perm, as restricted by the process umask.
+func createTempFile( dir, name string, perm os.FileMode ) (*os.File, error) {
+    for try := 0; ; try++ {
+        path := filepath.Join( dir, fmt.Sprintf( ".%s.hexed-%d", name,
+                                                 rand.Uint32() ) )
+        f, err := os.OpenFile( path, os.O_RDWR | os.O_CREATE | os.O_EXCL,
+                               perm )
+        if err == nil || ! os.IsExist( err ) || try == 100 {
+            return f, err
+        }
+    }
+}
+
+// writeFileAtomically writes content to the file given by path, replacing the
+// existing file if any, such that either the original file or the complete
+// new file is found at path at any time. If path is a symbolic link, the link
+// target is replaced. If backup is true, the original file is kept as path~.
+func writeFileAtomically( path string, content io.WriterTo, backup bool ) error {
+
+    if target, err := filepath.EvalSymlinks( path ); err == nil {
+        path = target
+    }
+    info, err := os.Stat( path )
+    if err != nil {
+        if ! os.IsNotExist( err ) {
+            return err
+        }
+        info = nil
+    } else if ! info.Mode().IsRegular() {
+        return fmt.Errorf( "%s is not a regular file: it can only be modified " +
+                           "in place, without changing its length\n", path )
+    }
+
+    dir, name := filepath.Split( path )
+    if dir == "" {
+        dir = "."
+    }
+    // a new file gets the default mode given by the umask, whereas an existing
+    // file mode is set once written, so that data is never readable by others
+    // in the meantime if the existing file is not.
+    perm := os.FileMode(0600)
+    if info == nil {
+        perm = 0666
+    }
+    tmp, err := createTempFile( dir, name, perm )
+    if err != nil {
+        return fmt.Errorf( "unable to create temporary file: %v", err )
+    }
+    tmpPath := tmp.Name()
+    failed := func( err error ) error {
+        tmp.Close()
+        os.Remove( tmpPath )
+        return err
+    }
+
+    if _, err = content.WriteTo( tmp ); err != nil {
+        return failed( err )
+    }
+    if err = tmp.Sync(); err != nil {
+        return failed( err )
+    }
+    if err = tmp.Close(); err != nil {
+        os.Remove( tmpPath )
+        return err
+    }
+    // ownership must be set before mode, since changing the owner may clear
+    // the setuid and setgid bits.
+    if info != nil {
+        copyFileAttributes( path, tmpPath, info )
+        mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid |
+                               os.ModeSticky)
+        if err = os.Chmod( tmpPath, mode ); err != nil {
+            os.Remove( tmpPath )
+            return err
+        }
+    }
+    if info != nil && backup {
+        if err := backupFile( path, info ); err != nil {
+            log.Printf( "Error creating backup file %s~: %v - ignoring\n",
+                        path, err )
+        }
+    }
+    if err = os.Rename( tmpPath, path ); err != nil {
+        os.Remove( tmpPath )
+        return err
+    }
+    syncDirectory( dir )
+    return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+    "os"
+    "syscall"
+)
+
+// copy ownership and extended attributes from file src to file dst. Errors
+// are ignored, since a regular user may not be allowed to give a file to
+// another user or to set some extended attributes (e.g. in trusted namespace)
+func copyFileAttributes( src, dst string, info os.FileInfo ) {
+    if st, ok := info.Sys().(*syscall.Stat_t); ok {
+        if err := os.Lchown( dst, int(st.Uid), int(st.Gid) ); err != nil {
+            printDebug( "copyFileAttributes: unable to set owner: %v\n", err )
+        }
+    }
+
+    size, err := syscall.Listxattr( src, nil )
+    if err != nil || size <= 0 {
+        return
+    }
+    names := make( []byte, size )
+    if size, err = syscall.Listxattr( src, names ); err != nil {
+        return
+    }
+    names = names[:size]
+    for len(names) > 0 {        // names are NUL terminated strings
+        var name string
+        for i, c := range names {
+            if c == 0 {
+                name = string(names[:i])
+                names = names[i+1:]
+                break
+            }
+        }
+        if name == "" {
+            break
+        }
+        vSize, err := syscall.Getxattr( src, name, nil )
+        if err != nil {
+            continue
+        }
+        value := make( []byte, vSize )
+        if vSize, err = syscall.Getxattr( src, name, value ); err != nil {
+            continue
+        }
+        if err = syscall.Setxattr( dst, name, value[:vSize], 0 ); err != nil {
+            printDebug( "copyFileAttributes: unable to set %s: %v\n", name, err )
+        }
+    }
+}
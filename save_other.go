@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+    "os"
+)
+
+// ownership and extended attributes are not supported.
+func copyFileAttributes( src, dst string, info os.FileInfo ) {
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+    "bytes"
     "log"
+    "regexp"
+    "sort"
     "strings"
+    "unicode/utf8"
+    "unicode/utf16"
 
     "internal/layout"
+    "internal/edit"
 
 	"github.com/gotk3/gotk3/gtk"
 //	"github.com/gotk3/gotk3/glib"
@@ -12,16 +18,38 @@ import (
 )
 
 const (
-    MAX_SELECTION_LENGTH = 63                   // in bytes
-    MAX_TEXT_LENGTH = 2 * MAX_SELECTION_LENGTH  // in nibbles
+    MAX_SELECTION_LENGTH = 16 * 1024            // in bytes
+    MAX_TEXT_LENGTH = 4 * MAX_SELECTION_LENGTH  // enough for \xHH per byte
+    BITAP_MAX_LENGTH = 63                       // longer patterns use BMH
     MAX_HISTORY_DEPTH = 10
     REPLACE_GRID_ROW = 1
+    SEARCH_WINDOW_SIZE = 1024 * 1024            // data searched at once
+)
+
+// search modes: how search and replace texts are encoded in data
+const (
+    SEARCH_HEX = iota                       // hexadecimal digits
+    SEARCH_TEXT                             // ASCII or UTF-8 text
+    SEARCH_UTF16LE                          // UTF-16 little endian text
+    SEARCH_UTF16BE                          // UTF-16 big endian text
+    SEARCH_REGEX                            // regular expression over bytes
 )
 
 var (
     searchArea      *layout.Layout          // search and replace area
     areaVisible     bool                    // is search/replace area visible?
     replaceVisible  bool                    // search only or search+replace
+    searchMode      int                     // how texts are encoded
+    inputMode       int                     // how input texts are encoded
+    ignoreCase      bool                    // for ASCII letters in text modes
+    withinSelection bool                    // search only in range below
+    overlapping     bool                    // matches may overlap
+    allPages        bool                    // search in all open pages
+    searchRegexp    *regexp.Regexp          // compiled regular expression
+
+    rangePage       *pageContext            // page where range was set
+    rangeStart,                             // range searched within selection
+    rangeBeyond     int64
 
     searchHistory,
     replaceHistory  *layout.History         // search and replace histories
@@ -51,12 +79,274 @@ func appendReplaceText( ) {
     }
 }
 
+// In hex mode, the search input also accepts wildcards '?' and spaces.
 func keyPress( name string, key uint, mod layout.KeyModifier ) bool {
+    if searchMode != SEARCH_HEX {
+        return false
+    }
+    if name == "searchInp" && (key == gdk.KEY_question || key == gdk.KEY_space) {
+        return false
+    }
     return layout.HexaFilter( key, mod )
 }
 
+func getSearchModeNames( ) []string {
+    return []string{ localizeText(searchModeHex),
+                     localizeText(searchModeText),
+                     localizeText(searchModeUtf16LE),
+                     localizeText(searchModeUtf16BE),
+                     localizeText(searchModeRegex) }
+}
+
+func getDefaultSearchMode( ) int {
+    if getBoolPreference( REPLACE_AS_ASCII ) {
+        return SEARCH_TEXT
+    }
+    return SEARCH_HEX
+}
+
+// return the data and the mask of bits that must match in data for each byte,
+// from a hex string made of hex digits, wildcards '?' matching any nibble and
+// spaces, which are ignored. A last odd digit is also ignored. If the string
+// has no wildcard, the returned mask is nil.
+func getPatternFromHexString( text string ) (data, care []byte) {
+    digits := strings.ReplaceAll( text, " ", "" )
+    l := len(digits) >> 1
+    if l > MAX_SELECTION_LENGTH {
+        l = MAX_SELECTION_LENGTH
+    }
+    data = make( []byte, l )
+    care = make( []byte, l )
+    wildcards := false
+    for i := 0; i < l << 1; i++ {
+        var nibble, mask byte = 0, 0x0f
+        if digits[i] == '?' {
+            mask = 0
+            wildcards = true
+        } else {
+            nibble = getNibbleFromHexDigit( digits[i] )
+        }
+        if i & 1 == 0 {
+            nibble <<= 4
+            mask <<= 4
+        }
+        data[i >> 1] |= nibble
+        care[i >> 1] |= mask
+    }
+    if ! wildcards {
+        care = nil
+    }
+    return
+}
+
+// return the data encoded by text in the given search mode. In hex mode, a
+// last odd digit is ignored and wildcards match 0. In text modes, data is
+// truncated to the maximum pattern length.
+func getDataFromText( text string, mode int ) (data []byte) {
+    switch mode {
+    case SEARCH_HEX:
+        data, _ = getPatternFromHexString( text )
+        return
+    case SEARCH_TEXT:
+        data = []byte(text)
+    case SEARCH_UTF16LE, SEARCH_UTF16BE:
+        for _, u := range utf16.Encode( []rune(text) ) {
+            if mode == SEARCH_UTF16LE {
+                data = append( data, byte(u), byte(u >> 8) )
+            } else {
+                data = append( data, byte(u >> 8), byte(u) )
+            }
+        }
+    }
+    if len(data) > MAX_SELECTION_LENGTH {
+        data = data[:MAX_SELECTION_LENGTH]
+        if mode != SEARCH_TEXT {
+            data = data[:MAX_SELECTION_LENGTH &^ 1]
+        }
+    }
+    return
+}
+
+// return the text encoding data in the given search mode, or false if data
+// cannot be decoded in that mode.
+func getTextFromData( data []byte, mode int ) (string, bool) {
+    switch mode {
+    case SEARCH_HEX:
+        b := make( []byte, len(data) << 1 )
+        writeHexDigitsFromSlice( b, data )
+        return string(b), true
+    case SEARCH_TEXT:
+        return string(data), utf8.Valid( data )
+    }
+    if len(data) & 1 == 1 {
+        return "", false
+    }
+    units := make( []uint16, len(data) >> 1 )
+    for i := range units {
+        if mode == SEARCH_UTF16LE {
+            units[i] = uint16(data[2*i]) | uint16(data[2*i+1]) << 8
+        } else {
+            units[i] = uint16(data[2*i]) << 8 | uint16(data[2*i+1])
+        }
+    }
+    text := string(utf16.Decode( units ))
+    return text, ! strings.ContainsRune( text, utf8.RuneError )
+}
+
+// return the data given by the named input text in the given search mode, or
+// false if the text does not give constant data, as with wildcards or with a
+// regular expression that is not a literal.
+func getInputData( name, text string, mode int ) ([]byte, bool) {
+    switch {
+    case mode == SEARCH_HEX && name == "searchInp":
+        return getDataFromText( text, mode ), ! strings.ContainsRune( text, '?' )
+    case mode == SEARCH_REGEX && name == "searchInp":
+        return getRegexpLiteral( text )
+    case mode == SEARCH_REGEX:
+        return getDataFromTemplate( getReplaceTemplate( text ) )
+    }
+    return getDataFromText( text, mode ), true
+}
+
+// return the named input text giving data in the given search mode, or false
+// if data cannot be given in that mode.
+func getInputText( name string, data []byte, mode int ) (string, bool) {
+    switch {
+    case mode == SEARCH_REGEX && name == "searchInp":
+        return getRegexpFromData( data ), true
+    case mode == SEARCH_REGEX:
+        return getTemplateTextFromData( data ), true
+    }
+    return getTextFromData( data, mode )
+}
+
+// convert the named input text from the input mode to the current search mode,
+// or clear it if it cannot be converted, as when it includes wildcards. It
+// returns true if the text changed.
+func convertSearchInput( name string ) bool {
+    value, err := searchArea.GetItemValue( name )
+    if err != nil {
+        log.Fatalf("convertSearchInput: can't get %s input\n", name)
+    }
+    var text string
+    data, ok := getInputData( name, value.(string), inputMode )
+    if ok {
+        text, ok = getInputText( name, data, searchMode )
+    }
+    if ! ok {
+        text = ""
+    }
+    if text == value.(string) {
+        return false
+    }
+    searchArea.SetItemValue( name, text )
+    return true
+}
+
+// convert both input texts to the current search mode, searching again if
+// the search text did not change after conversion.
+func convertSearchInputs( ) {
+    if inputMode != searchMode {
+        convertSearchInput( "replaceInp" )
+        changed := convertSearchInput( "searchInp" )
+        inputMode = searchMode
+        if ! changed {
+            refreshSearch( )
+        }
+    }
+}
+
+// Input texts are converted only if the area is visible, otherwise they will
+// be converted when the area is shown again.
+func setSearchMode( mode int ) {
+    searchMode = mode
+    searchArea.SetButtonActive( "ignoreCase", mode != SEARCH_HEX )
+    if areaVisible {
+        convertSearchInputs( )
+    }
+}
+
+func searchModeChanged( name string, val interface{} ) bool {
+    for i, n := range getSearchModeNames( ) {
+        if n == val.(string) {
+            setSearchMode( i )
+        }
+    }
+    return false
+}
+
+func ignoreCaseChanged( name string, val interface{} ) bool {
+    ignoreCase = val.(bool)
+    refreshSearch( )
+    return false
+}
+
+// toggles are also reset from preferences when the area is hidden
+func withinSelectionChanged( name string, val interface{} ) bool {
+    withinSelection = val.(bool)
+    if areaVisible {
+        refreshSearch( )
+    }
+    return false
+}
+
+func overlappingChanged( name string, val interface{} ) bool {
+    overlapping = val.(bool)
+    if areaVisible {
+        refreshSearch( )
+    }
+    return false
+}
+
+func allPagesChanged( name string, val interface{} ) bool {
+    allPages = val.(bool)
+    if areaVisible {
+        refreshSearch( )
+    }
+    return false
+}
+
+// return the selection in page pc, or the whole data if there is no selection.
+func getSelectionRange( pc *pageContext ) (start, beyond int64) {
+    if s, l := pc.getSelection(); s != -1 {
+        return s, s + l
+    }
+    return 0, pc.store.Length()
+}
+
+// set the range searched within selection to the selection in page pc, or to
+// the whole data if there is no selection.
+func setSearchRange( pc *pageContext ) {
+    rangePage = pc
+    rangeStart, rangeBeyond = getSelectionRange( pc )
+}
+
+// return the range of data to search in page pc.
+func getSearchRange( pc *pageContext ) (start, beyond int64) {
+    if ! withinSelection {
+        return 0, pc.store.Length()
+    }
+    if rangePage != pc {
+        setSearchRange( pc )
+    }
+    return rangeStart, rangeBeyond
+}
+
+// return the position pos after the change c, or the closest position in the
+// new data if pos was within the changed bytes.
+func getPositionAfterChange( pos int64, c edit.Change ) int64 {
+    if pos >= c.Start + c.OldLength {
+        return pos + c.NewLength - c.OldLength
+    }
+    if pos > c.Start + c.NewLength {
+        return c.Start + c.NewLength
+    }
+    return pos
+}
+
 const (
     WRAP_AROUND_ICON_NAME = "view-refresh"
+    SELECTION_ICON_NAME = "edit-select-all"
     SEARCH_CLOSE_ICON_NAME = "window-close"
 )
 
@@ -103,6 +393,40 @@ func newSearchReplaceArea( ) *gtk.Widget {
                                    localizeText( tooltipWrapAround ),
                                    nil, &toggleCtl }
 
+    searchMode = getDefaultSearchMode( )
+    inputMode = searchMode
+    modeNames := getSearchModeNames( )
+    modeCtl := layout.StrList{ modeNames, false, 0, nil, nil }
+    modeSel := layout.InputDef{ "searchMode", 0, modeNames[searchMode],
+                                localizeText(tooltipSearchMode),
+                                searchModeChanged, &modeCtl }
+
+    caseCtl := layout.ButtonCtl{ searchMode != SEARCH_HEX, true, false }
+    caseLabel := layout.TextDef{ localizeText(buttonIgnoreCase), &butFmt }
+    caseToggle := layout.InputDef{ "ignoreCase", 0, &caseLabel,
+                                   localizeText(tooltipIgnoreCase),
+                                   ignoreCaseChanged, &caseCtl }
+
+    withinSelection = getBoolPreference( SEARCH_IN_SELECTION )
+    selectionCtl := layout.ButtonCtl{ true, true, withinSelection }
+    selectionLabel := layout.IconDef{ SELECTION_ICON_NAME }
+    selectionToggle := layout.InputDef{ "withinSelection", 0, &selectionLabel,
+                                        localizeText(tooltipWithinSelection),
+                                        withinSelectionChanged, &selectionCtl }
+
+    overlapping = getBoolPreference( OVERLAPPING_MATCHES )
+    overlapCtl := layout.ButtonCtl{ true, true, overlapping }
+    overlapLabel := layout.TextDef{ localizeText(buttonOverlapping), &butFmt }
+    overlapToggle := layout.InputDef{ "overlapping", 0, &overlapLabel,
+                                      localizeText(tooltipOverlapping),
+                                      overlappingChanged, &overlapCtl }
+
+    allPagesCtl := layout.ButtonCtl{ true, true, allPages }
+    allPagesLabel := layout.TextDef{ localizeText(buttonAllPages), &butFmt }
+    allPagesToggle := layout.InputDef{ "allPages", 0, &allPagesLabel,
+                                       localizeText(tooltipAllPages),
+                                       allPagesChanged, &allPagesCtl }
+
     closeLabel := layout.IconDef{ SEARCH_CLOSE_ICON_NAME }
     closeSearch := layout.InputDef{ "closeSearch", 0, &closeLabel,
                                     localizeText(tooltipCloseSearch),
@@ -135,6 +459,11 @@ func newSearchReplaceArea( ) *gtk.Widget {
                                                     { false },
                                                     { false },
                                                     { false },
+                                                    { false },
+                                                    { false },
+                                                    { false },
+                                                    { false },
+                                                    { false },
                                                     { false }, },
                                               },
                           layout.VerticalDef{ ROW_SPACING, []layout.RowDef{
@@ -143,6 +472,11 @@ func newSearchReplaceArea( ) *gtk.Widget {
                                                                 &searchInp,
                                                                 &searchNext,
                                                                 &searchprevious,
+                                                                &modeSel,
+                                                                &caseToggle,
+                                                                &selectionToggle,
+                                                                &overlapToggle,
+                                                                &allPagesToggle,
                                                                 &wrapAround,
                                                                 &closeSearch } },
                                                     { false, []interface{}{
@@ -160,6 +494,9 @@ func newSearchReplaceArea( ) *gtk.Widget {
     }
 
     registerForChanges( WRAP_MATCHES, updateWrapping )
+    registerForChanges( SEARCH_IN_SELECTION, updateWithinSelection )
+    registerForChanges( OVERLAPPING_MATCHES, updateOverlapping )
+    registerForChanges( REPLACE_AS_ASCII, updateDefaultSearchMode )
     areaVisible = false
     return searchArea.GetRootWidget()
 }
@@ -180,6 +517,17 @@ func refreshSearchArea( ) {
     searchArea.SetButtonLabel( "replaceAll", localizeText( buttonReplaceAll ) )
     searchArea.SetItemTooltip( "replaceAll", localizeText( tooltipReplaceAll ) )
 
+    searchArea.SetItemChoices( "searchMode", getSearchModeNames( ), searchMode,
+                               nil )
+    searchArea.SetItemTooltip( "searchMode", localizeText( tooltipSearchMode ) )
+    searchArea.SetButtonLabel( "ignoreCase", localizeText( buttonIgnoreCase ) )
+    searchArea.SetItemTooltip( "ignoreCase", localizeText( tooltipIgnoreCase ) )
+    searchArea.SetItemTooltip( "withinSelection",
+                               localizeText( tooltipWithinSelection ) )
+    searchArea.SetButtonLabel( "overlapping", localizeText( buttonOverlapping ) )
+    searchArea.SetItemTooltip( "overlapping", localizeText( tooltipOverlapping ) )
+    searchArea.SetButtonLabel( "allPages", localizeText( buttonAllPages ) )
+    searchArea.SetItemTooltip( "allPages", localizeText( tooltipAllPages ) )
 
     searchArea.SetItemTooltip( "wrapAround", localizeText( tooltipWrapAround ) )
     searchArea.SetItemTooltip( "closeSearch", localizeText( tooltipCloseSearch ) )
@@ -191,13 +539,43 @@ func updateWrapping( name string ) {
     }
 }
 
+func updateWithinSelection( name string ) {
+    if ! areaVisible {
+        searchArea.SetItemValue( "withinSelection",
+                                 getBoolPreference( SEARCH_IN_SELECTION ) )
+    }
+}
+
+func updateOverlapping( name string ) {
+    if ! areaVisible {
+        searchArea.SetItemValue( "overlapping",
+                                 getBoolPreference( OVERLAPPING_MATCHES ) )
+    }
+}
+
+func updateDefaultSearchMode( name string ) {
+    if ! areaVisible {
+        searchArea.SetItemChoices( "searchMode", getSearchModeNames( ),
+                                   getDefaultSearchMode( ), nil )
+    }
+}
+
 func hideSearchArea( ) {
-    resetMatches(0)
+    cancelSearch()
+    hideResultsArea()
+    resetPageMatches()
+    resetMatches()
     removeHighlights()
     releaseSearchFocus( )
     areaVisible = false
     searchArea.SetVisible( false )
     searchArea.SetItemValue( "wrapAround", getBoolPreference( WRAP_MATCHES ) )
+    searchArea.SetItemValue( "withinSelection",
+                             getBoolPreference( SEARCH_IN_SELECTION ) )
+    searchArea.SetItemValue( "overlapping",
+                             getBoolPreference( OVERLAPPING_MATCHES ) )
+    searchArea.SetItemChoices( "searchMode", getSearchModeNames( ),
+                               getDefaultSearchMode( ), nil )
 }
 
 func exitSearch( name string, val interface{} ) bool {
@@ -211,12 +589,11 @@ func searchGiveFocus( ) {
 
 func setSearchFocus( ) {
     requestSearchFocus( )
+    convertSearchInputs( )
     data := getSelectionData( MAX_SELECTION_LENGTH )
-    l := len(data)
-    if l > 0 {
-        b := make( []byte, l << 1 )
-        writeHexDigitsFromSlice( b, data )
-        err := searchArea.SetItemValue( "searchInp", string(b) )
+    text, ok := getInputText( "searchInp", data, searchMode )
+    if ok && len(data) > 0 {
+        err := searchArea.SetItemValue( "searchInp", text )
         if err != nil {
             log.Fatalf("setSearchFocus: %v", err)
         }
@@ -255,7 +632,9 @@ func BytesFromHexString( l int, s string ) (res []byte) {
     return
 }
 
-func getAsciiMarkupFromData( data []byte ) string {
+// return the ASCII markup for data. If care is not nil, bytes including
+// wildcards are shown as '?'.
+func getAsciiMarkupFromData( data, care []byte ) string {
     var b strings.Builder
     b.WriteString( `<span foreground="red" style="italic">` )
     b.WriteString( localizeText( tooltipAscii ) )
@@ -263,7 +642,9 @@ func getAsciiMarkupFromData( data []byte ) string {
     l := len(data)
     for i := 0; i < l; i ++ {
         c := data[i]
-        if c == '\n' {
+        if care != nil && care[i] != 0xff {
+            b.WriteByte( '?' )
+        } else if c == '\n' {
             b.WriteString( "↩" )
         } else if c == '\t' {
             b.WriteString( "↹" )
@@ -278,12 +659,41 @@ func getAsciiMarkupFromData( data []byte ) string {
     return b.String()
 }
 
+func getHexMarkupFromData( data []byte ) string {
+    var b strings.Builder
+    b.WriteString( `<span foreground="red" style="italic">` )
+    b.WriteString( localizeText( tooltipHex ) )
+    b.WriteString( `</span> «` )
+    for i, c := range data {
+        if i > 0 {
+            b.WriteByte( ' ' )
+        }
+        b.WriteByte( getHexDigitFromNibble( c >> 4 ) )
+        b.WriteByte( getHexDigitFromNibble( c & 0x0f ) )
+    }
+    b.WriteString( "»" )
+    return b.String()
+}
+
+// return the markup showing data in another form than the one used by the
+// current search mode.
+func getSearchMarkupFromData( data, care []byte ) string {
+    if searchMode == SEARCH_HEX {
+        return getAsciiMarkupFromData( data, care )
+    }
+    return getHexMarkupFromData( data )
+}
+
 func updateReplaceTooltip( name string, val interface{} ) bool {
     text := val.(string)
-    l := (len(text) >> 1) << 1
-    rs := BytesFromHexString( l, text )
-    asciiMarkup := getAsciiMarkupFromData( rs )
-    err := searchArea.SetItemTooltip( "replaceInp", asciiMarkup )
+    var markup string
+    if searchMode == SEARCH_REGEX {
+        markup = localizeText( tooltipRegexReplace )
+    } else {
+        rs := getDataFromText( text, searchMode )
+        markup = getSearchMarkupFromData( rs, nil )
+    }
+    err := searchArea.SetItemTooltip( "replaceInp", markup )
     if err != nil {
         log.Fatalf("updateReplaceTooltip: can't update entry tooltip: %v", err)
     }
@@ -306,14 +716,26 @@ func refreshSearch( ) {
 }
 
 func search( text string ) {
-    l := (len(text) >> 1) << 1
-    pattern = BytesFromHexString( l, text )
-    asciiMarkup := getAsciiMarkupFromData( pattern )
-    err := searchArea.SetItemTooltip( "searchInp", asciiMarkup )
+    var markup string
+    searchRegexp = nil
+    switch searchMode {
+    case SEARCH_HEX:
+        pattern, patternCare = getPatternFromHexString( text )
+        markup = getSearchMarkupFromData( pattern, patternCare )
+    case SEARCH_REGEX:
+        pattern, patternCare = []byte(text), nil
+        markup = compileSearchRegexp( text )
+    default:
+        pattern, patternCare = getDataFromText( text, searchMode ), nil
+        markup = getSearchMarkupFromData( pattern, patternCare )
+    }
+    err := searchArea.SetItemTooltip( "searchInp", markup )
     if err != nil {
         log.Fatalf("search: can't update entry tooltip: %v", err)
     }
     pc := getCurrentPageContext()
+    setSearchRange( pc )
+    resetPageMatches( )
     pc.findPattern( )
     updateReplaceButton()
 }
@@ -340,6 +762,20 @@ func searchDialog( ) {
     highlightSearchResults( false  )
 }
 
+// search for the current page selection, up to MAX_SELECTION_LENGTH bytes,
+// switching to hex mode if the selection cannot be given in the current mode.
+func findSelection( ) {
+    data := getSelectionData( MAX_SELECTION_LENGTH )
+    if len(data) == 0 {
+        return
+    }
+    if _, ok := getInputText( "searchInp", data, searchMode ); ! ok {
+        searchArea.SetItemChoices( "searchMode", getSearchModeNames( ),
+                                   SEARCH_HEX, nil )
+    }
+    highlightSearchResults( areaVisible && replaceVisible )
+}
+
 func activateReplaceButtons( replaceState, replaceAllstate bool ) {
     err := searchArea.SetButtonActive( "replace", replaceState )
     if err != nil {
@@ -358,8 +794,9 @@ func updateReplaceButton( ) {
         if err != nil {
             log.Fatal("updateReplaceButton: cannot get replace text:", err)
         }
-        if len(text.(string)) & 1 == 0 {
-            replaceAllState = true
+        if searchMode != SEARCH_HEX || len(text.(string)) & 1 == 0 {
+            // replace all waits for all matches to be found
+            replaceAllState = ! isSearchInProgress()
             if isMatchSelected() {
                 replaceState = true
             }
@@ -401,15 +838,60 @@ func replaceMatch( name string, val interface{} ) bool {
     text := val.(string)
     printDebug("replaceMatch: replace with \"%s\"\n", text)
 
-    l := (len(text) >> 1) << 1
-    data := BytesFromHexString( l, text )
-
+    index := getMatchIndexAt( searchPos )
+    if index == -1 {
+        return false
+    }
     pc := getCurrentPageContext()
-    pc.store.ReplaceBytesAt( searchPos, 0, matchSize, data )
+    size := matchSizes[index]
+    var data []byte
+    if searchMode == SEARCH_REGEX {
+        expand := pc.getRegexpExpander( getReplaceTemplate( text ) )
+        data = expand( searchPos, size )
+    } else {
+        data = getDataFromText( text, searchMode )
+    }
+    pc.store.ReplaceBytesAt( searchPos, 0, size, data )
     appendReplaceText()
     return findNext( "", nil )
 }
 
+// return the positions and sizes of the matches in array that do not overlap a
+// previous match, since overlapping matches cannot be replaced together.
+func getReplaceableMatches( array, arraySizes []int64 ) (positions,
+                                                          sizes []int64) {
+    end := int64(0)
+    for i, pos := range array {
+        if pos >= end {
+            positions = append( positions, pos )
+            sizes = append( sizes, arraySizes[i] )
+            end = pos + arraySizes[i]
+        }
+    }
+    return
+}
+
+// replace all matches in page pc with text, as a single undoable operation.
+func (pc *pageContext) replaceMatches( array, arraySizes []int64,
+                                       text string ) {
+    positions, sizes := getReplaceableMatches( array, arraySizes )
+    if searchMode == SEARCH_REGEX {
+        expand := pc.getRegexpExpander( getReplaceTemplate( text ) )
+        data := make( [][]byte, len(positions) )
+        for i, pos := range positions {
+            data[i] = expand( pos, sizes[i] )
+        }
+        pc.store.ReplaceSegmentsAtMultipleLocations( positions, 0, sizes,
+                                                     data )
+    } else {
+        data := getDataFromText( text, searchMode )
+        pc.store.ReplaceBytesAtMultipleLocations( positions, 0, sizes[0],
+                                                  data )
+    }
+}
+
+// replace all matches in the current page, or in all writable pages when
+// searching all pages, with one undoable operation per page.
 func replaceAllMatches( name string, val interface{}) bool {
     log.Println( "replaceAllMatches")
     requestSearchFocus( )   // to make sure focus is not on main area anymore
@@ -421,11 +903,30 @@ func replaceAllMatches( name string, val interface{}) bool {
     text := val.(string)
     printDebug("replaceAllMatches: matches=%v\n", matches)
     printDebug("replaceAllMatches: replace with \"%s\"\n", text)
-    l := (len(text) >> 1) << 1
-    data := BytesFromHexString( l, text )
 
-    pc := getCurrentPageContext()
-    pc.store.ReplaceBytesAtMultipleLocations( matches, 0, matchSize, data )
+    // other page matches are forgotten as soon as their page changes
+    var others []*pageContext
+    var otherMatches []*searchResults
+    if allPages {
+        for _, pg := range mainArea.pages {
+            r := pageMatches[pg.context]
+            if r != nil && len(r.positions) > 0 && ! pg.context.tempReadOnly {
+                others = append( others, pg.context )
+                otherMatches = append( otherMatches, r )
+            }
+        }
+    }
+    if len(matches) == 0 && len(others) == 0 {
+        return false
+    }
+
+    if len(matches) > 0 {
+        getCurrentPageContext().replaceMatches( matches, matchSizes, text )
+    }
+    for i, pc := range others {
+        pc.replaceMatches( otherMatches[i].positions, otherMatches[i].sizes,
+                           text )
+    }
 
     appendSearchText()
     appendReplaceText()
@@ -434,22 +935,76 @@ func replaceAllMatches( name string, val interface{}) bool {
     return true
 }
 
-func bitapSearch( text []byte, pattern []byte ) (index int64) {
-    l := len(pattern)
-    if l == 0 {
-        return -1
+// return the other case of b if b is an ASCII letter, or b itself otherwise.
+func otherCase( b byte ) byte {
+    switch {
+    case b >= 'a' && b <= 'z':
+        return b - ('a' - 'A')
+    case b >= 'A' && b <= 'Z':
+        return b + ('a' - 'A')
     }
-    if l > 63 {
-        return -1
+    return b
+}
+
+// return which pattern bytes are ASCII letters matching both cases, or nil if
+// case is not ignored. In UTF-16 modes, only the low byte of a code unit with
+// a zero high byte is an ASCII letter.
+func getCaseFolding( pattern []byte ) (fold []bool) {
+    if ! ignoreCase || searchMode == SEARCH_HEX {
+        return
     }
+    fold = make( []bool, len(pattern) )
+    for i, b := range pattern {
+        if b == otherCase( b ) {
+            continue
+        }
+        switch searchMode {
+        case SEARCH_TEXT:
+            fold[i] = true
+        case SEARCH_UTF16LE:
+            fold[i] = i & 1 == 0 && pattern[i+1] == 0
+        case SEARCH_UTF16BE:
+            fold[i] = i & 1 == 1 && pattern[i-1] == 0
+        }
+    }
+    return
+}
 
-    // initialize mask with each pattern char position in bitap
-    var mask [256]uint64
+// return the bitap masks for pattern, with each pattern byte position in
+// bitap cleared for all byte values matching that pattern byte. If care is not
+// nil, only the bits set in care must match, and if fold is not nil, pattern
+// bytes for which fold is true match both cases.
+func getBitapMasks( pattern, care []byte, fold []bool ) (mask *[256]uint64) {
+    mask = new( [256]uint64 )
     for i := 0; i < 256; i++ {
         mask[i] = ^uint64(0)
     }
-    for i := 0; i < l; i++ {
-        mask[pattern[i]] &= ^(1 << uint64(i))
+    for i := 0; i < len(pattern); i++ {
+        bit := ^(uint64(1) << uint64(i))
+        if care != nil && care[i] != 0xff {
+            for v := 0; v < 256; v++ {
+                if byte(v) & care[i] == pattern[i] {
+                    mask[v] &= bit
+                }
+            }
+            continue
+        }
+        mask[pattern[i]] &= bit
+        if fold != nil && fold[i] {
+            mask[otherCase(pattern[i])] &= bit
+        }
+    }
+    return
+}
+
+// return the position of the first pattern of length l found in text, or -1
+// if not found, given the pattern bitap masks.
+func bitapSearch( text []byte, l int, mask *[256]uint64 ) (index int64) {
+    if l == 0 {
+        return -1
+    }
+    if l > BITAP_MAX_LENGTH {
+        return -1
     }
 
     // initialize bitap with all bits at 1, except bit 0
@@ -467,14 +1022,112 @@ func bitapSearch( text []byte, pattern []byte ) (index int64) {
     return -1
 }
 
+// return the bad character shifts for pattern in Boyer-Moore-Horspool search:
+// for each byte value, the distance from the last pattern position where that
+// value matches to the pattern end, or the pattern length if it never matches
+// before the last position. Arguments care and fold are as in getBitapMasks.
+func getHorspoolShifts( pattern, care []byte, fold []bool ) (shift *[256]int) {
+    l := len(pattern)
+    shift = new( [256]int )
+    for v := range shift {
+        shift[v] = l
+    }
+    for i := 0; i < l - 1; i++ {
+        s := l - 1 - i
+        if care != nil && care[i] != 0xff {
+            for v := 0; v < 256; v++ {
+                if byte(v) & care[i] == pattern[i] {
+                    shift[v] = s
+                }
+            }
+            continue
+        }
+        shift[pattern[i]] = s
+        if fold != nil && fold[i] {
+            shift[otherCase(pattern[i])] = s
+        }
+    }
+    return
+}
+
+// return whether byte b matches the pattern byte at index i.
+func matchPatternByte( b byte, i int, pattern, care []byte, fold []bool ) bool {
+    if care != nil {
+        b &= care[i]
+    }
+    if b == pattern[i] {
+        return true
+    }
+    return fold != nil && fold[i] && otherCase( b ) == pattern[i]
+}
+
+// return the position of the first pattern found in text, or -1 if not found,
+// using Boyer-Moore-Horspool with the given shifts. Unlike bitap, it has no
+// limit on the pattern length.
+func horspoolSearch( text, pattern, care []byte, fold []bool,
+                     shift *[256]int ) int64 {
+    l := len(pattern)
+    last := l - 1
+    exact := care == nil && fold == nil
+    for pos := 0; pos + l <= len(text); pos += shift[text[pos+last]] {
+        if exact {
+            if bytes.Equal( text[pos:pos+l], pattern ) {
+                return int64(pos)
+            }
+            continue
+        }
+        i := last
+        for i >= 0 && matchPatternByte( text[pos+i], i, pattern, care, fold ) {
+            i--
+        }
+        if i < 0 {
+            return int64(pos)
+        }
+    }
+    return -1
+}
+
+// return a function returning the position of the first pattern found in a
+// given text, or -1 if not found: bitap is used for short patterns and
+// Boyer-Moore-Horspool for longer ones.
+func getPatternFinder( pattern, care []byte,
+                       fold []bool ) func( text []byte ) int64 {
+    l := len(pattern)
+    if l <= BITAP_MAX_LENGTH {
+        mask := getBitapMasks( pattern, care, fold )
+        return func( text []byte ) int64 {
+            return bitapSearch( text, l, mask )
+        }
+    }
+    shift := getHorspoolShifts( pattern, care, fold )
+    return func( text []byte ) int64 {
+        return horspoolSearch( text, pattern, care, fold, shift )
+    }
+}
+
 // updated each time pattern changes and each time page changes
 var pattern    []byte
-var matchSize  int64    // pattern size in bytes
+var patternCare []byte  // bits that must match in pattern, nil if no wildcard
 var matches    []int64  // slice of pattern position in current document
+var matchSizes []int64  // slice of match sizes in bytes, in the same order
 var searchPos  int64    // current byte position in current document
 
-func getSearchMatches( ) (size, pos int64, array []int64) {
-    return matchSize, searchPos, matches
+var matchesPage *pageContext    // page where matches were found
+var pageMatches = make( map[*pageContext]*searchResults ) // in other pages
+
+func getSearchMatches( ) (pos int64, array, sizes []int64) {
+    return searchPos, matches, matchSizes
+}
+
+// return the index of the match at position pos, or -1 if no match starts at
+// that position.
+func getMatchIndexAt( pos int64 ) int {
+    for i := 0; i < len(matches); i ++ {
+        if matches[i] == pos {
+            return i
+        }
+    }
+    return -1
 }
 
 func updateSearchPosition( bytePos int64 ) {
@@ -485,9 +1138,10 @@ func updateSearchPosition( bytePos int64 ) {
     }
 }
 
-func resetMatches( size int ) {
+func resetMatches( ) {
     matches = matches[0:0]
-    matchSize = int64(size)
+    matchSizes = matchSizes[0:0]
+    invalidateResults( )
 }
 
 func getWrapMode( ) bool {
@@ -532,12 +1186,7 @@ func getMatchIndex( next bool ) (matchIndex int) {
 }
 
 func isMatchSelected( ) bool {
-    for i := 0; i < len(matches); i ++ {
-        if matches[i] == searchPos {
-            return true
-        }
-    }
-    return false
+    return getMatchIndexAt( searchPos ) != -1
 }
 
 func showNoMatch( l int ) {
@@ -592,36 +1241,267 @@ func selectFirstMatch( ) {
     }
 }
 
+// show the matches found so far by a search in progress, or by a complete
+// search if done is true. The current match is kept, otherwise the first
+// match after the search position is selected as soon as it is found.
+func showSearchProgress( done bool ) {
+    l := len(matches)
+    if i := getMatchIndexAt( searchPos ); i != -1 {
+        showMatchCount( i, l )
+        return
+    }
+    mi := getMatchIndex( true )
+    if mi >= 0 && mi < l && (done || matches[mi] > searchPos) {
+        searchPos = matches[mi]
+        showHighlights( mi, l, searchPos )
+        return
+    }
+    showNoMatch( l )
+}
+
+// return the finder for the current pattern, or nil if there is nothing to
+// search, and by how many bytes consecutive chunks must overlap.
+func getSearchFinder( ) (find searchFinder, overlap int) {
+    if searchMode == SEARCH_REGEX {
+        if searchRegexp != nil {
+            find, overlap = getRegexpFinder( searchRegexp ), REGEX_MAX_MATCH
+        }
+    } else if l := len(pattern); l > 0 {
+        finder := getPatternFinder( pattern, patternCare,
+                                    getCaseFolding( pattern ) )
+        find = func( data []byte, from int ) (int, int) {
+            offset := int(finder( data[from:] ))
+            if offset == -1 {
+                return -1, -1
+            }
+            return from + offset, from + offset + l
+        }
+        // consecutive chunks overlap by the pattern length - 1 to catch
+        // matches across chunk boundaries.
+        overlap = l - 1
+    }
+    return
+}
+
+// start searching for the current pattern in the page. The search runs in
+// background and matches are added as they are found.
 func (pc *pageContext) findPattern( ) {
 
-    l := len(pattern)
-    resetMatches( l )
+    cancelSearch( )
+    resetMatches( )
+    delete( pageMatches, pc )
+    matchesPage = pc
+    find, overlap := getSearchFinder( )
 
     printDebug( "Searching for %#v\n", pattern )
-    toSkip := int64(len(pattern))
-    pos := int64(0)
+    start, beyond := getSearchRange( pc )
+    if find == nil || start >= beyond {
+        selectFirstMatch( )
+        searchNextPage( )
+        return
+    }
+    startSearch( pc, nil, find, overlap, start, beyond )
+    showSearchProgress( false )
+}
 
-    if l > 0 {
-        for {
-            offset := bitapSearch( pc.store.GetData( pos, pc.store.Length() ),
-                                   pattern )
-            if offset == -1 {
+// called when page pc becomes the current page. When searching all pages, the
+// matches of the previous page are kept and those already found in pc are
+// shown without searching again.
+func (pc *pageContext) showPageMatches( ) {
+    if allPages && areaVisible {
+        if prev := matchesPage; prev != nil && prev != pc &&
+           ! isPageSearchInProgress( prev ) {
+            pageMatches[prev] = &searchResults{ matches, matchSizes, true }
+            matches, matchSizes = nil, nil
+        }
+        if r := pageMatches[pc]; r != nil && r.done {
+            delete( pageMatches, pc )
+            matches, matchSizes = r.positions, r.sizes
+            matchesPage = pc
+            invalidateResults( )
+            showSearchProgress( true )
+            updateReplaceButton( )
+            return
+        }
+    }
+    pc.findPattern( )
+}
+
+// forget all matches found in other pages.
+func resetPageMatches( ) {
+    pageMatches = make( map[*pageContext]*searchResults )
+    invalidateResults( )
+}
+
+// forget matches found in page pc, before pc is removed.
+func forgetPageMatches( pc *pageContext ) {
+    delete( pageMatches, pc )
+    if matchesPage == pc {
+        matchesPage = nil
+    }
+    invalidateResults( )
+}
+
+// return the range of data to search in page pc, which is not the current
+// page, without changing the range searched in the current page.
+func getPageSearchRange( pc *pageContext ) (start, beyond int64) {
+    if ! withinSelection {
+        return 0, pc.store.Length()
+    }
+    return getSelectionRange( pc )
+}
+
+// when searching all pages, start searching in background the first page whose
+// matches are not known yet, unless a search is already in progress.
+func searchNextPage( ) {
+    if ! allPages || ! areaVisible || isSearchInProgress( ) {
+        return
+    }
+    find, overlap := getSearchFinder( )
+    if find == nil {
+        return
+    }
+    for _, pg := range mainArea.pages {
+        pc := pg.context
+        if pc == nil || pc.store == nil || pc == matchesPage {
+            continue
+        }
+        if r := pageMatches[pc]; r != nil && r.done {
+            continue
+        }
+        r := new( searchResults )
+        pageMatches[pc] = r
+        start, beyond := getPageSearchRange( pc )
+        if start >= beyond {
+            r.done = true
+            continue
+        }
+        startSearch( pc, r, find, overlap, start, beyond )
+        return
+    }
+}
+
+// return the index of the first match at or after position pos in array.
+func getFirstMatchFrom( array []int64, pos int64 ) int {
+    return sort.Search( len(array), func( i int ) bool {
+        return array[i] >= pos
+    } )
+}
+
+// update matches after the change c, by keeping the matches before c, shifting
+// the matches after c by the change in length and searching again only around
+// the changed bytes. Return false if the whole data must be searched again.
+//
+// Unless overlapping, once a match is found the search resumes after it. The
+// new search starts after the last match kept before c, and stops as soon as
+// it resumes from a position in unchanged data that is not within an old
+// match, since the old matches after that position would be found again.
+func (pc *pageContext) updateMatches( c edit.Change ) bool {
+    if isPageSearchInProgress( pc ) || searchMode == SEARCH_REGEX ||
+       c.Kind == edit.RELOAD {
+        return false
+    }
+    l := int64(len(pattern))
+    if l == 0 {
+        return true
+    }
+    find := getPatternFinder( pattern, patternCare, getCaseFolding( pattern ) )
+    step := l                           // from match to next search
+    if overlapping {
+        step = 1
+    }
+    delta := c.NewLength - c.OldLength
+    newEnd := c.Start + c.NewLength     // end of change in new data
+    rStart, rBeyond := getSearchRange( pc )
+
+    kept := getFirstMatchFrom( matches, c.Start - l + 1 )
+    updated := make( []int64, kept, len(matches) + 1 )
+    copy( updated, matches[:kept] )
+
+    pos := c.Start - l + 1
+    if pos < rStart {
+        pos = rStart
+    }
+    if kept > 0 && matches[kept-1] + step > pos {
+        pos = matches[kept-1] + step
+    }
+    start := pos
+    for pos < rBeyond {
+        if pos >= newEnd {
+            old := pos - delta
+            i := getFirstMatchFrom( matches, old )
+            if overlapping || i == 0 || matches[i-1] + l <= old {
+                for ; i < len(matches); i++ {
+                    if matches[i] + delta + l > rBeyond {
+                        break
+                    }
+                    updated = append( updated, matches[i] + delta )
+                }
                 break
             }
-            pos += offset
-            matches = append( matches, pos )
-            pos += toSkip
-            if pos >= pc.store.Length() {
+        }
+        beyond := pos + 2 * l
+        if pos < newEnd {
+            beyond = newEnd + 2 * l
+        }
+        if beyond - start > SEARCH_WINDOW_SIZE {
+            return false                // too much to search here
+        }
+        if beyond > rBeyond {
+            beyond = rBeyond
+        }
+        offset := find( pc.store.GetData( pos, beyond ) )
+        if offset == -1 {
+            if beyond == rBeyond {
                 break
             }
+            pos = beyond - l + 1
+            continue
         }
+        updated = append( updated, pos + offset )
+        pos += offset + step
+    }
+    printDebug( "updateMatches: %d matches before, %d after\n",
+                len(matches), len(updated) )
+
+    matches = updated
+    matchSizes = matchSizes[0:0]
+    for range matches {
+        matchSizes = append( matchSizes, l )
     }
-    selectFirstMatch( )
+    invalidateResults( )
+    searchPos = getPositionAfterChange( searchPos, c )
+    return true
 }
 
-func updateSearch( ) {
+// called each time data changes in the page storage. In the current page,
+// matches are updated around the change c, keeping the current match if it is
+// still there, or searched again in the whole data if needed. In other pages,
+// matches are searched again once the current search is complete.
+func (pc *pageContext) updateSearch( c edit.Change ) {
     if areaVisible {
-        pc := getCurrentPageContext()
-        pc.findPattern( )
+        if pc != getCurrentWorkAreaPageContext() {
+            if _, ok := pageMatches[pc]; ok {
+                delete( pageMatches, pc )
+                if isPageSearchInProgress( pc ) {
+                    cancelSearch( )
+                }
+                invalidateResults( )
+                searchNextPage( )
+            }
+            return
+        }
+        if rangePage == pc {
+            rangeStart = getPositionAfterChange( rangeStart, c )
+            rangeBeyond = getPositionAfterChange( rangeBeyond, c )
+        }
+        if ! pc.updateMatches( c ) {
+            pc.findPattern( )
+            return
+        }
+        if len(pattern) > 0 {
+            showMatchCount( getMatchIndexAt( searchPos ), len(matches) )
+        }
+        updateReplaceButton()
     }
 }
@@ -0,0 +1,441 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "regexp"
+    "strings"
+    "testing"
+
+    "internal/edit"
+)
+
+// set the current search mode, search text and options, as done from the
+// search area.
+func setSearch( mode int, text string, ignore, overlap bool ) {
+    searchMode, ignoreCase, overlapping = mode, ignore, overlap
+    pattern, patternCare, searchRegexp = nil, nil, nil
+    switch mode {
+    case SEARCH_HEX:
+        pattern, patternCare = getPatternFromHexString( text )
+    case SEARCH_REGEX:
+        if ignore {
+            text = "(?i)" + text
+        }
+        searchRegexp = regexp.MustCompile( text )
+    default:
+        pattern = getDataFromText( text, mode )
+    }
+}
+
+func resetSearch( ) {
+    setSearch( SEARCH_HEX, "", false, false )
+    matches, matchSizes = nil, nil
+}
+
+// return all matches in data, found at once.
+func findAllMatches( data []byte ) (positions, sizes []int64) {
+    find, overlap := getSearchFinder( )
+    sc := &chunkScanner{ find: find, overlap: overlap,
+                         overlapping: overlapping,
+                         beyond: int64(len(data)) }
+    res := sc.scan( data )
+    return res.positions, res.sizes
+}
+
+// return all matches in data, scanned by chunks of the given size.
+func scanByChunks( t *testing.T, find searchFinder, overlap int,
+                   data []byte, size int ) (positions, sizes []int64) {
+    t.Helper()
+    sc := &chunkScanner{ find: find, overlap: overlap,
+                         overlapping: overlapping, beyond: int64(len(data)) }
+    for start := 0; start < len(data); start += size {
+        end := start + size
+        if end > len(data) {
+            end = len(data)
+        }
+        res := sc.scan( data[start:end] )
+        positions = append( positions, res.positions... )
+        sizes = append( sizes, res.sizes... )
+        if res.done != (end == len(data)) {
+            t.Fatalf( "chunk %d-%d done is %t\n", start, end, res.done )
+        }
+    }
+    return
+}
+
+func TestPatternFromHexString( t *testing.T ) {
+    tests := []struct {
+        text            string
+        data, care      []byte
+    }{
+        { "", nil, nil },
+        { "0a1B", []byte{ 0x0a, 0x1b }, nil },
+        { " 0a 1b  FF ", []byte{ 0x0a, 0x1b, 0xff }, nil },
+        { "123", []byte{ 0x12 }, nil },
+        { "ab?", []byte{ 0xab }, nil },
+        { "1?", []byte{ 0x10 }, []byte{ 0xf0 } },
+        { "?f ??", []byte{ 0x0f, 0x00 }, []byte{ 0x0f, 0x00 } },
+        { "12 ?4 56", []byte{ 0x12, 0x04, 0x56 }, []byte{ 0xff, 0x0f, 0xff } },
+    }
+    for _, test := range tests {
+        data, care := getPatternFromHexString( test.text )
+        if ! bytes.Equal( data, test.data ) ||
+           ! bytes.Equal( care, test.care ) ||
+           (care == nil) != (test.care == nil) {
+            t.Errorf( "%q: got %x, %x want %x, %x\n", test.text,
+                      data, care, test.data, test.care )
+        }
+    }
+}
+
+func TestTextDataConversions( t *testing.T ) {
+    tests := []struct {
+        mode            int
+        text            string
+        data            []byte
+        back            string          // text from data
+    }{
+        { SEARCH_HEX, "41 4a", []byte("AJ"), "414a" },
+        { SEARCH_HEX, "4?", []byte{ 0x40 }, "40" },
+        { SEARCH_TEXT, "héllo", []byte("héllo"), "héllo" },
+        { SEARCH_UTF16LE, "Aé", []byte{ 'A', 0, 0xe9, 0 }, "Aé" },
+        { SEARCH_UTF16BE, "A😀", []byte{ 0, 'A', 0xd8, 0x3d, 0xde, 0x00 },
+                                 "A😀" },
+    }
+    for _, test := range tests {
+        data := getDataFromText( test.text, test.mode )
+        if ! bytes.Equal( data, test.data ) {
+            t.Errorf( "%d %q: got data %x want %x\n", test.mode, test.text,
+                      data, test.data )
+        }
+        if text, ok := getTextFromData( data, test.mode );
+                                            ! ok || text != test.back {
+            t.Errorf( "%d %x: got text %q, %t want %q\n", test.mode, data,
+                      text, ok, test.back )
+        }
+    }
+
+    invalid := []struct {
+        mode            int
+        data            []byte
+    }{
+        { SEARCH_TEXT, []byte{ 'a', 0xff } },
+        { SEARCH_UTF16LE, []byte{ 'a', 0, 'b' } },
+        { SEARCH_UTF16LE, []byte{ 0x3d, 0xd8 } },       // lone surrogate
+        { SEARCH_UTF16BE, []byte{ 0xde, 0x00, 0, 'a' } },
+    }
+    for _, test := range invalid {
+        if text, ok := getTextFromData( test.data, test.mode ); ok {
+            t.Errorf( "%d %x: got text %q\n", test.mode, test.data, text )
+        }
+    }
+}
+
+func TestCaseFolding( t *testing.T ) {
+    defer resetSearch( )
+    tests := []struct {
+        mode            int
+        ignore          bool
+        pattern         []byte
+        fold            []bool
+    }{
+        { SEARCH_TEXT, false, []byte("aB"), nil },
+        { SEARCH_HEX, true, []byte("aB"), nil },
+        { SEARCH_TEXT, true, []byte("aB1@["),
+                             []bool{ true, true, false, false, false } },
+        { SEARCH_UTF16LE, true, []byte{ 'a', 0, 'b', 'c', '1', 0 },
+                          []bool{ true, false, false, false, false, false } },
+        { SEARCH_UTF16BE, true, []byte{ 0, 'a', 'b', 'c', 0, 'Z' },
+                          []bool{ false, true, false, false, false, true } },
+    }
+    for _, test := range tests {
+        searchMode, ignoreCase = test.mode, test.ignore
+        fold := getCaseFolding( test.pattern )
+        if fmt.Sprint( fold ) != fmt.Sprint( test.fold ) ||
+           (fold == nil) != (test.fold == nil) {
+            t.Errorf( "%d %t %q: got %v want %v\n", test.mode, test.ignore,
+                      test.pattern, fold, test.fold )
+        }
+    }
+}
+
+// each test is run with bitap and Boyer-Moore-Horspool
+var finderTests = []struct {
+    name                string
+    text, pattern, care []byte
+    fold                []bool
+    want                int64
+}{
+    { "found", []byte("hello world"), []byte("world"), nil, nil, 6 },
+    { "not found", []byte("hello world"), []byte("xyz"), nil, nil, -1 },
+    { "empty text", nil, []byte("a"), nil, nil, -1 },
+    { "longer pattern", []byte("abc"), []byte("abcd"), nil, nil, -1 },
+    { "first of several", []byte("abcabc"), []byte("bc"), nil, nil, 1 },
+    { "after partial match", []byte("aaab"), []byte("aab"), nil, nil, 1 },
+    { "at end", []byte("abcdef"), []byte("ef"), nil, nil, 4 },
+    { "case differs", []byte("xxHeLLo"), []byte("hello"), nil, nil, -1 },
+    { "case folded", []byte("xxHeLLo"), []byte("hello"), nil,
+                     []bool{ true, true, true, true, true }, 2 },
+    { "case partly folded", []byte("xxHeLLo"), []byte("hello"), nil,
+                            []bool{ false, true, true, true, true }, -1 },
+    { "wildcard nibbles", []byte{ 0x12, 0x34, 0x56 }, []byte{ 0x30, 0x06 },
+                          []byte{ 0xf0, 0x0f }, nil, 1 },
+    { "wildcard bytes", []byte("ab"), []byte{ 0, 0 }, []byte{ 0, 0 }, nil, 0 },
+    { "wildcard mismatch", []byte{ 0x12, 0x34, 0x57 }, []byte{ 0x30, 0x06 },
+                           []byte{ 0xf0, 0x0f }, nil, -1 },
+    { "wildcard and fold", []byte("xAzBy"), []byte{ 'a', 0, 'b' },
+                           []byte{ 0xff, 0, 0xff }, []bool{ true, false, true },
+                           1 },
+}
+
+func TestBitapSearch( t *testing.T ) {
+    for _, test := range finderTests {
+        mask := getBitapMasks( test.pattern, test.care, test.fold )
+        got := bitapSearch( test.text, len(test.pattern), mask )
+        if got != test.want {
+            t.Errorf( "%s: got %d want %d\n", test.name, got, test.want )
+        }
+    }
+}
+
+func TestHorspoolSearch( t *testing.T ) {
+    for _, test := range finderTests {
+        shift := getHorspoolShifts( test.pattern, test.care, test.fold )
+        got := horspoolSearch( test.text, test.pattern, test.care, test.fold,
+                               shift )
+        if got != test.want {
+            t.Errorf( "%s: got %d want %d\n", test.name, got, test.want )
+        }
+    }
+}
+
+func TestLongPatternFinder( t *testing.T ) {
+    long := []byte(strings.Repeat( "The quick brown fox. ", 5 ))
+    upper := bytes.ToUpper( long )
+    fold := make( []bool, len(long) )
+    for i, b := range long {
+        fold[i] = b != otherCase( b )
+    }
+    care := bytes.Repeat( []byte{ 0xff }, len(long) )
+    wild := append( []byte(nil), long... )
+    for i := 4; i < len(long); i += 21 {
+        care[i], wild[i] = 0, 0         // ignore each 'q'
+    }
+    text := append( append( []byte("The quick brown fox. The "),
+                            upper... ), long... )
+    tests := []struct {
+        name            string
+        pattern, care   []byte
+        fold            []bool
+        want            int64
+    }{
+        { "exact", long, nil, nil, 25 + int64(len(long)) },
+        { "case folded", long, nil, fold, 25 },
+        { "wildcards", wild, care, nil, 25 + int64(len(long)) },
+        { "not found", append( long, 'x' ), nil, nil, -1 },
+    }
+    for _, test := range tests {
+        if len(test.pattern) <= BITAP_MAX_LENGTH {
+            t.Fatalf( "%s: pattern too short for Horspool\n", test.name )
+        }
+        find := getPatternFinder( test.pattern, test.care, test.fold )
+        if got := find( text ); got != test.want {
+            t.Errorf( "%s: got %d want %d\n", test.name, got, test.want )
+        }
+    }
+}
+
+func TestChunkScanner( t *testing.T ) {
+    defer resetSearch( )
+    tests := []struct {
+        name            string
+        mode            int
+        text            string
+        ignore, overlap bool
+        data            string
+        positions,
+        sizes           []int64
+    }{
+        { "text", SEARCH_TEXT, "ab", false, false, "abab-abxab-ab",
+          []int64{ 0, 2, 5, 8, 11 }, []int64{ 2, 2, 2, 2, 2 } },
+        { "not overlapping", SEARCH_TEXT, "aba", false, false, "ababa-aba",
+          []int64{ 0, 6 }, []int64{ 3, 3 } },
+        { "overlapping", SEARCH_TEXT, "aba", false, true, "ababa-aba",
+          []int64{ 0, 2, 6 }, []int64{ 3, 3, 3 } },
+        { "ignore case", SEARCH_TEXT, "Ab", true, false, "xaBxAbxab",
+          []int64{ 1, 4, 7 }, []int64{ 2, 2, 2 } },
+        { "hex wildcard", SEARCH_HEX, "6? 62", false, false, "ab-cb-db-sb",
+          []int64{ 0, 3, 6 }, []int64{ 2, 2, 2 } },
+        { "regex", SEARCH_REGEX, "a+b", false, false, "xaabxaaabab",
+          []int64{ 1, 5, 9 }, []int64{ 3, 4, 2 } },
+        { "regex overlapping", SEARCH_REGEX, "a+b", false, true, "xaabxaaab",
+          []int64{ 1, 2, 5, 6, 7 }, []int64{ 3, 2, 4, 3, 2 } },
+        { "no match", SEARCH_TEXT, "abc", false, false, "ab-bc-abd", nil, nil },
+    }
+    for _, test := range tests {
+        setSearch( test.mode, test.text, test.ignore, test.overlap )
+        data := []byte(test.data)
+        find, overlap := getSearchFinder( )
+        for size := 1; size <= len(data); size++ {
+            positions, sizes := scanByChunks( t, find, overlap, data, size )
+            if fmt.Sprint( positions, sizes ) !=
+               fmt.Sprint( test.positions, test.sizes ) {
+                t.Errorf( "%s by %d bytes: got %v %v want %v %v\n",
+                          test.name, size, positions, sizes,
+                          test.positions, test.sizes )
+            }
+        }
+    }
+}
+
+func TestRegexpAssertions( t *testing.T ) {
+    defer resetSearch( )
+    tests := []struct {
+        text            string
+        overlap         bool
+        data            string
+        positions,
+        sizes           []int64
+    }{
+        { "^ab", false, "ababab", []int64{ 0 }, []int64{ 2 } },
+        { `\bab`, false, "ababab-ab", []int64{ 0, 7 }, []int64{ 2, 2 } },
+        { `ab\b`, false, "ababab-ab", []int64{ 4, 7 }, []int64{ 2, 2 } },
+        { `\Bb`, false, "ab b", []int64{ 1 }, []int64{ 1 } },
+        { "ab$", false, "abab", []int64{ 2 }, []int64{ 2 } },
+        { "(?m)^a+", true, "aa\naba", []int64{ 0, 3 }, []int64{ 2, 1 } },
+    }
+    for _, test := range tests {
+        setSearch( SEARCH_REGEX, test.text, false, test.overlap )
+        data := []byte(test.data)
+        find, _ := getSearchFinder( )
+        // with a short overlap, matches cross chunk boundaries
+        for _, overlap := range []int{ 2, REGEX_MAX_MATCH } {
+            for size := 1; size <= len(data); size++ {
+                positions, sizes := scanByChunks( t, find, overlap, data,
+                                                  size )
+                if fmt.Sprint( positions, sizes ) !=
+                   fmt.Sprint( test.positions, test.sizes ) {
+                    t.Errorf( "%s in %q by %d bytes: got %v %v want %v %v\n",
+                              test.text, test.data, size, positions, sizes,
+                              test.positions, test.sizes )
+                }
+            }
+        }
+    }
+}
+
+func TestRegexpExpander( t *testing.T ) {
+    defer resetSearch( )
+    tests := []struct {
+        text, template  string
+        data            string
+        want            []string
+    }{
+        { `\b(\w)(\w*)`, "${2}$1", "one two, three",
+          []string{ "neo", "wot", "hreet" } },
+        { `o\b|(o)`, "[$1]", "oo o", []string{ "[o]", "[]", "[]" } },
+        { `(?i)(x)(y)?$`, "$2$1", "xyX", []string{ "X" } },
+    }
+    for _, test := range tests {
+        store, err := edit.NewStorage( "", nil )
+        if err != nil {
+            t.Fatal( err )
+        }
+        store.InsertBytesAt( 0, 0, []byte(test.data) )
+        pc := &pageContext{ store: store }
+        setSearch( SEARCH_REGEX, test.text, false, false )
+        positions, sizes := findAllMatches( []byte(test.data) )
+        expand := pc.getRegexpExpander( getReplaceTemplate( test.template ) )
+        var got []string
+        for i, pos := range positions {
+            got = append( got, string( expand( pos, sizes[i] ) ) )
+        }
+        if fmt.Sprint( got ) != fmt.Sprint( test.want ) {
+            t.Errorf( "%s in %q: got %q want %q\n", test.text, test.data,
+                      got, test.want )
+        }
+    }
+}
+
+func TestUpdateMatches( t *testing.T ) {
+    defer resetSearch( )
+    tests := []struct {
+        name            string
+        text            string
+        ignore, overlap bool
+        data            string
+        edit            func( s *edit.Storage ) error
+    }{
+        { "insert in match", "ab", false, false, "ab-ab--ab---ab",
+          func( s *edit.Storage ) error {
+            return s.InsertBytesAt( 4, 0, []byte("x") )
+          } },
+        { "delete joining", "ab", false, false, "ab-a-b-ab",
+          func( s *edit.Storage ) error {
+            return s.DeleteBytesAt( 4, 0, 1 )
+          } },
+        { "replace making match", "ab", false, false, "ab-a--ab",
+          func( s *edit.Storage ) error {
+            return s.ReplaceBytesAt( 4, 0, 1, []byte("b") )
+          } },
+        { "insert at start", "ab", false, false, "b-ab-ab",
+          func( s *edit.Storage ) error {
+            return s.InsertBytesAt( 0, 0, []byte("a") )
+          } },
+        { "delete at end", "ab", false, false, "ab-ab-ab",
+          func( s *edit.Storage ) error {
+            return s.DeleteBytesAt( 6, 0, 2 )
+          } },
+        { "far from matches", "ab", false, false, "ab------------ab",
+          func( s *edit.Storage ) error {
+            return s.ReplaceBytesAt( 7, 0, 2, []byte("xyz") )
+          } },
+        { "multiple locations", "ab", false, false, "ax-ab-ax-ab",
+          func( s *edit.Storage ) error {
+            return s.ReplaceBytesAtMultipleLocations( []int64{ 1, 7 }, 0, 1,
+                                                      []byte("b") )
+          } },
+        { "shifted into match", "aba", false, false, "ab-aba-aba",
+          func( s *edit.Storage ) error {
+            return s.DeleteBytesAt( 2, 0, 1 )
+          } },
+        { "overlapping", "aa", false, true, "aaa-aaaa",
+          func( s *edit.Storage ) error {
+            return s.InsertBytesAt( 3, 0, []byte("a") )
+          } },
+        { "overlapping delete", "aa", false, true, "aaa-aaaa",
+          func( s *edit.Storage ) error {
+            return s.DeleteBytesAt( 1, 0, 1 )
+          } },
+        { "ignore case", "ab", true, false, "AB-ab-Ab",
+          func( s *edit.Storage ) error {
+            return s.ReplaceBytesAt( 3, 0, 1, []byte("aA") )
+          } },
+    }
+    for _, test := range tests {
+        store, err := edit.NewStorage( "", nil )
+        if err != nil {
+            t.Fatal( err )
+        }
+        store.InsertBytesAt( 0, 0, []byte(test.data) )
+        pc := &pageContext{ store: store }
+        setSearch( SEARCH_TEXT, test.text, test.ignore, test.overlap )
+        matches, matchSizes = findAllMatches( []byte(test.data) )
+
+        var change edit.Change
+        store.AddNotifyDataChange( func( c edit.Change ) { change = c } )
+        if err = test.edit( store ); err != nil {
+            t.Fatalf( "%s: %v", test.name, err )
+        }
+        if ! pc.updateMatches( change ) {
+            t.Fatalf( "%s: matches not updated\n", test.name )
+        }
+        data := store.GetData( 0, store.Length() )
+        positions, sizes := findAllMatches( data )
+        if fmt.Sprint( matches, matchSizes ) != fmt.Sprint( positions, sizes ) {
+            t.Errorf( "%s: in %q got %v %v want %v %v\n", test.name, data,
+                      matches, matchSizes, positions, sizes )
+        }
+    }
+}
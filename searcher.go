@@ -0,0 +1,221 @@
+package main
+
+import (
+	"github.com/gotk3/gotk3/glib"
+)
+
+/*
+    Searches run in a goroutine, so that the UI does not freeze while a large
+    file is searched. Since a Storage is not thread safe, data is always read
+    on the main thread: the worker asks for the next chunk of data by adding an
+    idle function, which reads SEARCH_WINDOW_SIZE bytes and sends them to the
+    worker through a channel. The slices returned by the storage are never
+    modified afterwards, so that the worker can safely use them.
+
+    The worker keeps the end of the previous chunk in front of the new one, so
+    that a match crossing chunk boundaries is found. It posts the matches found
+    in each chunk back to the main thread, again with an idle function, where
+    they are appended to the current matches, making the match count grow as
+    results arrive.
+
+    A search is cancelled when a new one starts (the pattern or the data has
+    changed, or another page became current), when the search area is hidden
+    and when its page is removed. Results posted by a cancelled search are
+    ignored.
+
+    When searching all pages, the current page is searched first, then each
+    other page in turn, one search at a time. The matches found in other pages
+    are kept in their own searchResults instead of the current matches.
+*/
+
+const (
+    REGEX_MAX_MATCH = 64 * 1024     // longest regex match across chunks
+)
+
+// searchFinder returns the start and end of the first match in data at or
+// after from, or -1 if no match is found. The bytes before from are not part of
+// the match, but they give its context to regular expression assertions.
+type searchFinder func( data []byte, from int ) (start, end int)
+
+type searchResults struct {
+    positions,                      // match positions
+    sizes       []int64             // match sizes
+    done        bool                // search is complete
+}
+
+type searcher struct {
+    pc          *pageContext        // page being searched
+    results     *searchResults      // nil for the current page matches
+    chunks      chan []byte         // data sent to the worker
+    next,                           // position of the next chunk to send
+    beyond      int64               // end of data range to search
+    overlapping bool                // search again right after each match
+    cancelled   bool
+}
+
+var currentSearcher *searcher
+
+// start searching the page pc from start to beyond in background with find,
+// adding matches to results, or to the current matches if results is nil.
+// Consecutive chunks overlap by the given number of bytes.
+func startSearch( pc *pageContext, results *searchResults, find searchFinder,
+                  overlap int, start, beyond int64 ) {
+    cancelSearch( )
+    s := &searcher{ pc: pc, results: results, chunks: make( chan []byte, 1 ),
+                    next: start, beyond: beyond, overlapping: overlapping }
+    currentSearcher = s
+    go s.run( find, overlap, start )
+}
+
+// cancel the current search, if any.
+func cancelSearch( ) {
+    if currentSearcher != nil {
+        currentSearcher.cancelled = true
+        close( currentSearcher.chunks )
+        currentSearcher = nil
+    }
+}
+
+// cancel the current search if it is for page pc and forget the matches in
+// pc, before pc is removed. A search of all pages goes on with the other pages
+// once pc is gone.
+func cancelPageSearch( pc *pageContext ) {
+    forgetPageMatches( pc )
+    if isPageSearchInProgress( pc ) {
+        cancelSearch( )
+        glib.IdleAdd( func( ) bool { searchNextPage( ); return false } )
+    }
+}
+
+func isSearchInProgress( ) bool {
+    return currentSearcher != nil
+}
+
+func isPageSearchInProgress( pc *pageContext ) bool {
+    return currentSearcher != nil && currentSearcher.pc == pc
+}
+
+// called on the main thread to send the next chunk to the worker
+func (s *searcher) feed( ) bool {
+    if ! s.cancelled {
+        beyond := s.next + SEARCH_WINDOW_SIZE
+        if beyond > s.beyond {
+            beyond = s.beyond
+        }
+        s.chunks <- s.pc.store.GetData( s.next, beyond )
+        s.next = beyond
+    }
+    return false
+}
+
+// called on the main thread with the results found in the last chunk
+func (s *searcher) deliver( res searchResults ) {
+    if s.cancelled {
+        return
+    }
+    if s.results != nil {           // other page in a search of all pages
+        s.results.positions = append( s.results.positions, res.positions... )
+        s.results.sizes = append( s.results.sizes, res.sizes... )
+        invalidateResults( )
+        if res.done {
+            s.results.done = true
+            currentSearcher = nil
+            searchNextPage( )
+            if ! isSearchInProgress( ) {    // all pages searched
+                showMatchCount( getMatchIndexAt( searchPos ), len(matches) )
+                updateReplaceButton( )
+            }
+        }
+        return
+    }
+    matches = append( matches, res.positions... )
+    matchSizes = append( matchSizes, res.sizes... )
+    invalidateResults( )
+    if res.done {
+        currentSearcher = nil
+        searchNextPage( )
+        updateReplaceButton( )
+    }
+    if len(res.positions) > 0 || res.done {
+        showSearchProgress( res.done )
+    }
+}
+
+// worker: request the next chunk, returning false if the search is cancelled
+func (s *searcher) request( ) ([]byte, bool) {
+    glib.IdleAdd( s.feed )
+    data, ok := <-s.chunks
+    return data, ok
+}
+
+// chunkScanner finds matches in consecutive chunks of data, keeping the end
+// of each chunk in front of the next one, so that a match crossing chunk
+// boundaries is found.
+type chunkScanner struct {
+    find        searchFinder
+    overlap     int                 // bytes kept in front of the next chunk
+    overlapping bool                // search again right after each match
+    buf         []byte              // unconsumed data followed by new chunk
+    context     int                 // bytes before unconsumed data in buf
+    pos,                            // position of buf in data
+    beyond      int64               // end of data range to search
+}
+
+// return the matches found in chunk, which follows the previous chunks. The
+// results are done if chunk reaches the end of the data range.
+func (sc *chunkScanner) scan( chunk []byte ) (res searchResults) {
+    sc.buf = append( sc.buf, chunk... )
+    res.done = sc.pos + int64(len(sc.buf)) >= sc.beyond
+
+    // matches starting in the overlap are found again with the next chunk
+    limit := len(sc.buf)
+    if ! res.done {
+        limit -= sc.overlap
+        if limit < 0 {
+            limit = 0
+        }
+    }
+    from := sc.context
+    for from < limit {
+        start, end := sc.find( sc.buf, from )
+        if start == -1 || start >= limit {
+            break
+        }
+        res.positions = append( res.positions, sc.pos + int64(start) )
+        res.sizes = append( res.sizes, int64(end - start) )
+        if sc.overlapping {
+            from = start + 1
+        } else {
+            from = end
+        }
+    }
+    if from < limit {
+        from = limit
+    }
+    // keep the byte before unconsumed data as context for the next chunk
+    keep := from
+    if keep > 0 {
+        keep --
+    }
+    sc.context = from - keep
+    sc.pos += int64(keep)
+    sc.buf = append( []byte(nil), sc.buf[keep:]... )
+    return
+}
+
+func (s *searcher) run( find searchFinder, overlap int, pos int64 ) {
+    sc := &chunkScanner{ find: find, overlap: overlap,
+                         overlapping: s.overlapping, pos: pos,
+                         beyond: s.beyond }
+    for {
+        chunk, ok := s.request( )
+        if ! ok {
+            return
+        }
+        res := sc.scan( chunk )
+        glib.IdleAdd( func( ) bool { s.deliver( res ); return false } )
+        if res.done {
+            return
+        }
+    }
+}
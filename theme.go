@@ -19,6 +19,7 @@ import (
 const (
     HEXED_HOME = ".hexed"
     HEXED_THEMES_DIR = "themes"
+    HEXED_JOURNAL_DIR = "journal"
     HEXED_DEFAULT_THEME = "default.xml"
 )
 
@@ -179,6 +180,7 @@ const (
     CURRENT_MATCH_BACKGROUND
     OTHER_MATCHES_BACKGROUND
     SELECTION_BACKGROUND
+    MODIFIED_BACKGROUND
 
     SEPARATOR_FOREGROUND
 
@@ -187,6 +189,9 @@ const (
     N_PATTERNS
 )
 
+// color mixed with hexa background for modified bytes, if missing in theme
+const MODIFIED_TINT = 0xff8000
+
 /* Hexed makes use of the following colors:
 
     address area foreground (text) and background
@@ -195,6 +200,7 @@ const (
     search match where the caret is located, background only
     search match other locations, background only
     text selection, background only
+    bytes modified since last saved, background only
     rows and columns separator, foreground only
     caret, foreground only
 
@@ -211,6 +217,7 @@ const (
     OTHER_MATCHES:  "search-match" (background)
 
     SELECTION:      "selection" (background)
+    MODIFIED:       "modified" (background)
     SEPARATOR:      "separator" (foreground)
     CARET:          "cursor" (foreground)
 
@@ -224,6 +231,7 @@ const (
     OTHER_MATCHES:  "search-match" (background)
 
     SELECTION:      "selection" (background)
+    MODIFIED:       "diff:changed-line" (background)
     SEPARATOR:      "bracket-match" (foreground)
     CARET:          "cursor" (foreground)
 
@@ -240,6 +248,7 @@ const (
     OTHER_MATCHES   "search-match" (background)
 
     SELECTION       "current-line" (background)
+    MODIFIED        "diff:changed-line" (background)
     SEPARATOR       "bracket-match" (background as foreground)
     CARET           "def-special-char" (foreground)
 */
@@ -269,6 +278,8 @@ var keyMapping = [...]alternate{
 
     { "selection",              choice{ -1, -1 },
                                 choice{ SELECTION_BACKGROUND, 3 } },
+    { "modified",               choice{ -1, -1 },
+                                choice{ MODIFIED_BACKGROUND, 3 } },
     { "separator",              choice{ SEPARATOR_FOREGROUND, 3 },
                                 choice{ -1, -1 } },
     { "cursor",                 choice{ CARET_FOREGROUND, 3 },
@@ -287,6 +298,9 @@ var keyMapping = [...]alternate{
     { "current-line",           choice{ -1, -1 },
                                 choice{ SELECTION_BACKGROUND, 1 } },
 
+    { "diff:changed-line",      choice{ -1, -1 },
+                                choice{ MODIFIED_BACKGROUND, 2 } },
+
     { "def:preprocessor",       choice{ ADDR_AREA_FOREGROUND, 1 },
                                 choice{ -1, -1 } },
     { "current-line-number",    choice{ -1, -1 },
@@ -509,6 +523,10 @@ func setSelectionColor( cr *cairo.Context ) {
     cr.SetSource( cairoPatterns[SELECTION_BACKGROUND] )
 }
 
+func setModifiedColor( cr *cairo.Context ) {
+    cr.SetSource( cairoPatterns[MODIFIED_BACKGROUND] )
+}
+
 func setSeparatorColor( cr *cairo.Context ) {
     cr.SetSource( cairoPatterns[SEPARATOR_FOREGROUND] )
 }
@@ -523,6 +541,13 @@ func setOppositeRGB( dst, src *[4]byte ) {
     (*dst)[colB] = 255 - (*src)[colB]
 }
 
+// mix src with 1/4 of the color tint given as 0xRRGGBB.
+func setTintedRGB( dst, src *[4]byte, tint uint32 ) {
+    (*dst)[colR] = byte( (3 * uint32((*src)[colR]) + ((tint >> 16) & 0xff)) / 4 )
+    (*dst)[colG] = byte( (3 * uint32((*src)[colG]) + ((tint >> 8) & 0xff)) / 4 )
+    (*dst)[colB] = byte( (3 * uint32((*src)[colB]) + (tint & 0xff)) / 4 )
+}
+
 func getRelativeLUminance( col *[4]byte ) float64 {
 
     RsRGB := float64((*col)[colR]) / 255.0
@@ -577,6 +602,8 @@ func isContrastSufficient( col1, col2 *[4]byte ) bool {
 //                         is insufficient, use HEXA foreground if contrast with
 //                         ASCI background is sufficient, else take the opposite
 //                         of ASCI background
+// - for modified, if background was never specified (priority == 0), use
+//                 instead HEXA background tinted with MODIFIED_TINT
 // - for separator, if contrast with HEXA background is insufficient, use HEXA
 //                  foreground instead
 // - for cursor, if missing or insufficient contrast with HEXA background, force
@@ -626,6 +653,11 @@ func (t *theme) fixColorPatterns( ) {
                                 &t.colorPatterns[ASCI_AREA_BACKGROUND] )
         }
     }
+    if t.colorPatterns[MODIFIED_BACKGROUND][colP] == 0 {
+        printDebug(" MODIFIED undefined B, setting MODIFIED B= tinted HEXA B\n")
+        setTintedRGB( &t.colorPatterns[MODIFIED_BACKGROUND],
+                      &t.colorPatterns[HEXA_AREA_BACKGROUND], MODIFIED_TINT )
+    }
     if ! isContrastSufficient( &t.colorPatterns[SEPARATOR_FOREGROUND],
                                 &t.colorPatterns[HEXA_AREA_BACKGROUND] ) {
         printDebug(" insufficient contrast between SEPA F & HEXA B, setting SEPA F=HEXA F\n")
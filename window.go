@@ -186,6 +186,26 @@ func getCurrentWorkAreaPage( ) *page {
     return getWorkAreaPageByNumber( pageNumber )
 }
 
+// return the name shown in the tab of the page whose context is pc
+func getPageName( pc *pageContext ) string {
+    for _, pg := range mainArea.pages {
+        if pg.context == pc {
+            return pg.label.GetLabel()
+        }
+    }
+    return ""
+}
+
+// return the number of the page whose context is pc, or -1 if pc is not shown
+func getPageNumber( pc *pageContext ) int {
+    for i, pg := range mainArea.pages {
+        if pg.context == pc {
+            return i
+        }
+    }
+    return -1
+}
+
 func getCurrentWorkAreaPageContext( ) *pageContext {
     pg := getCurrentWorkAreaPage()
     if nil != pg {
@@ -240,6 +260,7 @@ func closeCurrentPage( ) {
 func showWindow() {
     window.ShowAll()
     hideSearchArea()
+    hideResultsArea()
 
     updateStatusbarVisibility()
     updateToolbarVisibility()
@@ -323,6 +344,11 @@ func (wa *workArea)removePage( pageIndex int ) {
     if wa.pages[pageIndex].path != "" {
         addFileToHistory( wa.pages[pageIndex].path )
     }
+    if pc := wa.pages[pageIndex].context; pc != nil && pc.store != nil {
+        pc.minimap.stop()
+        cancelPageSearch( pc )
+        pc.store.Close()
+    }
 
     copy ( wa.pages[pageIndex:], wa.pages[pageIndex+1:] )
     wa.pages = wa.pages[0:nPages-1]
@@ -688,6 +714,7 @@ func InitApplication( args *hexedArgs ) {
     toolBar = initToolbar( )
     srArea := newSearchReplaceArea( )
     mainArea = newWorkArea( )
+    resArea := newResultsArea( )
     statusArea = newStatusArea( )
 
     // Assemble the window
@@ -698,7 +725,10 @@ func InitApplication( args *hexedArgs ) {
     windowBox.PackStart( menuBar, false, false, 0 )
     windowBox.PackStart( toolBar, false, false, 0 )
     windowBox.PackStart( srArea, false, false, 0 )
-    windowBox.PackStart( mainArea.getBin(), true, true, 1 )
+
+    // results panel is docked with pages or in its own window
+    windowBox.PackStart( newResultsDock( mainArea.getBin(), resArea ),
+                         true, true, 1 )
     windowBox.PackStart( statusArea, false, false, 0 )
 
     window.Add( windowBox )